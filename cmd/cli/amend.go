@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runAmend(args []string) error {
+	fs := flag.NewFlagSet("amend", flag.ExitOnError)
+	donationId := fs.String("donation", "", "Donation ID")
+	name := fs.String("name", "", "Corrected donor name")
+	email := fs.String("email", "", "Corrected donor email")
+	operator := fs.String("operator", os.Getenv("USER"), "Operator name recorded with the correction")
+	reason := fs.String("reason", "", "Reason recorded with the correction")
+	fs.Parse(args)
+
+	if *donationId == "" {
+		return errors.New("usage: amend -donation ID [-name NAME] [-email EMAIL] -reason REASON")
+	}
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	s := &service.AmendService{Repo: store}
+
+	for _, change := range []struct{ field, value string }{
+		{model.CorrectionClientName, *name},
+		{model.CorrectionClientEmail, *email},
+	} {
+		if change.value == "" {
+			continue
+		}
+		c, err := s.Amend(*donationId, change.field, change.value, *operator, *reason)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Amended %s of %s: %q -> %q\n", c.Field, c.DonationId, c.OldValue, c.NewValue)
+	}
+	return printHistory(s, *donationId)
+}
+
+func printHistory(s *service.AmendService, donationId string) error {
+	donation, history, err := s.History(donationId)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s <%s>\n", donation.Id, donation.ClientName, donation.ClientEmail)
+	if len(history) == 0 {
+		fmt.Println("No corrections")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WHEN\tOPERATOR\tFIELD\tOLD\tNEW\tREASON")
+	for _, c := range history {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Created.Format(time.DateTime), c.Operator, c.Field, c.OldValue, c.NewValue, c.Reason)
+	}
+	return w.Flush()
+}
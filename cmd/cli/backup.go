@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+)
+
+func runBackup(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: backup create|list|verify|prune [flags]")
+	}
+	fs := flag.NewFlagSet("backup "+args[0], flag.ExitOnError)
+	archive := fs.String("archive", "", "Snapshot to verify")
+	daily := fs.Int("daily", 7, "Days to keep the newest snapshot of")
+	weekly := fs.Int("weekly", 4, "Weeks to keep the newest snapshot of")
+	monthly := fs.Int("monthly", 12, "Months to keep the newest snapshot of")
+	fs.Parse(args[1:])
+
+	backups, err := openBackups()
+	if err != nil {
+		return err
+	}
+	policy := repo.RetentionPolicy{Daily: *daily, Weekly: *weekly, Monthly: *monthly}
+
+	switch args[0] {
+	case "create":
+		snapshot, err := backups.Create(time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Println("Snapshot created:", snapshot.Path)
+		return pruneBackups(backups, policy)
+	case "list":
+		snapshots, err := backups.List()
+		if err != nil {
+			return err
+		}
+		if len(snapshots) == 0 {
+			fmt.Println("No snapshots in", backups.Dir)
+			return nil
+		}
+		keep := policy.Keep(snapshots)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CREATED\tRETAINED\tPATH")
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s\t%t\t%s\n", s.Created.Format(time.RFC3339), keep[s.Path], s.Path)
+		}
+		return w.Flush()
+	case "verify":
+		if *archive == "" {
+			return errors.New("-archive is required")
+		}
+		manifest, err := backups.Verify(*archive)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("OK: %d files from %s match the manifest\n", len(manifest.Files), manifest.Created.Format(time.RFC3339))
+		return nil
+	case "prune":
+		return pruneBackups(backups, policy)
+	default:
+		return fmt.Errorf("unknown backup command: %s", args[0])
+	}
+}
+
+func pruneBackups(backups *repo.Backups, policy repo.RetentionPolicy) error {
+	removed, err := backups.Prune(policy)
+	for _, s := range removed {
+		fmt.Println("Snapshot removed:", s.Path)
+	}
+	return err
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	archive := fs.String("archive", "", "Snapshot to restore")
+	fs.Parse(args)
+
+	if *archive == "" {
+		return errors.New("-archive is required")
+	}
+	backups, err := openBackups()
+	if err != nil {
+		return err
+	}
+	manifest, previous, err := backups.Restore(*archive, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Println("The previous files were saved to", previous.Path)
+	fmt.Printf("Restored %d files from %s\n", len(manifest.Files), manifest.Created.Format(time.RFC3339))
+	return nil
+}
+
+func openBackups() (*repo.Backups, error) {
+	cfg, err := repo.ConfigFromEnv(dataDir())
+	if err != nil {
+		return nil, err
+	}
+	return repo.NewBackups(cfg), nil
+}
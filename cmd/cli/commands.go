@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"amend":          runAmend,
+	"backup":         runBackup,
+	"fees":           runFees,
+	"gdpr":           runGDPR,
+	"import":         runImport,
+	"migrate":        runMigrate,
+	"quarantine":     runQuarantine,
+	"restore":        runRestore,
+	"rotate-key":     runRotateKey,
+	"search":         runSearch,
+	"stats":          runStats,
+	"statements":     runStatements,
+	"sqlite-migrate": runSQLiteMigrate,
+	"sync":           runSync,
+	"validate":       runValidate,
+	"verify":         runVerify,
+	"verify-chain":   runVerifyChain,
+}
+
+func runCommand(name string, args []string) {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\navailable commands: %v\n", name, commandNames())
+		os.Exit(2)
+	}
+	if err := cmd(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
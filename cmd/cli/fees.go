@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runFees(args []string) error {
+	fs := flag.NewFlagSet("fees", flag.ExitOnError)
+	from := fs.String("from", "", "First day, YYYY-MM-DD, with -to")
+	to := fs.String("to", "", "Last day, YYYY-MM-DD")
+	year := fs.Int("year", time.Now().Year(), "Year, when no -from/-to is given")
+	quarter := fs.Int("quarter", 0, "Only this quarter 1-4 of -year")
+	month := fs.Int("month", 0, "Only this month 1-12 of -year")
+	currency := fs.String("currency", model.DefaultCurrency, "Currency of the donations")
+	rate := fs.Float64("rate", float64(service.DefaultFeePricing.Rate)/100, "Expected fee in percent of the gross")
+	fixed := fs.Int64("fixed", service.DefaultFeePricing.Fixed, "Expected fixed fee per donation in bani")
+	tolerance := fs.Float64("tolerance", float64(service.DefaultFeePricing.Tolerance)/100, "Flag fees further than this many percentage points from the expected fee")
+	all := fs.Bool("all", false, "List every donation, not only the flagged ones")
+	format := fs.String("format", "table", "Output as table or json")
+	out := fs.String("out", "-", "Output file for json, or - for stdout")
+	fs.Parse(args)
+
+	period, err := selectPeriod(*from, *to, *year, *quarter, *month)
+	if err != nil {
+		return err
+	}
+	pricing := service.FeePricing{
+		Rate:      int64(math.Round(*rate * 100)),
+		Fixed:     *fixed,
+		Tolerance: int64(math.Round(*tolerance * 100)),
+	}
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := (&service.FeeService{Repo: store}).GetFeeReport(period, *currency, pricing)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "table":
+		printFeeReport(report, *all)
+	case "json":
+		return writeJSON(*out, report)
+	default:
+		return fmt.Errorf("invalid -format %q, expected table or json", *format)
+	}
+	return nil
+}
+
+func printFeeReport(report *service.FeeReport, all bool) {
+	money := func(amount int64) model.Money { return model.NewMoney(amount, report.Currency) }
+	percent := func(rate float64) string { return fmt.Sprintf("%.2f%%", rate*100) }
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Period\t%s - %s\n", report.Start.Format(time.DateOnly), report.Last.Format(time.DateOnly))
+	fmt.Fprintf(w, "Pricing\t%.2f%% + %s, flagged beyond %.2f points\n", float64(report.Pricing.Rate)/100, money(report.Pricing.Fixed), float64(report.Pricing.Tolerance)/100)
+	fmt.Fprintf(w, "Donations\t%d, %d flagged\n", len(report.Donations), report.Flagged)
+	if report.OtherCurrencies > 0 {
+		fmt.Fprintf(w, "Other currencies\t%d\n", report.OtherCurrencies)
+	}
+	fmt.Fprintf(w, "Gross\t%s\n", money(report.Gross))
+	fmt.Fprintf(w, "Fees\t%s, expected %s\n", money(report.Fee), money(report.Expected))
+	fmt.Fprintf(w, "Effective rate\t%s\n", percent(report.Rate))
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MONTH\tDONATIONS\tGROSS\tFEE\tRATE\tCHANGE")
+	for _, m := range report.Months {
+		if m.Donations == 0 {
+			fmt.Fprintf(w, "%s\t0\t-\t-\t-\t-\n", m.Month.Format("2006-01"))
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%+.2f\n", m.Month.Format("2006-01"), m.Donations, money(m.Gross), money(m.Fee), percent(m.Rate), m.Change*100)
+	}
+	w.Flush()
+
+	if len(report.Payouts) > 0 {
+		fmt.Println()
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PAYOUT\tCREATED\tGROSS\tFEE\tRATE")
+		for _, p := range report.Payouts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Id, p.Created.Format(time.DateOnly), money(p.Gross), money(p.Fee), percent(p.Rate))
+		}
+		w.Flush()
+	}
+
+	if report.Flagged == 0 && !all {
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DONATION\tCREATED\tPAYOUT\tGROSS\tFEE\tEXPECTED\tRATE\tFLAGGED")
+	for _, d := range report.Donations {
+		if !d.Flagged && !all {
+			continue
+		}
+		flagged := ""
+		if d.Flagged {
+			flagged = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Id, d.Created.Format(time.DateOnly), d.PayoutId, money(d.Gross), money(d.Fee), money(d.Expected), percent(d.Rate), flagged)
+	}
+	w.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/diother/hintermann-stripe-cli/internal/pdfgen"
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runGDPR(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: gdpr export|erase -email ... [flags]")
+	}
+	fs := flag.NewFlagSet("gdpr "+args[0], flag.ExitOnError)
+	email := fs.String("email", "", "Donor email address")
+	out := fs.String("out", "", "Export directory (default dist/gdpr/<email>)")
+	operator := fs.String("operator", os.Getenv("USER"), "Operator name recorded in the erasure log")
+	reason := fs.String("reason", "", "Reason recorded in the erasure log, e.g. the request reference")
+	fs.Parse(args[1:])
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	s := &service.SubjectService{
+		Repo:       store,
+		Quarantine: &repo.QuarantineRepo{Dir: filepath.Join(dataDir(), "quarantine")},
+		Rejected:   &repo.QuarantineRepo{Dir: filepath.Join(dataDir(), "rejected")},
+		Log:        repo.NewErasureLog(dataDir()),
+	}
+
+	switch args[0] {
+	case "export":
+		dir := *out
+		if dir == "" {
+			dir = helper.SubjectExportDir(*email)
+		}
+		return exportSubject(s, &service.ReportService{Repo: store}, *email, dir)
+	case "erase":
+		record, err := s.Erase(*email, *operator, *reason)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pseudonymized %d donations, %d quarantined and %d rejected payouts as %s\n",
+			len(record.DonationIds), len(record.QuarantinedPayouts), len(record.RejectedPayouts), record.Pseudonym)
+		if err := removeInvoices(store, record.DonationIds); err != nil {
+			return err
+		}
+		return removeStatements(*email)
+	default:
+		return fmt.Errorf("unknown gdpr command: %s", args[0])
+	}
+}
+
+func exportSubject(s *service.SubjectService, reports *service.ReportService, email, dir string) error {
+	records, err := s.Export(email)
+	if err != nil {
+		return err
+	}
+	if len(records.Donations) == 0 && len(records.Quarantined) == 0 && len(records.Rejected) == 0 {
+		return fmt.Errorf("no records found for %s", email)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "records.json"), append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	for _, d := range dto.FromDonations(records.Donations) {
+		if err := pdfgen.WriteInvoice(d, filepath.Join(dir, "invoice_"+d.Id+".pdf")); err != nil {
+			return fmt.Errorf("failed to generate invoice %s: %w", d.Id, err)
+		}
+	}
+	years := make(map[int]bool)
+	for _, d := range records.Donations {
+		years[d.Created.Year()] = true
+	}
+	for year := range years {
+		statement, err := reports.GetDonorStatement(year, email)
+		if err != nil {
+			return fmt.Errorf("failed to generate the %d statement: %w", year, err)
+		}
+		if err := pdfgen.WriteDonorStatement(statement, filepath.Join(dir, fmt.Sprintf("statement_%d.pdf", year))); err != nil {
+			return fmt.Errorf("failed to write the %d statement: %w", year, err)
+		}
+	}
+	fmt.Printf("Exported %d donations, %d quarantined and %d rejected charges, %d invoices and %d statements to %s\n",
+		len(records.Donations), len(records.Quarantined), len(records.Rejected), len(records.Donations), len(years), dir)
+	return nil
+}
+
+// removeStatements deletes the donor's generated statements in
+// dist/statements. Statements written elsewhere with -out are not found.
+func removeStatements(email string) error {
+	paths, err := helper.DonorStatementPaths(email)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(paths) > 0 {
+		fmt.Printf("Removed %d generated statements\n", len(paths))
+	}
+	return nil
+}
+
+// removeInvoices deletes the generated invoices that still show the donor.
+// They can be generated again from the pseudonymized rows.
+func removeInvoices(r service.Reader, donationIds []string) error {
+	removed := 0
+	for _, id := range donationIds {
+		page, err := r.QueryDonations(service.DonationQuery{Id: id})
+		if err != nil {
+			return err
+		}
+		for _, d := range page.Donations {
+			err := os.Remove(helper.InvoicePath(d.PayoutId, d.Id))
+			if err == nil {
+				removed++
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	if removed > 0 {
+		fmt.Printf("Removed %d generated invoices\n", removed)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Validate the reports without writing anything")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("usage: cli import [-dry-run] report.csv...")
+	}
+	var reports []*service.StripeReport
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		report, err := service.ParseStripeReport(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("%s: %s report, %d transactions\n", path, report.Format, len(report.Transactions))
+		reports = append(reports, report)
+	}
+
+	policy, err := loadDonationPolicy()
+	if err != nil {
+		return err
+	}
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	s := &service.ImportService{Repo: store, Policy: policy, DryRun: *dryRun}
+	result, err := s.Import(reports)
+	if err != nil {
+		return err
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d payouts, %d already stored, %d failed\n", verb, len(result.Imported), len(result.Existing), len(result.Failed))
+	if len(result.Unassigned) > 0 {
+		fmt.Printf("%d transactions are not assigned to a payout: add the payout reconciliation report covering them\n", len(result.Unassigned))
+	}
+	for _, id := range result.FailedIds() {
+		fmt.Printf("\nPayout %s:\n", id)
+		printValidationErrors(result.Failed[id])
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/diother/hintermann-stripe-cli/internal/pdfgen"
@@ -12,17 +14,27 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	monthly := flag.Bool("monthly", false, "Generate monthly report")
+	annual := flag.Bool("annual", false, "Generate annual report")
+	quarter := flag.Int("quarter", 0, "Generate quarterly report for quarter 1-4 of -year")
+	from := flag.String("from", "", "Generate report from this date (YYYY-MM-DD), with -to")
+	to := flag.String("to", "", "Last day of the report (YYYY-MM-DD)")
 	payoutId := flag.String("payout", "", "Generate payout report by ID")
-	year := flag.Int("year", time.Now().Year(), "Year for monthly report")
+	year := flag.Int("year", time.Now().Year(), "Year for monthly or annual report")
 	month := flag.Int("month", int(time.Now().Month()), "Month for monthly report")
 	flag.Parse()
 
-	repo := &repo.CSVRepo{
-		DonationsFile: "data/donations.csv",
-		PayoutsFile:   "data/payouts.csv",
+	store, err := openRepo()
+	if err != nil {
+		log.Fatal(err)
 	}
-	service := &service.ReportService{Repo: repo}
+	defer store.Close()
+	service := &service.ReportService{Repo: store}
 
 	if *monthly {
 		report, err := service.GetMonthlyReport(*year, time.Month(*month))
@@ -34,6 +46,52 @@ func main() {
 			log.Fatal(err)
 		}
 		fmt.Println("Monthly report generated:", path)
+		if report.LedgerHead != "" {
+			fmt.Println("Ledger head:", report.LedgerHead)
+		}
+	} else if *quarter != 0 {
+		report, err := service.GetQuarterlyReport(*year, *quarter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path, err := pdfgen.GenerateQuarterlyReport(report, *year, *quarter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Quarterly report generated:", path)
+		if report.LedgerHead != "" {
+			fmt.Println("Ledger head:", report.LedgerHead)
+		}
+	} else if *from != "" || *to != "" {
+		period, err := parsePeriod(*from, *to)
+		if err != nil {
+			log.Fatal(err)
+		}
+		report, err := service.GetPeriodReport(period)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path, err := pdfgen.GeneratePeriodReport(report, period.Start, period.Last())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Report generated:", path)
+		if report.LedgerHead != "" {
+			fmt.Println("Ledger head:", report.LedgerHead)
+		}
+	} else if *annual {
+		report, err := service.GetAnnualReport(*year)
+		if err != nil {
+			log.Fatal(err)
+		}
+		path, err := pdfgen.GenerateAnnualReport(report, *year)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("Annual report generated:", path)
+		if report.LedgerHead != "" {
+			fmt.Println("Ledger head:", report.LedgerHead)
+		}
 	} else if *payoutId != "" {
 		payoutReport, donationDTOs, err := service.GetPayoutReport(*payoutId)
 		if err != nil {
@@ -53,6 +111,54 @@ func main() {
 			fmt.Println("Invoice generated:", path)
 		}
 	} else {
-		fmt.Println("No action specified. Use -monthly or -payout flags.")
+		fmt.Println("No action specified. Use -monthly, -quarter, -from/-to, -annual or -payout flags, or one of the commands:", commandNames())
+	}
+}
+
+// parsePeriod leaves a missing date zero, which RangePeriod rejects.
+func parsePeriod(from, to string) (service.Period, error) {
+	start, err := parseDay(from)
+	if err != nil {
+		return service.Period{}, fmt.Errorf("invalid -from: %w", err)
+	}
+	last, err := parseDay(to)
+	if err != nil {
+		return service.Period{}, fmt.Errorf("invalid -to: %w", err)
+	}
+	return service.RangePeriod(start, last)
+}
+
+// selectPeriod takes -from/-to, or else -quarter or -month of year, or else
+// the whole year.
+func selectPeriod(from, to string, year, quarter, month int) (service.Period, error) {
+	switch {
+	case from != "" || to != "":
+		return parsePeriod(from, to)
+	case quarter != 0:
+		return service.QuarterPeriod(year, quarter)
+	case month != 0:
+		if month < 1 || month > 12 {
+			return service.Period{}, fmt.Errorf("invalid month %d, expected 1 to 12", month)
+		}
+		return service.MonthPeriod(year, time.Month(month)), nil
+	}
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return service.RangePeriod(start, start.AddDate(1, 0, -1))
+}
+
+func dataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "data"
+}
+
+func openRepo() (repo.Store, error) {
+	cfg, err := repo.ConfigFromEnv(dataDir())
+	if err != nil {
+		return nil, err
 	}
+	// the CLI exits too soon to push on a schedule
+	cfg.GitPushInterval = 0
+	return repo.Open(cfg)
 }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Parse(args)
+
+	results, err := repo.NewCSVRepo(dataDir()).Migrate()
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Migrated() {
+			fmt.Printf("%s: migrated %d rows from v%d to v%d\n", r.File, r.Rows, r.From, r.To)
+		} else {
+			fmt.Printf("%s: already at v%d\n", r.File, r.To)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runQuarantine(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: quarantine list|show|annotate|approve [flags]")
+	}
+	fs := flag.NewFlagSet("quarantine "+args[0], flag.ExitOnError)
+	payoutId := fs.String("payout", "", "Quarantined payout ID")
+	operator := fs.String("operator", os.Getenv("USER"), "Operator name recorded with the note or approval")
+	note := fs.String("note", "", "Note text for annotate")
+	reason := fs.String("reason", "", "Override reason for approve")
+	acceptDiscrepancy := fs.Bool("accept-discrepancy", false, "Approve a payout whose charges do not add up to what Stripe paid, recording the difference")
+	rejected := fs.Bool("rejected", false, "List or show the payouts rejected by the donation policy instead")
+	fs.Parse(args[1:])
+
+	if args[0] != "list" && *payoutId == "" {
+		return errors.New("-payout is required")
+	}
+	dir := "quarantine"
+	if *rejected {
+		if args[0] != "list" && args[0] != "show" {
+			return errors.New("rejected payouts can only be listed and shown")
+		}
+		dir = "rejected"
+	}
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	policy, err := loadDonationPolicy()
+	if err != nil {
+		return err
+	}
+	s := &service.QuarantineService{
+		Quarantine: &repo.QuarantineRepo{Dir: filepath.Join(dataDir(), dir)},
+		Repo:       store,
+		Policy:     policy,
+	}
+
+	switch args[0] {
+	case "list":
+		quarantined, err := s.GetQuarantinedPayouts()
+		if err != nil {
+			return err
+		}
+		printQuarantinedPayouts(quarantined, *rejected)
+	case "show":
+		q, err := s.GetQuarantinedPayout(*payoutId)
+		if err != nil {
+			return err
+		}
+		printQuarantinedPayout(q, *rejected)
+	case "annotate":
+		if err := s.Annotate(*payoutId, *operator, *note); err != nil {
+			return err
+		}
+		fmt.Println("Note added to quarantined payout:", *payoutId)
+	case "approve":
+		payout, err := s.Approve(*payoutId, *operator, *reason, *acceptDiscrepancy)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Payout %s approved by %s (gross %s, fee %s, net %s)\n",
+			payout.Id, *operator, payout.Gross, payout.Fee, payout.Net)
+		if q, err := s.GetQuarantinedPayout(payout.Id); err == nil && q.Approval.Discrepancy != nil {
+			fmt.Printf("Recorded a discrepancy of %s with Stripe's payout\n", q.Approval.Discrepancy)
+		}
+	default:
+		return fmt.Errorf("unknown quarantine command: %s", args[0])
+	}
+	return nil
+}
+
+func printQuarantinedPayouts(quarantined []*model.QuarantinedPayout, rejected bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PAYOUT\tQUARANTINED\tERRORS\tNOTES\tSTATUS")
+	for _, q := range quarantined {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n",
+			q.PayoutId, q.Quarantined.Format(time.DateTime), len(q.Report), len(q.Notes), quarantineStatus(q, rejected))
+	}
+	w.Flush()
+}
+
+func printQuarantinedPayout(q *model.QuarantinedPayout, rejected bool) {
+	fmt.Println("Payout:     ", q.PayoutId)
+	fmt.Println("Quarantined:", q.Quarantined.Format(time.DateTime))
+	fmt.Println("Status:     ", quarantineStatus(q, rejected))
+
+	fmt.Println("\nValidation report:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TRANSACTION\tFIELD\tRULE")
+	for _, issue := range q.Report {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", issue.TransactionId, issue.Field, issue.Rule)
+	}
+	w.Flush()
+
+	fmt.Println("\nTransactions:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tCREATED\tAMOUNT\tFEE\tNET\tNAME\tEMAIL")
+	transactions := append([]*model.QuarantinedTransaction{q.Payout}, q.Charges...)
+	for _, t := range transactions {
+		if t == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", t.Id, t.Type,
+			time.Unix(t.Created, 0).UTC().Format(time.DateOnly), t.Amount, t.Fee, t.Net, t.ClientName, t.ClientEmail)
+	}
+	w.Flush()
+
+	if len(q.Notes) > 0 {
+		fmt.Println("\nNotes:")
+		for _, n := range q.Notes {
+			fmt.Printf("  [%s] %s: %s\n", n.Created.Format(time.DateTime), n.Author, n.Text)
+		}
+	}
+	if q.Approval != nil {
+		fmt.Printf("\nApproved by %s at %s: %s\n",
+			q.Approval.Operator, q.Approval.Approved.Format(time.DateTime), q.Approval.Reason)
+		if q.Approval.Discrepancy != nil {
+			fmt.Printf("Discrepancy with Stripe's payout: %s (left out: %s)\n",
+				q.Approval.Discrepancy, strings.Join(q.Approval.Excluded, ", "))
+		}
+	}
+}
+
+func quarantineStatus(q *model.QuarantinedPayout, rejected bool) string {
+	if rejected {
+		return "rejected"
+	}
+	if q.Approval != nil {
+		return "approved"
+	}
+	return "pending"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+)
+
+func runRotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	newKeyFile := fs.String("new-key-file", "", "File with the new base64 key; generated if it does not exist")
+	decrypt := fs.Bool("decrypt", false, "Store donor names and emails in plain text again")
+	fs.Parse(args)
+
+	if (*newKeyFile == "") == !*decrypt {
+		return errors.New("exactly one of -new-key-file or -decrypt is required")
+	}
+
+	current, err := repo.LoadPIICipher()
+	if err != nil {
+		return fmt.Errorf("current key: %w", err)
+	}
+	var next *repo.PIICipher
+	if *newKeyFile != "" {
+		if next, err = loadOrGenerateKey(*newKeyFile); err != nil {
+			return fmt.Errorf("new key: %w", err)
+		}
+	}
+
+	r := repo.NewCSVRepo(dataDir())
+	r.PII = current
+	rows, err := r.RotatePIIKey(next)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		fmt.Printf("Decrypted %d donations. Unset PII_KEY and PII_KEY_FILE.\n", rows)
+		return nil
+	}
+	fmt.Printf("Re-encrypted %d donations with key %s. Set PII_KEY_FILE=%s for the webhook and the CLI.\n", rows, next.Id(), *newKeyFile)
+	return nil
+}
+
+func loadOrGenerateKey(path string) (*repo.PIICipher, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := repo.GeneratePIIKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		fmt.Println("Generated a new key in", path)
+		return repo.ParsePIIKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.ParsePIIKey(string(data))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	id := fs.String("id", "", "Donation ID")
+	email := fs.String("email", "", "Donor email, case-insensitive")
+	payoutId := fs.String("payout", "", "Payout ID")
+	from := fs.String("from", "", "First day, YYYY-MM-DD")
+	to := fs.String("to", "", "Last day, YYYY-MM-DD")
+	minAmount := fs.Int("min", 0, "Minimum gross amount in bani")
+	maxAmount := fs.Int("max", 0, "Maximum gross amount in bani")
+	sortBy := fs.String("sort", "created", "Sort by created, amount, email or id")
+	desc := fs.Bool("desc", false, "Sort in descending order")
+	offset := fs.Int("offset", 0, "Number of results to skip")
+	limit := fs.Int("limit", service.DefaultSearchLimit, "Maximum number of results")
+	fs.Parse(args)
+
+	q := service.DonationQuery{
+		Id:        *id,
+		Email:     *email,
+		PayoutId:  *payoutId,
+		MinAmount: *minAmount,
+		MaxAmount: *maxAmount,
+		Sort:      service.DonationSort(*sortBy),
+		Desc:      *desc,
+		Offset:    *offset,
+		Limit:     *limit,
+	}
+	var err error
+	if q.From, err = parseDay(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if q.To, err = parseDay(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	page, err := (&service.SearchService{Repo: store}).SearchDonations(q)
+	if err != nil {
+		return err
+	}
+	if page.Total == 0 {
+		fmt.Println("No donations found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tNAME\tEMAIL\tPAYOUT\tGROSS\tFEE\tNET")
+	for _, d := range page.Donations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Id, d.Created.Format(time.DateOnly), d.ClientName, d.ClientEmail, d.PayoutId, d.Gross, d.Fee, d.Net)
+	}
+	w.Flush()
+	fmt.Printf("Showing %d of %d donations\n", len(page.Donations), page.Total)
+	return nil
+}
+
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
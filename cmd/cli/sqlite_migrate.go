@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/repo"
+)
+
+func runSQLiteMigrate(args []string) error {
+	fs := flag.NewFlagSet("sqlite-migrate", flag.ExitOnError)
+	dbPath := fs.String("db", repo.SQLitePath(dataDir()), "SQLite database to create or update")
+	decrypt := fs.Bool("decrypt", false, "Copy encrypted donor names and emails into the database in plain text")
+	fs.Parse(args)
+
+	pii, err := repo.LoadPIICipher()
+	if err != nil {
+		return err
+	}
+	if pii != nil && !*decrypt {
+		return errors.New("the SQLite backend stores donor names and emails in plain text, pass -decrypt to copy them decrypted")
+	}
+
+	db, err := repo.OpenSQLiteRepo(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	src := repo.NewCSVRepo(dataDir())
+	src.PII = pii
+	payouts, donations, err := repo.MigrateCSVToSQLite(src, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %d payouts and %d donations into %s\n", payouts, donations, *dbPath)
+	return nil
+}
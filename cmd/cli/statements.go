@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/diother/hintermann-stripe-cli/internal/pdfgen"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runStatements(args []string) error {
+	fs := flag.NewFlagSet("statements", flag.ExitOnError)
+	year := fs.Int("year", time.Now().Year()-1, "Year of the donations")
+	email := fs.String("email", "", "Write only this donor's statement")
+	out := fs.String("out", "", "Directory for the statements (default dist/statements/<year>)")
+	fs.Parse(args)
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	s := &service.ReportService{Repo: store}
+
+	dir := *out
+	if dir == "" {
+		dir = helper.DonorStatementDir(*year)
+	}
+	if *email != "" {
+		statement, err := s.GetDonorStatement(*year, *email)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, helper.DonorStatementName(statement.ClientEmail))
+		if err := pdfgen.WriteDonorStatement(statement, path); err != nil {
+			return err
+		}
+		fmt.Println("Statement generated:", path)
+		return nil
+	}
+
+	statements, err := s.GetDonorStatements(*year)
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return fmt.Errorf("no donations found in %d", *year)
+	}
+	for _, statement := range statements {
+		path := filepath.Join(dir, helper.DonorStatementName(statement.ClientEmail))
+		if err := pdfgen.WriteDonorStatement(statement, path); err != nil {
+			return fmt.Errorf("failed to write the statement of %s: %w", statement.ClientEmail, err)
+		}
+	}
+	fmt.Printf("Generated %d statements in %s\n", len(statements), dir)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/pdfgen"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	from := fs.String("from", "", "First day, YYYY-MM-DD, with -to")
+	to := fs.String("to", "", "Last day, YYYY-MM-DD")
+	year := fs.Int("year", time.Now().Year(), "Year, when no -from/-to is given")
+	quarter := fs.Int("quarter", 0, "Only this quarter 1-4 of -year")
+	month := fs.Int("month", 0, "Only this month 1-12 of -year")
+	currency := fs.String("currency", model.DefaultCurrency, "Currency of the donations")
+	top := fs.Int("top", 10, "Number of largest donations to list")
+	format := fs.String("format", "table", "Output as table, json or pdf")
+	out := fs.String("out", "", "Output file for json or pdf (default stdout for json, dist/stats for pdf)")
+	fs.Parse(args)
+
+	period, err := selectPeriod(*from, *to, *year, *quarter, *month)
+	if err != nil {
+		return err
+	}
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	stats, err := (&service.StatsService{Repo: store}).GetStats(period, *currency, *top)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "table":
+		printStats(stats)
+	case "json":
+		path := *out
+		if path == "" {
+			path = "-"
+		}
+		return writeJSON(path, stats)
+	case "pdf":
+		path := *out
+		if path == "" {
+			path = helper.StatsPath(stats.Start, stats.Last)
+		}
+		if err := pdfgen.WriteStats(stats.DTO(), path); err != nil {
+			return err
+		}
+		fmt.Println("Statistics generated:", path)
+	default:
+		return fmt.Errorf("invalid -format %q, expected table, json or pdf", *format)
+	}
+	return nil
+}
+
+func printStats(stats *service.DonationStats) {
+	money := func(amount int64) model.Money { return model.NewMoney(amount, stats.Currency) }
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Period\t%s - %s\n", stats.Start.Format(time.DateOnly), stats.Last.Format(time.DateOnly))
+	fmt.Fprintf(w, "Donations\t%d\n", stats.Count)
+	if stats.OtherCurrencies > 0 {
+		fmt.Fprintf(w, "Other currencies\t%d\n", stats.OtherCurrencies)
+	}
+	fmt.Fprintf(w, "Unique donors\t%d\n", stats.UniqueDonors)
+	fmt.Fprintf(w, "New donors\t%d\n", stats.NewDonors)
+	fmt.Fprintf(w, "Returning donors\t%d\n", stats.ReturningDonors)
+	fmt.Fprintf(w, "Anonymous donations\t%d\n", stats.AnonymousDonations)
+	fmt.Fprintf(w, "Total\t%s\n", money(stats.Total))
+	fmt.Fprintf(w, "Mean\t%s\n", money(stats.Mean))
+	fmt.Fprintf(w, "Median\t%s\n", money(stats.Median))
+	for _, p := range stats.Percentiles {
+		fmt.Fprintf(w, "P%d\t%s\n", p.Percent, money(p.Amount))
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FROM\tTO\tCOUNT")
+	for _, b := range stats.Histogram {
+		upper := "-"
+		if b.Max != 0 {
+			upper = money(b.Max).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", money(b.Min), upper, b.Count)
+	}
+	w.Flush()
+
+	if len(stats.Largest) == 0 {
+		return
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tNAME\tEMAIL\tGROSS")
+	for _, d := range stats.Largest {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.Id, d.Created.Format(time.DateOnly), d.ClientName, d.ClientEmail, d.Gross)
+	}
+	w.Flush()
+}
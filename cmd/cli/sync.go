@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	baseURL := fs.String("url", os.Getenv("SYNC_URL"), "Webhook server URL, e.g. https://webhook.hintermann.ro")
+	token := fs.String("token", os.Getenv("EXPORT_TOKEN"), "Export token configured on the server")
+	fs.Parse(args)
+
+	if *baseURL == "" || *token == "" {
+		return errors.New("-url and -token (or SYNC_URL and EXPORT_TOKEN) are required")
+	}
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	s := &service.SyncService{Repo: store}
+
+	cursorFile := filepath.Join(dataDir(), ".sync-cursor")
+	cursor, err := readCursor(cursorFile)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	var payouts, donors int
+	for {
+		batch, err := fetchExport(client, *baseURL, *token, cursor)
+		if errors.Is(err, errCursorRejected) {
+			return fmt.Errorf("%w: the server's ledger was restored or rewritten since the last sync. Check the local data, then remove %s to sync from the start", err, cursorFile)
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.Apply(batch); err != nil {
+			return fmt.Errorf("rejected batch after cursor %q: %w", cursor, err)
+		}
+		for _, c := range batch.Changes {
+			if c.Payout != nil {
+				payouts++
+			} else {
+				donors++
+			}
+		}
+		cursor = batch.Cursor
+		if err := os.WriteFile(cursorFile, []byte(cursor), 0644); err != nil {
+			return err
+		}
+		if !batch.More {
+			break
+		}
+	}
+	fmt.Printf("Synced %d payouts and %d donor changes, cursor is now %s\n", payouts, donors, cursor)
+	return nil
+}
+
+var errCursorRejected = errors.New("the server rejected the sync cursor")
+
+// readCursor returns the ledger entry synced last. Cursors of older versions
+// only counted payouts: they restart the sync, which skips stored payouts.
+func readCursor(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	cursor := strings.TrimSpace(string(data))
+	if _, err := strconv.Atoi(cursor); err == nil {
+		return "", nil
+	}
+	return cursor, nil
+}
+
+func fetchExport(client *http.Client, baseURL, token, cursor string) (*service.ExportBatch, error) {
+	u, err := url.JoinPath(baseURL, "export")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, u+"?cursor="+url.QueryEscape(cursor), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return nil, fmt.Errorf("%w %q", errCursorRejected, cursor)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("export request failed: %s", resp.Status)
+	}
+
+	batch := &service.ExportBatch{}
+	if err := json.NewDecoder(resp.Body).Decode(batch); err != nil {
+		return nil, fmt.Errorf("invalid export response: %w", err)
+	}
+	if (len(batch.Changes) > 0) == (batch.Cursor == cursor) {
+		return nil, fmt.Errorf("export cursor %q does not follow %q with %d changes", batch.Cursor, cursor, len(batch.Changes))
+	}
+	return batch, nil
+}
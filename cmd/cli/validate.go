@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+	"github.com/stripe/stripe-go/v79"
+)
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	payoutId := fs.String("payout", "", "Payout ID to fetch from Stripe and validate")
+	fs.Parse(args)
+
+	if *payoutId == "" {
+		return errors.New("-payout is required")
+	}
+	stripeKey := os.Getenv("STRIPE_SECRET")
+	if stripeKey == "" {
+		return errors.New("STRIPE_SECRET is missing")
+	}
+	stripe.Key = stripeKey
+
+	policy, err := loadDonationPolicy()
+	if err != nil {
+		return err
+	}
+	errs, err := service.ValidatePayout(*payoutId, policy)
+	if err != nil {
+		return err
+	}
+	if len(errs) == 0 {
+		fmt.Println("Payout is valid:", *payoutId)
+		return nil
+	}
+	fmt.Printf("Payout %s has %d validation errors:\n", *payoutId, len(errs))
+	printValidationErrors(errs)
+	os.Exit(1)
+	return nil
+}
+
+func printValidationErrors(errs service.ValidationErrors) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TRANSACTION\tFIELD\tRULE")
+	for _, e := range errs {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", e.TransactionId, e.Field, e.Rule)
+	}
+	w.Flush()
+}
+
+func loadDonationPolicy() (*service.DonationPolicy, error) {
+	path := os.Getenv("DONATION_POLICY")
+	if path == "" {
+		return service.DefaultDonationPolicy(), nil
+	}
+	return service.LoadDonationPolicy(path)
+}
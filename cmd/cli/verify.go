@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	jsonPath := fs.String("json", "", "Also write the report as JSON to this file, or - for stdout")
+	fs.Parse(args)
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := (&service.VerifyService{Repo: store}).Verify()
+	if err != nil {
+		return err
+	}
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, report); err != nil {
+			return err
+		}
+	}
+	if *jsonPath != "-" {
+		printVerifyReport(report)
+	}
+	if len(report.Issues) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func printVerifyReport(report *service.VerifyReport) {
+	if len(report.Issues) == 0 {
+		fmt.Printf("OK: %d payouts and %d donations verified\n", report.Payouts, report.Donations)
+		return
+	}
+	fmt.Printf("%d issues in %d payouts and %d donations:\n", len(report.Issues), report.Payouts, report.Donations)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tLINE\tID\tFIELD\tRULE")
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", issue.Source, issue.Line, issue.Id, issue.Field, issue.Rule)
+	}
+	w.Flush()
+}
+
+// writeJSON writes v indented to path, or to stdout when path is -.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func runVerifyChain(args []string) error {
+	fs := flag.NewFlagSet("verify-chain", flag.ExitOnError)
+	initLedger := fs.Bool("init", false, "Chain the rows stored before the ledger existed, or the donor entries an older ledger is missing")
+	fs.Parse(args)
+
+	store, err := openRepo()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if *initLedger {
+		n, err := store.InitLedger()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Appended %d ledger entries for existing rows\n", n)
+	}
+
+	report, err := (&service.LedgerService{Repo: store}).VerifyChain()
+	if err != nil {
+		return err
+	}
+	if b := report.Break; b != nil {
+		if b.Seq > 0 {
+			fmt.Printf("Chain broken at entry #%d (%s %s): %s\n", b.Seq, b.Kind, b.Id, b.Reason)
+		} else {
+			fmt.Printf("Chain broken at %s %s: %s\n", b.Kind, b.Id, b.Reason)
+		}
+		os.Exit(1)
+	}
+	if report.Head == nil {
+		fmt.Println("OK: the ledger is empty")
+		return nil
+	}
+	fmt.Printf("OK: %d entries, head #%d %s\n", report.Entries, report.Head.Seq, report.Head.Hash)
+	return nil
+}
@@ -23,16 +23,40 @@ func main() {
 	}
 	stripe.Key = stripeKey
 
-	repo := &repo.CSVRepo{
-		DonationsFile: filepath.Join(dataDir, "donations.csv"),
-		PayoutsFile:   filepath.Join(dataDir, "payouts.csv"),
+	repoConfig, err := repo.ConfigFromEnv(dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := repo.Open(repoConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+	if err := (&service.LedgerService{Repo: store}).CheckInitialized(); err != nil {
+		log.Fatal(err)
 	}
-	service := &service.WebhookService{Repo: repo}
-	handler := &handler.WebhookHandler{
-		Service:       service,
+
+	policy := service.DefaultDonationPolicy()
+	if policyPath := os.Getenv("DONATION_POLICY"); policyPath != "" {
+		if policy, err = service.LoadDonationPolicy(policyPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	quarantine := &repo.QuarantineRepo{Dir: filepath.Join(dataDir, "quarantine")}
+	rejected := &repo.QuarantineRepo{Dir: filepath.Join(dataDir, "rejected")}
+	webhookService := &service.WebhookService{Repo: store, Quarantine: quarantine, Rejected: rejected, Policy: policy}
+	http.Handle("/webhook", &handler.WebhookHandler{
+		Service:       webhookService,
 		WebhookSecret: webhookSecret,
+	})
+
+	if exportToken := os.Getenv("EXPORT_TOKEN"); exportToken != "" {
+		http.Handle("/export", &handler.ExportHandler{
+			Service: &service.ExportService{Repo: store},
+			Token:   exportToken,
+		})
 	}
-	http.Handle("/webhook", handler)
 
 	fmt.Println("listening on :8080")
 	if err := http.ListenAndServe(":8080", nil); err != nil {
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// MonthNames are the Romanian month names used in reports.
+var MonthNames = [...]string{"Ianuarie", "Februarie", "Martie", "Aprilie", "Mai", "Iunie",
+	"Iulie", "August", "Septembrie", "Octombrie", "Noiembrie", "Decembrie"}
+
+type MonthTotalsDTO struct {
+	Month     string
+	Payouts   string
+	Donations string
+	Gross     string
+	Fee       string
+	Net       string
+}
+
+type AnnualReportDTO struct {
+	Year       string
+	YearStart  string
+	YearEnd    string
+	Issued     string
+	Donations  string
+	Gross      string
+	Fee        string
+	Net        string
+	Months     []*MonthTotalsDTO
+	Payouts    []*PayoutDTO
+	LedgerHead string
+}
+
+func FromMonthTotals(month time.Month, payouts, donations int, gross, fee, net model.Money) *MonthTotalsDTO {
+	return &MonthTotalsDTO{
+		Month:     MonthNames[month-1],
+		Payouts:   strconv.Itoa(payouts),
+		Donations: strconv.Itoa(donations),
+		Gross:     gross.String(),
+		Fee:       fee.String(),
+		Net:       net.String(),
+	}
+}
+
+func FromAnnualTotals(year int, months []*MonthTotalsDTO, donations int, gross, fee, net model.Money, payoutDTOs []*PayoutDTO) *AnnualReportDTO {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, -1)
+	issued := start.AddDate(1, 0, 0)
+
+	return &AnnualReportDTO{
+		Year:      strconv.Itoa(year),
+		YearStart: start.Format(DateLayout),
+		YearEnd:   end.Format(DateLayout),
+		Issued:    issued.Format(DateLayout),
+		Donations: strconv.Itoa(donations),
+		Gross:     gross.String(),
+		Fee:       fee.String(),
+		Net:       net.String(),
+		Months:    months,
+		Payouts:   payoutDTOs,
+	}
+}
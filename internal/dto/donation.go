@@ -1,11 +1,6 @@
 package dto
 
-import (
-	"fmt"
-
-	"github.com/diother/hintermann-stripe-cli/internal/helper"
-	"github.com/diother/hintermann-stripe-cli/internal/model"
-)
+import "github.com/diother/hintermann-stripe-cli/internal/model"
 
 type DonationDTO struct {
 	Id          string
@@ -19,19 +14,15 @@ type DonationDTO struct {
 }
 
 func FromDonation(donation *model.Donation) *DonationDTO {
-	g := helper.MustAtoi(donation.Gross)
-	f := helper.MustAtoi(donation.Fee)
-	n := helper.MustAtoi(donation.Net)
-
 	return &DonationDTO{
 		Id:          donation.Id,
-		Created:     donation.Created,
+		Created:     donation.Created.Format(DateLayout),
 		ClientName:  donation.ClientName,
 		ClientEmail: donation.ClientEmail,
 		PayoutId:    donation.PayoutId,
-		Gross:       fmt.Sprintf("%.2f lei", float64(g)/100),
-		Fee:         fmt.Sprintf("%.2f lei", float64(f)/100),
-		Net:         fmt.Sprintf("%.2f lei", float64(n)/100),
+		Gross:       donation.Gross.String(),
+		Fee:         donation.Fee.String(),
+		Net:         donation.Net.String(),
 	}
 }
 
@@ -0,0 +1,38 @@
+package dto
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type DonorStatementDTO struct {
+	Year        string
+	Issued      string
+	ClientName  string
+	ClientEmail string
+	Count       string
+	Total       string
+	Donations   []*DonationDTO
+}
+
+// FromDonorDonations takes the donor's donations of the year, oldest first,
+// and their total in each currency. The statement is issued on the first
+// day of the next year.
+func FromDonorDonations(year int, name, email string, totals []model.Money, donations []*model.Donation) *DonorStatementDTO {
+	total := make([]string, len(totals))
+	for i, m := range totals {
+		total[i] = m.String()
+	}
+	return &DonorStatementDTO{
+		Year:        strconv.Itoa(year),
+		Issued:      time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC).Format(DateLayout),
+		ClientName:  name,
+		ClientEmail: email,
+		Count:       strconv.Itoa(len(donations)),
+		Total:       strings.Join(total, " + "),
+		Donations:   FromDonations(donations),
+	}
+}
@@ -1,11 +1,6 @@
 package dto
 
-import (
-	"fmt"
-
-	"github.com/diother/hintermann-stripe-cli/internal/helper"
-	"github.com/diother/hintermann-stripe-cli/internal/model"
-)
+import "github.com/diother/hintermann-stripe-cli/internal/model"
 
 type PayoutDTO struct {
 	Id      string
@@ -16,16 +11,12 @@ type PayoutDTO struct {
 }
 
 func FromPayout(payout *model.Payout) *PayoutDTO {
-	g := helper.MustAtoi(payout.Gross)
-	f := helper.MustAtoi(payout.Fee)
-	n := helper.MustAtoi(payout.Net)
-
 	return &PayoutDTO{
 		Id:      payout.Id,
-		Created: payout.Created,
-		Gross:   fmt.Sprintf("%.2f lei", float64(g)/100),
-		Fee:     fmt.Sprintf("%.2f lei", float64(f)/100),
-		Net:     fmt.Sprintf("%.2f lei", float64(n)/100),
+		Created: payout.Created.Format(DateLayout),
+		Gross:   payout.Gross.String(),
+		Fee:     payout.Fee.String(),
+		Net:     payout.Net.String(),
 	}
 }
 
@@ -0,0 +1,46 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// DateLayout is how dates are shown in reports and invoices.
+const DateLayout = "2 Jan 2006"
+
+// The kinds of period a report covers; the PDF heading depends on it.
+const (
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodRange   = "range"
+)
+
+type PeriodReportDTO struct {
+	Kind        string
+	PeriodStart string
+	PeriodEnd   string
+	Issued      string
+	Gross       string
+	Fee         string
+	Net         string
+	Payouts     []*PayoutDTO
+	// LedgerHead is the newest ledger entry when the report was made, e.g.
+	// "#42 3f9a...".
+	LedgerHead string
+}
+
+// FromPeriodTotalsAndPayoutDTOs takes the first and last day of the period
+// and the issue date.
+func FromPeriodTotalsAndPayoutDTOs(kind string, start, last, issued time.Time, gross, fee, net model.Money, payoutDTOs []*PayoutDTO) *PeriodReportDTO {
+	return &PeriodReportDTO{
+		Kind:        kind,
+		PeriodStart: start.Format(DateLayout),
+		PeriodEnd:   last.Format(DateLayout),
+		Issued:      issued.Format(DateLayout),
+		Gross:       gross.String(),
+		Fee:         fee.String(),
+		Net:         net.String(),
+		Payouts:     payoutDTOs,
+	}
+}
@@ -0,0 +1,82 @@
+package dto
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type PercentileDTO struct {
+	Label  string
+	Amount string
+}
+
+type HistogramBucketDTO struct {
+	Label string
+	Count string
+	// Share is the bucket's fraction of the donations, from 0 to 1.
+	Share float64
+}
+
+type StatsDTO struct {
+	PeriodStart     string
+	PeriodEnd       string
+	Issued          string
+	Count           string
+	OtherCurrencies string
+	UniqueDonors    string
+	NewDonors       string
+	ReturningDonors string
+	Anonymous       string
+	Total           string
+	Mean            string
+	Median          string
+	Percentiles     []*PercentileDTO
+	Histogram       []*HistogramBucketDTO
+	Largest         []*DonationDTO
+}
+
+func FromPercentile(percent int, amount model.Money) *PercentileDTO {
+	return &PercentileDTO{Label: fmt.Sprintf("P%d", percent), Amount: amount.String()}
+}
+
+// FromHistogramBucket labels the bucket from low up to high, or from low up
+// when open.
+func FromHistogramBucket(low, high model.Money, open bool, count, total int) *HistogramBucketDTO {
+	label := "sub " + high.String()
+	switch {
+	case open:
+		label = "peste " + low.String()
+	case !low.IsZero():
+		label = low.String() + " - " + high.String()
+	}
+	bucket := &HistogramBucketDTO{Label: label, Count: strconv.Itoa(count)}
+	if total > 0 {
+		bucket.Share = float64(count) / float64(total)
+	}
+	return bucket
+}
+
+// FromStats is issued on the day after the period.
+func FromStats(start, last time.Time, count, otherCurrencies, uniqueDonors, newDonors, returningDonors, anonymous int,
+	total, mean, median model.Money, percentiles []*PercentileDTO, histogram []*HistogramBucketDTO, largest []*model.Donation) *StatsDTO {
+	return &StatsDTO{
+		PeriodStart:     start.Format(DateLayout),
+		PeriodEnd:       last.Format(DateLayout),
+		Issued:          last.AddDate(0, 0, 1).Format(DateLayout),
+		Count:           strconv.Itoa(count),
+		OtherCurrencies: strconv.Itoa(otherCurrencies),
+		UniqueDonors:    strconv.Itoa(uniqueDonors),
+		NewDonors:       strconv.Itoa(newDonors),
+		ReturningDonors: strconv.Itoa(returningDonors),
+		Anonymous:       strconv.Itoa(anonymous),
+		Total:           total.String(),
+		Mean:            mean.String(),
+		Median:          median.String(),
+		Percentiles:     percentiles,
+		Histogram:       histogram,
+		Largest:         FromDonations(largest),
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+type ExportService interface {
+	Export(cursor string, limit int) (*service.ExportBatch, error)
+}
+
+type ExportHandler struct {
+	Service ExportService
+	Token   string
+}
+
+func (h *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || h.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		log.Println("unauthorized export request from", r.RemoteAddr)
+		return
+	}
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	batch, err := h.Service.Export(r.URL.Query().Get("cursor"), limit)
+	if errors.Is(err, service.ErrInvalidCursor) {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrCursorMismatch) {
+		http.Error(w, "cursor does not match the ledger", http.StatusConflict)
+		log.Println("export cursor rejected:", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "service error", http.StatusInternalServerError)
+		log.Println("export error:", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(batch); err != nil {
+		log.Println("failed to write export:", err)
+	}
+}
+
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 
+	"github.com/diother/hintermann-stripe-cli/internal/service"
 	"github.com/stripe/stripe-go/v79"
 	"github.com/stripe/stripe-go/v79/webhook"
 )
@@ -51,12 +53,43 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.Service.HandlePayoutReconciliation(payout); err != nil {
+	err = h.Service.HandlePayoutReconciliation(payout)
+	if errors.Is(err, service.ErrQuarantined) {
+		logServiceError(payout.ID, err)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("quarantined"))
+		return
+	}
+	if errors.Is(err, service.ErrRejected) {
+		logServiceError(payout.ID, err)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("rejected"))
+		return
+	}
+	if err != nil {
 		http.Error(w, "service error", http.StatusInternalServerError)
-		log.Println("service error:", err)
+		logServiceError(payout.ID, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 }
+
+func logServiceError(payoutId string, err error) {
+	var validationErrs service.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		log.Println("service error:", err)
+		return
+	}
+	if errors.Is(err, service.ErrQuarantined) {
+		log.Printf("payout %s quarantined with %d validation errors", payoutId, len(validationErrs))
+	} else if errors.Is(err, service.ErrRejected) {
+		log.Printf("payout %s rejected with %d validation errors", payoutId, len(validationErrs))
+	} else {
+		log.Printf("service error: payout %s has %d validation errors", payoutId, len(validationErrs))
+	}
+	for _, e := range validationErrs {
+		log.Printf("  transaction=%q field=%q rule=%q", e.TransactionId, e.Field, e.Rule)
+	}
+}
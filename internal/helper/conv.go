@@ -1,14 +0,0 @@
-package helper
-
-import (
-	"fmt"
-	"strconv"
-)
-
-func MustAtoi(s string) int {
-	n, err := strconv.Atoi(s)
-	if err != nil {
-		panic(fmt.Sprintf("bad int in CSV: %q", s))
-	}
-	return n
-}
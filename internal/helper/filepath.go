@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+	"unicode"
 )
 
 const distDir = "dist"
@@ -14,6 +16,26 @@ func MonthlyReportPath(year int, month time.Month) string {
 	return filepath.Join(distDir, "monthly_reports", filename)
 }
 
+func QuarterlyReportPath(year, quarter int) string {
+	filename := fmt.Sprintf("quarterly_report_%d_Q%d.pdf", year, quarter)
+	return filepath.Join(distDir, "quarterly_reports", filename)
+}
+
+func PeriodReportPath(start, last time.Time) string {
+	filename := fmt.Sprintf("report_%s_%s.pdf", start.Format(time.DateOnly), last.Format(time.DateOnly))
+	return filepath.Join(distDir, "reports", filename)
+}
+
+func AnnualReportPath(year int) string {
+	filename := fmt.Sprintf("annual_report_%d.pdf", year)
+	return filepath.Join(distDir, "annual_reports", filename)
+}
+
+func StatsPath(start, last time.Time) string {
+	filename := fmt.Sprintf("stats_%s_%s.pdf", start.Format(time.DateOnly), last.Format(time.DateOnly))
+	return filepath.Join(distDir, "stats", filename)
+}
+
 func PayoutReportDir(payoutId string) string {
 	return filepath.Join(distDir, "payout_reports", payoutId)
 }
@@ -27,6 +49,46 @@ func InvoicePath(payoutId, donationId string) string {
 		fmt.Sprintf("invoice_%s.pdf", donationId))
 }
 
+func SubjectExportDir(email string) string {
+	return filepath.Join(distDir, "gdpr", fileSafe(email))
+}
+
+func DonorStatementDir(year int) string {
+	return filepath.Join(distDir, "statements", fmt.Sprint(year))
+}
+
+// DonorStatementName is the statement's file name in any directory.
+func DonorStatementName(email string) string {
+	return fmt.Sprintf("statement_%s.pdf", fileSafe(email))
+}
+
+// DonorStatementPaths finds the donor's statements of every year in
+// dist/statements, comparing the email without case.
+func DonorStatementPaths(email string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(distDir, "statements", "*", "statement_*.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	name := DonorStatementName(email)
+	var found []string
+	for _, path := range paths {
+		if strings.EqualFold(filepath.Base(path), name) {
+			found = append(found, path)
+		}
+	}
+	return found, nil
+}
+
+// fileSafe keeps letters, digits, dots and dashes of an email.
+func fileSafe(email string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, email)
+}
+
 func EnsureDir(path string) error {
 	return os.MkdirAll(filepath.Dir(path), 0755)
 }
@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+const (
+	CorrectionClientName  = "client_name"
+	CorrectionClientEmail = "client_email"
+)
+
+// Correction changes one donor field of a stored donation. The row keeps
+// its original value and reads apply the corrections in order.
+type Correction struct {
+	DonationId string
+	Field      string
+	OldValue   string
+	NewValue   string
+	Operator   string
+	Reason     string
+	Created    time.Time
+}
+
+func (c *Correction) Apply(d *Donation) {
+	switch c.Field {
+	case CorrectionClientName:
+		d.ClientName = c.NewValue
+	case CorrectionClientEmail:
+		d.ClientEmail = c.NewValue
+	}
+}
+
+// ApplyCorrections applies corrections, oldest first, to the donations
+// they name.
+func ApplyCorrections(donations []*Donation, corrections []*Correction) {
+	if len(corrections) == 0 {
+		return
+	}
+	byId := make(map[string]*Donation, len(donations))
+	for _, d := range donations {
+		byId[d.Id] = d
+	}
+	for _, c := range corrections {
+		if d, ok := byId[c.DonationId]; ok {
+			c.Apply(d)
+		}
+	}
+}
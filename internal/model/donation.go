@@ -1,7 +1,6 @@
 package model
 
 import (
-	"strconv"
 	"time"
 
 	"github.com/stripe/stripe-go/v79"
@@ -9,25 +8,26 @@ import (
 
 type Donation struct {
 	Id          string
-	Created     string
+	Created     time.Time
 	ClientName  string
 	ClientEmail string
 	PayoutId    string
-	Gross       string
-	Fee         string
-	Net         string
+	Gross       Money
+	Fee         Money
+	Net         Money
+	Policy      string
 }
 
 func FromChargeTransactionAndPayoutId(charge *stripe.BalanceTransaction, payoutId string) *Donation {
 	return &Donation{
 		Id:          charge.ID,
-		Created:     time.Unix(charge.Created, 0).UTC().Format("2 Jan 2006"),
+		Created:     time.Unix(charge.Created, 0).UTC(),
 		ClientName:  charge.Source.Charge.BillingDetails.Name,
 		ClientEmail: charge.Source.Charge.BillingDetails.Email,
 		PayoutId:    payoutId,
-		Gross:       strconv.Itoa(int(charge.Amount)),
-		Fee:         strconv.Itoa(int(charge.Fee)),
-		Net:         strconv.Itoa(int(charge.Net)),
+		Gross:       moneyFromStripe(charge.Amount, charge.Currency),
+		Fee:         moneyFromStripe(charge.Fee, charge.Currency),
+		Net:         moneyFromStripe(charge.Net, charge.Currency),
 	}
 }
 
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stripe/stripe-go/v79"
+)
+
+// DefaultCurrency is assumed for amounts stored before currencies were
+// recorded, and for Stripe objects without one.
+const DefaultCurrency = "ron"
+
+// Money is an amount in the smallest unit of its currency, e.g. bani.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: normalizeCurrency(currency)}
+}
+
+func moneyFromStripe(amount int64, currency stripe.Currency) Money {
+	return NewMoney(amount, string(currency))
+}
+
+// ParseMoney parses an integer amount in minor units, as stored in the CSV
+// files.
+func ParseMoney(s, currency string) (Money, error) {
+	amount, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return NewMoney(amount, currency), nil
+}
+
+func normalizeCurrency(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return strings.ToLower(currency)
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}, nil
+}
+
+// Cmp returns -1, 0 or 1 like strings.Compare, and fails for different
+// currencies.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (m Money) Equal(o Money) bool {
+	return m.Currency == o.Currency && m.Amount == o.Amount
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return fmt.Errorf("currency mismatch: %s and %s", m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// MinorUnits is the amount as stored, without a currency.
+func (m Money) MinorUnits() string {
+	return strconv.FormatInt(m.Amount, 10)
+}
+
+// String formats the amount for reports, e.g. "1234.50 lei".
+func (m Money) String() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	symbol := strings.ToUpper(m.Currency)
+	if m.Currency == "ron" {
+		symbol = "lei"
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, symbol)
+}
+
+// SumMoney adds amounts of one currency. The sum of nothing is zero in
+// DefaultCurrency.
+func SumMoney(amounts ...Money) (Money, error) {
+	if len(amounts) == 0 {
+		return NewMoney(0, DefaultCurrency), nil
+	}
+	sum := amounts[0]
+	for _, m := range amounts[1:] {
+		var err error
+		if sum, err = sum.Add(m); err != nil {
+			return Money{}, err
+		}
+	}
+	return sum, nil
+}
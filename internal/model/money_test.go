@@ -0,0 +1,38 @@
+package model
+
+import "testing"
+
+func TestMoneyString(t *testing.T) {
+	testCases := map[string]struct {
+		input    Money
+		expected string
+	}{
+		"lei":      {input: NewMoney(123450, "RON"), expected: "1234.50 lei"},
+		"cents":    {input: NewMoney(5, "ron"), expected: "0.05 lei"},
+		"negative": {input: NewMoney(-250, ""), expected: "-2.50 lei"},
+		"euro":     {input: NewMoney(100, "eur"), expected: "1.00 EUR"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.input.String(); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	sum, err := SumMoney(NewMoney(100, "ron"), NewMoney(250, "ron"))
+	if err != nil || !sum.Equal(NewMoney(350, "ron")) {
+		t.Errorf("Expected 350 ron, got %v (%v)", sum, err)
+	}
+	if _, err := NewMoney(100, "ron").Add(NewMoney(100, "eur")); err == nil {
+		t.Errorf("Expected adding different currencies to fail")
+	}
+	if cmp, err := NewMoney(100, "ron").Cmp(NewMoney(50, "ron")); err != nil || cmp != 1 {
+		t.Errorf("Expected 100 > 50, got %d (%v)", cmp, err)
+	}
+	if _, err := ParseMoney("12.5", "ron"); err == nil {
+		t.Errorf("Expected a decimal to be rejected as minor units")
+	}
+}
@@ -1,7 +1,6 @@
 package model
 
 import (
-	"strconv"
 	"time"
 
 	"github.com/stripe/stripe-go/v79"
@@ -9,18 +8,18 @@ import (
 
 type Payout struct {
 	Id      string
-	Created string
-	Gross   string
-	Fee     string
-	Net     string
+	Created time.Time
+	Gross   Money
+	Fee     Money
+	Net     Money
 }
 
-func FromStripePayoutAndTotals(payout *stripe.Payout, gross, fee, net int) *Payout {
+func FromStripePayoutAndTotals(payout *stripe.Payout, gross, fee, net Money) *Payout {
 	return &Payout{
 		Id:      payout.ID,
-		Created: time.Unix(payout.Created, 0).UTC().Format("2 Jan 2006"),
-		Gross:   strconv.Itoa(gross),
-		Fee:     strconv.Itoa(fee),
-		Net:     strconv.Itoa(net),
+		Created: time.Unix(payout.Created, 0).UTC(),
+		Gross:   gross,
+		Fee:     fee,
+		Net:     net,
 	}
 }
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"time"
+
+	"github.com/stripe/stripe-go/v79"
+)
+
+type QuarantinedPayout struct {
+	PayoutId      string
+	PayoutCreated int64
+	Quarantined   time.Time
+	Payout        *QuarantinedTransaction
+	Charges       []*QuarantinedTransaction
+	Report        []*ValidationIssue
+	Notes         []*QuarantineNote
+	Approval      *QuarantineApproval
+}
+
+type QuarantinedTransaction struct {
+	Id          string
+	Type        string
+	Created     int64
+	Amount      int64
+	Fee         int64
+	Net         int64
+	Currency    string `json:",omitempty"`
+	ClientName  string
+	ClientEmail string
+	// PaymentType and Wallet keep the payment method, so the donation
+	// policy can be applied again on approval.
+	PaymentType string `json:",omitempty"`
+	Wallet      string `json:",omitempty"`
+}
+
+type ValidationIssue struct {
+	TransactionId string
+	Field         string
+	Rule          string
+}
+
+type QuarantineNote struct {
+	Author  string
+	Created time.Time
+	Text    string
+}
+
+// QuarantineApproval records the operator override. Discrepancy is what
+// Stripe paid minus the charges' net, when the operator accepted a payout
+// whose Excluded transactions, e.g. refunds, explain the difference.
+type QuarantineApproval struct {
+	Operator    string
+	Approved    time.Time
+	Reason      string
+	Discrepancy *Money   `json:",omitempty"`
+	Excluded    []string `json:",omitempty"`
+}
+
+func FromQuarantinedStripeData(payout *stripe.Payout, payoutTransaction *stripe.BalanceTransaction, charges []*stripe.BalanceTransaction) *QuarantinedPayout {
+	quarantined := &QuarantinedPayout{
+		PayoutId:      payout.ID,
+		PayoutCreated: payout.Created,
+		Quarantined:   time.Now().UTC(),
+		Payout:        FromBalanceTransaction(payoutTransaction),
+	}
+	for _, charge := range charges {
+		if charge == nil {
+			continue
+		}
+		quarantined.Charges = append(quarantined.Charges, FromBalanceTransaction(charge))
+	}
+	return quarantined
+}
+
+func FromBalanceTransaction(t *stripe.BalanceTransaction) *QuarantinedTransaction {
+	if t == nil {
+		return nil
+	}
+	quarantined := &QuarantinedTransaction{
+		Id:       t.ID,
+		Type:     string(t.Type),
+		Created:  t.Created,
+		Amount:   t.Amount,
+		Fee:      t.Fee,
+		Net:      t.Net,
+		Currency: string(t.Currency),
+	}
+	if t.Source != nil && t.Source.Charge != nil && t.Source.Charge.BillingDetails != nil {
+		quarantined.ClientName = t.Source.Charge.BillingDetails.Name
+		quarantined.ClientEmail = t.Source.Charge.BillingDetails.Email
+	}
+	if t.Source != nil && t.Source.Charge != nil && t.Source.Charge.PaymentMethodDetails != nil {
+		details := t.Source.Charge.PaymentMethodDetails
+		quarantined.PaymentType = string(details.Type)
+		if details.Card != nil && details.Card.Wallet != nil {
+			quarantined.Wallet = string(details.Card.Wallet.Type)
+		}
+	}
+	return quarantined
+}
+
+func (q *QuarantinedPayout) StripePayout() *stripe.Payout {
+	return &stripe.Payout{
+		ID:                   q.PayoutId,
+		Created:              q.PayoutCreated,
+		ReconciliationStatus: stripe.PayoutReconciliationStatusCompleted,
+	}
+}
+
+func (t *QuarantinedTransaction) BalanceTransaction() *stripe.BalanceTransaction {
+	if t == nil {
+		return nil
+	}
+	charge := &stripe.Charge{
+		BillingDetails: &stripe.ChargeBillingDetails{
+			Name:  t.ClientName,
+			Email: t.ClientEmail,
+		},
+	}
+	if t.PaymentType != "" {
+		charge.PaymentMethodDetails = &stripe.ChargePaymentMethodDetails{Type: stripe.ChargePaymentMethodDetailsType(t.PaymentType)}
+		if t.Wallet != "" {
+			charge.PaymentMethodDetails.Card = &stripe.ChargePaymentMethodDetailsCard{
+				Wallet: &stripe.ChargePaymentMethodDetailsCardWallet{Type: stripe.PaymentMethodCardWalletType(t.Wallet)},
+			}
+		}
+	}
+	return &stripe.BalanceTransaction{
+		ID:       t.Id,
+		Type:     stripe.BalanceTransactionType(t.Type),
+		Created:  t.Created,
+		Amount:   t.Amount,
+		Fee:      t.Fee,
+		Net:      t.Net,
+		Currency: stripe.Currency(t.Currency),
+		Source:   &stripe.BalanceTransactionSource{Charge: charge},
+	}
+}
+
+func (q *QuarantinedPayout) ChargeTransactions() []*stripe.BalanceTransaction {
+	charges := make([]*stripe.BalanceTransaction, len(q.Charges))
+	for i, c := range q.Charges {
+		charges[i] = c.BalanceTransaction()
+	}
+	return charges
+}
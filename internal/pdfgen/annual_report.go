@@ -0,0 +1,146 @@
+package pdfgen
+
+import (
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/signintech/gopdf"
+)
+
+const (
+	annualReportTitle = "Raport anual"
+	monthRowHeight    = 30
+)
+
+func GenerateAnnualReport(annualReport *dto.AnnualReportDTO, year int) (string, error) {
+	pdf, err := renderAnnualReport(annualReport)
+	if err != nil {
+		return "", err
+	}
+
+	path := helper.AnnualReportPath(year)
+	if err := helper.EnsureDir(path); err != nil {
+		return "", err
+	}
+	return path, pdf.WritePdf(path)
+}
+
+// renderAnnualReport puts the summary and the month table on the first page
+// and lists the payouts on the following pages.
+func renderAnnualReport(annualReport *dto.AnnualReportDTO) (pdf *gopdf.GoPdf, err error) {
+	payouts := annualReport.Payouts
+
+	pdf = &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	pdf.AddPage()
+
+	if err = setFonts(pdf); err != nil {
+		return nil, fmt.Errorf("failed setting fonts: %w", err)
+	}
+	resetTextStyles(pdf)
+
+	pagesNeeded := 1 + (len(payouts)+subsequentPageCapacity-1)/subsequentPageCapacity
+	currentPage := 1
+
+	if err = addMonthlyReportHeader(pdf, annualReportTitle, annualReport.Issued); err != nil {
+		return nil, fmt.Errorf("failed adding the header: %w", err)
+	}
+	if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded, annualReport.LedgerHead); err != nil {
+		return nil, fmt.Errorf("failed adding the footer: %w", err)
+	}
+
+	addAnnualSummary(pdf, annualReport)
+	addAnnualMonthTable(pdf, firstPageTableY)
+
+	currentY := firstPageStartY
+	for _, month := range annualReport.Months {
+		addAnnualMonthRow(pdf, month, currentY)
+		currentY += monthRowHeight
+	}
+	addAnnualTotalRow(pdf, annualReport, currentY)
+
+	for i, payout := range payouts {
+		if i%subsequentPageCapacity == 0 {
+			pdf.AddPage()
+			currentPage++
+
+			if err = addMonthlyReportSecondaryHeader(pdf, annualReportTitle); err != nil {
+				return nil, fmt.Errorf("failed adding the secondary header: %w", err)
+			}
+			if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded, annualReport.LedgerHead); err != nil {
+				return nil, fmt.Errorf("failed adding the footer: %w", err)
+			}
+
+			addMonthlyPayoutTable(pdf, subsequentPageTableY)
+			currentY = subsequentPageStartY
+		}
+		addMonthlyPayoutProduct(pdf, payout, currentY)
+		currentY += itemHeight
+	}
+	return
+}
+
+func addAnnualSummary(pdf *gopdf.GoPdf, annualReport *dto.AnnualReportDTO) {
+	const startY = 211
+
+	setText(pdf, marginLeft, startY+26, annualReport.YearStart+" - "+annualReport.YearEnd)
+	setText(pdf, marginLeft, startY+42, "Donații: "+annualReport.Donations)
+
+	setText(pdf, 312, startY+10, "Preț brut:")
+	setText(pdf, 312, startY+26, "Taxe Stripe:")
+
+	setRightAlignedText(pdf, marginRight, startY+10, annualReport.Gross)
+	setRightAlignedText(pdf, marginRight, startY+26, "-"+annualReport.Fee)
+
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY+10, "Periodă raport:")
+
+	pdf.SetFont("Roboto-Bold", "", 10)
+	setText(pdf, 312, startY+42, "Total:")
+	setRightAlignedText(pdf, marginRight, startY+42, annualReport.Net)
+
+	resetTextStyles(pdf)
+
+	pdf.Line(marginLeft, startY-.5, marginRight, startY-.5)
+	pdf.Line(marginLeft, startY+63.5, marginRight, startY+63.5)
+	pdf.Line(297.5, startY-.5, 298.5, startY+63.5)
+}
+
+func addAnnualMonthTable(pdf *gopdf.GoPdf, startY float64) {
+	setText(pdf, marginLeft, startY, "Lună")
+	setRightAlignedText(pdf, 190, startY, "Plăți")
+	setRightAlignedText(pdf, 260, startY, "Donații")
+	setText(pdf, 328, startY, "Preț brut")
+	setText(pdf, 424.5, startY, "Taxă Stripe")
+	setText(pdf, 532, startY, "Total")
+
+	pdf.Line(marginLeft, startY+21.5, marginRight, startY+21.5)
+}
+
+func addAnnualMonthRow(pdf *gopdf.GoPdf, month *dto.MonthTotalsDTO, startY float64) {
+	setRightAlignedText(pdf, 190, startY, month.Payouts)
+	setRightAlignedText(pdf, 260, startY, month.Donations)
+	setRightAlignedText(pdf, 367, startY, month.Gross)
+	setRightAlignedText(pdf, 474, startY, "-"+month.Fee)
+	setRightAlignedText(pdf, marginRight, startY, month.Net)
+
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY, month.Month)
+	pdf.SetTextColor(94, 100, 112)
+}
+
+func addAnnualTotalRow(pdf *gopdf.GoPdf, annualReport *dto.AnnualReportDTO, startY float64) {
+	pdf.Line(marginLeft, startY-8.5, marginRight, startY-8.5)
+
+	pdf.SetFont("Roboto-Bold", "", 10)
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY, "Total "+annualReport.Year)
+	setRightAlignedText(pdf, 190, startY, fmt.Sprint(len(annualReport.Payouts)))
+	setRightAlignedText(pdf, 260, startY, annualReport.Donations)
+	setRightAlignedText(pdf, 367, startY, annualReport.Gross)
+	setRightAlignedText(pdf, 474, startY, "-"+annualReport.Fee)
+	setRightAlignedText(pdf, marginRight, startY, annualReport.Net)
+
+	resetTextStyles(pdf)
+}
@@ -0,0 +1,197 @@
+package pdfgen
+
+import (
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/signintech/gopdf"
+)
+
+const (
+	statementTitle             = "Situație anuală"
+	statementRowHeight         = 24
+	statementFirstPageStartY   = 237.0
+	statementFirstPageCapacity = 20
+	statementNextPageStartY    = 135.0
+	statementNextPageCapacity  = 25
+	// the summary takes the space of this many rows
+	statementSummaryRows = 4
+)
+
+func WriteDonorStatement(statement *dto.DonorStatementDTO, path string) error {
+	pdf, err := renderDonorStatement(statement)
+	if err != nil {
+		return err
+	}
+	if err := helper.EnsureDir(path); err != nil {
+		return err
+	}
+	return pdf.WritePdf(path)
+}
+
+func renderDonorStatement(statement *dto.DonorStatementDTO) (pdf *gopdf.GoPdf, err error) {
+	pdf = &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	pdf.AddPage()
+
+	if err = setFonts(pdf); err != nil {
+		return nil, fmt.Errorf("failed setting fonts: %w", err)
+	}
+	resetTextStyles(pdf)
+
+	pagesNeeded := statementPages(len(statement.Donations))
+	currentPage := 1
+
+	if err = addStatementHeader(pdf, statement); err != nil {
+		return nil, fmt.Errorf("failed adding header: %w", err)
+	}
+	if err = addStatementFooter(pdf, currentPage, pagesNeeded); err != nil {
+		return nil, fmt.Errorf("failed adding footer: %w", err)
+	}
+	addStatementTable(pdf, 195)
+
+	newPage := func() error {
+		pdf.AddPage()
+		currentPage++
+		if err := addStatementSecondaryHeader(pdf); err != nil {
+			return fmt.Errorf("failed adding the secondary header: %w", err)
+		}
+		if err := addStatementFooter(pdf, currentPage, pagesNeeded); err != nil {
+			return fmt.Errorf("failed adding footer: %w", err)
+		}
+		return nil
+	}
+
+	currentY := statementFirstPageStartY
+	free := statementFirstPageCapacity
+	for _, donation := range statement.Donations {
+		if free == 0 {
+			if err = newPage(); err != nil {
+				return nil, err
+			}
+			addStatementTable(pdf, subsequentPageTableY)
+			currentY, free = statementNextPageStartY, statementNextPageCapacity
+		}
+		addStatementRow(pdf, donation, currentY)
+		currentY += statementRowHeight
+		free--
+	}
+	if free < statementSummaryRows {
+		if err = newPage(); err != nil {
+			return nil, err
+		}
+		currentY = statementNextPageStartY
+	}
+	addStatementSummary(pdf, statement, currentY)
+	return
+}
+
+// statementPages follows the pagination of renderDonorStatement.
+func statementPages(rows int) int {
+	pages, free := 1, statementFirstPageCapacity
+	for range rows {
+		if free == 0 {
+			pages++
+			free = statementNextPageCapacity
+		}
+		free--
+	}
+	if free < statementSummaryRows {
+		pages++
+	}
+	return pages
+}
+
+func addStatementHeader(pdf *gopdf.GoPdf, statement *dto.DonorStatementDTO) error {
+	const startY = marginTop
+
+	if err := addImage(pdf, "./static/pdf/hintermann-logo.png", marginLeft, marginTop, 167, 17); err != nil {
+		return err
+	}
+	setText(pdf, marginLeft, startY+31, "Asociația de Caritate Hintermann")
+	setText(pdf, marginLeft, startY+47, "Strada Spicului, Nr. 12")
+	setText(pdf, marginLeft, startY+63, "Bl. 40, Sc. A, Ap. 12")
+	setText(pdf, marginLeft, startY+79, "500460")
+	setText(pdf, marginLeft, startY+95, "Brașov")
+	setText(pdf, marginLeft, startY+111, "România")
+
+	setText(pdf, 312, startY+31, "Anul:")
+	setRightAlignedText(pdf, marginRight, startY+31, statement.Year)
+	setText(pdf, 312, startY+47, "Data emiterii:")
+	setRightAlignedText(pdf, marginRight, startY+47, statement.Issued)
+	setText(pdf, 312, startY+63, "Nume donator:")
+	setRightAlignedText(pdf, marginRight, startY+63, statement.ClientName)
+	setText(pdf, 312, startY+79, "Email donator:")
+	setRightAlignedText(pdf, marginRight, startY+79, statement.ClientEmail)
+
+	pdf.SetFont("Roboto-Bold", "", 18)
+	pdf.SetTextColor(0, 0, 0)
+	setRightAlignedText(pdf, marginRight, startY, statementTitle)
+
+	resetTextStyles(pdf)
+	return nil
+}
+
+func addStatementSecondaryHeader(pdf *gopdf.GoPdf) error {
+	const startY = marginTop
+
+	if err := addImage(pdf, "./static/pdf/hintermann-logo.png", marginLeft, marginTop, 167, 17); err != nil {
+		return err
+	}
+	pdf.SetFont("Roboto-Bold", "", 18)
+	pdf.SetTextColor(0, 0, 0)
+	setRightAlignedText(pdf, marginRight, startY, statementTitle)
+
+	resetTextStyles(pdf)
+	return nil
+}
+
+func addStatementFooter(pdf *gopdf.GoPdf, currentPage, pagesNeeded int) error {
+	const endY = marginBottom
+
+	if err := addImage(pdf, "./static/pdf/hintermann-logo-small.png", marginLeft, 796, 138, 14); err != nil {
+		return fmt.Errorf("failed setting image: %w", err)
+	}
+	setRightAlignedText(pdf, 452, endY-14, "contact@hintermann.ro")
+	setText(pdf, 492, endY-14, fmt.Sprintf("Pagina %d din %d", currentPage, pagesNeeded))
+
+	pdf.Line(marginLeft, endY-36.5, marginRight, endY-36.5)
+	pdf.Line(471.5, endY-16, 471.5, endY-4)
+	return nil
+}
+
+func addStatementTable(pdf *gopdf.GoPdf, startY float64) {
+	setText(pdf, marginLeft, startY, "Data")
+	setText(pdf, 150, startY, "ID tranzacție")
+	setText(pdf, 532, startY, "Sumă")
+
+	pdf.Line(marginLeft, startY+21.5, marginRight, startY+21.5)
+}
+
+func addStatementRow(pdf *gopdf.GoPdf, donation *dto.DonationDTO, startY float64) {
+	setText(pdf, 150, startY, donation.Id)
+	setRightAlignedText(pdf, marginRight, startY, donation.Gross)
+
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY, donation.Created)
+	pdf.SetTextColor(94, 100, 112)
+}
+
+func addStatementSummary(pdf *gopdf.GoPdf, statement *dto.DonorStatementDTO, startY float64) {
+	setText(pdf, marginLeft, startY+10, "Vă mulțumim pentru sprijinul acordat")
+	setText(pdf, marginLeft, startY+23, "familiilor românești aflate în mare nevoie.")
+
+	setText(pdf, 312, startY+10, "Număr donații:")
+	setRightAlignedText(pdf, marginRight, startY+10, statement.Count)
+
+	pdf.SetFont("Roboto-Bold", "", 10)
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, 312, startY+42, "Total donat în "+statement.Year+":")
+	setRightAlignedText(pdf, marginRight, startY+42, statement.Total)
+
+	pdf.Line(marginLeft, startY, marginRight, startY)
+	pdf.Line(312, startY+31.5, marginRight, startY+31.5)
+
+	resetTextStyles(pdf)
+}
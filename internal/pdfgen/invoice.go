@@ -9,16 +9,20 @@ import (
 )
 
 func GenerateInvoice(donation *dto.DonationDTO) (string, error) {
+	path := helper.InvoicePath(donation.PayoutId, donation.Id)
+	return path, WriteInvoice(donation, path)
+}
+
+// WriteInvoice renders the invoice to path instead of the dist directory.
+func WriteInvoice(donation *dto.DonationDTO, path string) error {
 	pdf, err := renderInvoice(donation)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	path := helper.InvoicePath(donation.PayoutId, donation.Id)
 	if err := helper.EnsureDir(path); err != nil {
-		return "", err
+		return err
 	}
-	return path, pdf.WritePdf(path)
+	return pdf.WritePdf(path)
 }
 
 func renderInvoice(donation *dto.DonationDTO) (pdf *gopdf.GoPdf, err error) {
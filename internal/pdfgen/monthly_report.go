@@ -9,21 +9,36 @@ import (
 	"github.com/signintech/gopdf"
 )
 
-func GenerateMonthlyReport(monthlyReport *dto.MonthlyReportDTO, year int, month time.Month) (string, error) {
-	pdf, err := renderMonthlyReport(monthlyReport)
+func GenerateMonthlyReport(report *dto.PeriodReportDTO, year int, month time.Month) (string, error) {
+	path := helper.MonthlyReportPath(year, month)
+	return path, writePeriodReport(report, path)
+}
+
+func GenerateQuarterlyReport(report *dto.PeriodReportDTO, year, quarter int) (string, error) {
+	path := helper.QuarterlyReportPath(year, quarter)
+	return path, writePeriodReport(report, path)
+}
+
+// GeneratePeriodReport names the file after the first and last day.
+func GeneratePeriodReport(report *dto.PeriodReportDTO, start, last time.Time) (string, error) {
+	path := helper.PeriodReportPath(start, last)
+	return path, writePeriodReport(report, path)
+}
+
+func writePeriodReport(report *dto.PeriodReportDTO, path string) error {
+	pdf, err := renderPeriodReport(report)
 	if err != nil {
-		return "", err
+		return err
 	}
-
-	path := helper.MonthlyReportPath(year, month)
 	if err := helper.EnsureDir(path); err != nil {
-		return "", err
+		return err
 	}
-	return path, pdf.WritePdf(path)
+	return pdf.WritePdf(path)
 }
 
-func renderMonthlyReport(monthlyReport *dto.MonthlyReportDTO) (pdf *gopdf.GoPdf, err error) {
-	payouts := monthlyReport.Payouts
+func renderPeriodReport(report *dto.PeriodReportDTO) (pdf *gopdf.GoPdf, err error) {
+	payouts := report.Payouts
+	title := periodReportTitles[report.Kind]
 
 	pdf = &gopdf.GoPdf{}
 	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
@@ -42,14 +57,14 @@ func renderMonthlyReport(monthlyReport *dto.MonthlyReportDTO) (pdf *gopdf.GoPdf,
 	pagesNeeded := pagesNeeded(itemsLength)
 	currentPage := 1
 
-	if err = addMonthlyReportHeader(pdf, monthlyReport.Issued); err != nil {
+	if err = addMonthlyReportHeader(pdf, title, report.Issued); err != nil {
 		return nil, fmt.Errorf("failed adding the header: %w", err)
 	}
-	if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded); err != nil {
+	if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded, report.LedgerHead); err != nil {
 		return nil, fmt.Errorf("failed adding the footer: %w", err)
 	}
 
-	addMonthlyPayoutSummary(pdf, monthlyReport)
+	addMonthlyPayoutSummary(pdf, report)
 	addMonthlyPayoutTable(pdf, firstPageTableY)
 
 	currentY := firstPageStartY
@@ -61,10 +76,10 @@ func renderMonthlyReport(monthlyReport *dto.MonthlyReportDTO) (pdf *gopdf.GoPdf,
 			pdf.AddPage()
 			currentPage++
 
-			if err = addMonthlyReportSecondaryHeader(pdf); err != nil {
+			if err = addMonthlyReportSecondaryHeader(pdf, title); err != nil {
 				return nil, fmt.Errorf("failed adding the secondary header: %w", err)
 			}
-			if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded); err != nil {
+			if err = addMonthlyReportFooter(pdf, currentPage, pagesNeeded, report.LedgerHead); err != nil {
 				return nil, fmt.Errorf("failed adding the footer: %w", err)
 			}
 
@@ -81,7 +96,13 @@ func renderMonthlyReport(monthlyReport *dto.MonthlyReportDTO) (pdf *gopdf.GoPdf,
 	return
 }
 
-func addMonthlyReportHeader(pdf *gopdf.GoPdf, created string) error {
+var periodReportTitles = map[string]string{
+	dto.PeriodMonth:   "Extras lunar",
+	dto.PeriodQuarter: "Extras trimestrial",
+	dto.PeriodRange:   "Extras pe perioadă",
+}
+
+func addMonthlyReportHeader(pdf *gopdf.GoPdf, title, created string) error {
 	const startY = marginTop
 
 	if err := addImage(pdf, "./static/pdf/stripe-logo.png", marginLeft, startY, 51, 21); err != nil {
@@ -108,13 +129,13 @@ func addMonthlyReportHeader(pdf *gopdf.GoPdf, created string) error {
 
 	pdf.SetFont("Roboto-Bold", "", 18)
 	pdf.SetTextColor(0, 0, 0)
-	setRightAlignedText(pdf, marginRight, startY, "Extras lunar")
+	setRightAlignedText(pdf, marginRight, startY, title)
 
 	resetTextStyles(pdf)
 	return nil
 }
 
-func addMonthlyReportSecondaryHeader(pdf *gopdf.GoPdf) error {
+func addMonthlyReportSecondaryHeader(pdf *gopdf.GoPdf, title string) error {
 	const startY = marginTop
 
 	if err := addImage(pdf, "./static/pdf/stripe-logo.png", marginLeft, startY, 51, 21); err != nil {
@@ -122,13 +143,13 @@ func addMonthlyReportSecondaryHeader(pdf *gopdf.GoPdf) error {
 	}
 	pdf.SetFont("Roboto-Bold", "", 18)
 	pdf.SetTextColor(0, 0, 0)
-	setRightAlignedText(pdf, marginRight, startY, "Extras lunar")
+	setRightAlignedText(pdf, marginRight, startY, title)
 
 	resetTextStyles(pdf)
 	return nil
 }
 
-func addMonthlyReportFooter(pdf *gopdf.GoPdf, currentPage, pagesNeeded int) error {
+func addMonthlyReportFooter(pdf *gopdf.GoPdf, currentPage, pagesNeeded int, ledgerHead string) error {
 	const endY = marginBottom
 
 	if err := addImage(pdf, "./static/pdf/stripe-logo-small.png", marginLeft, endY-17, 41, 17); err != nil {
@@ -137,27 +158,33 @@ func addMonthlyReportFooter(pdf *gopdf.GoPdf, currentPage, pagesNeeded int) erro
 	pageInfo := fmt.Sprintf("Pagina %d din %d", currentPage, pagesNeeded)
 	setText(pdf, 492, endY-15.5, pageInfo)
 
+	if ledgerHead != "" {
+		pdf.SetFont("Roboto", "", 7)
+		setText(pdf, 100, endY-13.5, "Registru "+ledgerHead)
+		resetTextStyles(pdf)
+	}
+
 	pdf.Line(marginLeft, endY-37, marginRight, endY-37)
 	return nil
 }
 
-func addMonthlyPayoutSummary(pdf *gopdf.GoPdf, monthlyReport *dto.MonthlyReportDTO) {
+func addMonthlyPayoutSummary(pdf *gopdf.GoPdf, report *dto.PeriodReportDTO) {
 	const startY = 211
 
-	setText(pdf, marginLeft, startY+26, monthlyReport.MonthStart+" - "+monthlyReport.MonthEnd)
+	setText(pdf, marginLeft, startY+26, report.PeriodStart+" - "+report.PeriodEnd)
 
 	setText(pdf, 312, startY+10, "Preț brut:")
 	setText(pdf, 312, startY+26, "Taxe Stripe:")
 
-	setRightAlignedText(pdf, marginRight, startY+10, monthlyReport.Gross)
-	setRightAlignedText(pdf, marginRight, startY+26, "-"+monthlyReport.Fee)
+	setRightAlignedText(pdf, marginRight, startY+10, report.Gross)
+	setRightAlignedText(pdf, marginRight, startY+26, "-"+report.Fee)
 
 	pdf.SetTextColor(0, 0, 0)
 	setText(pdf, marginLeft, startY+10, "Periodă extras:")
 
 	pdf.SetFont("Roboto-Bold", "", 10)
 	setText(pdf, 312, startY+42, "Total:")
-	setRightAlignedText(pdf, marginRight, startY+42, monthlyReport.Net)
+	setRightAlignedText(pdf, marginRight, startY+42, report.Net)
 
 	resetTextStyles(pdf)
 
@@ -0,0 +1,152 @@
+package pdfgen
+
+import (
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/helper"
+	"github.com/signintech/gopdf"
+)
+
+const (
+	statsTitle     = "Statistici donații"
+	statsRowHeight = 24
+	statsBarX      = 190.0
+	statsBarWidth  = 290.0
+	// only this many of the largest donations fit on the page
+	statsLargestRows = 10
+)
+
+func WriteStats(stats *dto.StatsDTO, path string) error {
+	pdf, err := renderStats(stats)
+	if err != nil {
+		return err
+	}
+	if err := helper.EnsureDir(path); err != nil {
+		return err
+	}
+	return pdf.WritePdf(path)
+}
+
+// renderStats puts the statistics on a single page.
+func renderStats(stats *dto.StatsDTO) (pdf *gopdf.GoPdf, err error) {
+	pdf = &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA4})
+	pdf.AddPage()
+
+	if err = setFonts(pdf); err != nil {
+		return nil, fmt.Errorf("failed setting fonts: %w", err)
+	}
+	resetTextStyles(pdf)
+
+	if err = addStatsHeader(pdf, stats); err != nil {
+		return nil, fmt.Errorf("failed adding header: %w", err)
+	}
+	if err = addStatementFooter(pdf, 1, 1); err != nil {
+		return nil, fmt.Errorf("failed adding footer: %w", err)
+	}
+	addStatsSummary(pdf, stats, 120)
+	currentY := addStatsHistogram(pdf, stats, 280)
+	addStatsLargest(pdf, stats, currentY+20)
+	return
+}
+
+func addStatsHeader(pdf *gopdf.GoPdf, stats *dto.StatsDTO) error {
+	const startY = marginTop
+
+	if err := addImage(pdf, "./static/pdf/hintermann-logo.png", marginLeft, marginTop, 167, 17); err != nil {
+		return err
+	}
+	setText(pdf, marginLeft, startY+31, "Asociația de Caritate Hintermann")
+
+	setText(pdf, 312, startY+31, "Perioadă:")
+	setRightAlignedText(pdf, marginRight, startY+31, stats.PeriodStart+" - "+stats.PeriodEnd)
+	setText(pdf, 312, startY+47, "Data emiterii:")
+	setRightAlignedText(pdf, marginRight, startY+47, stats.Issued)
+
+	pdf.SetFont("Roboto-Bold", "", 18)
+	pdf.SetTextColor(0, 0, 0)
+	setRightAlignedText(pdf, marginRight, startY, statsTitle)
+
+	resetTextStyles(pdf)
+	return nil
+}
+
+func addStatsSummary(pdf *gopdf.GoPdf, stats *dto.StatsDTO, startY float64) {
+	left := [][2]string{
+		{"Donații:", stats.Count},
+		{"Donatori unici:", stats.UniqueDonors},
+		{"Donatori noi:", stats.NewDonors},
+		{"Donatori recurenți:", stats.ReturningDonors},
+		{"Donații anonime:", stats.Anonymous},
+		{"În alte monede:", stats.OtherCurrencies},
+	}
+	right := [][2]string{
+		{"Medie:", stats.Mean},
+		{"Mediană:", stats.Median},
+	}
+	for _, p := range stats.Percentiles {
+		right = append(right, [2]string{p.Label + ":", p.Amount})
+	}
+
+	for i, row := range left {
+		y := startY + 10 + float64(i)*16
+		setText(pdf, marginLeft, y, row[0])
+		setRightAlignedText(pdf, 282, y, row[1])
+	}
+	for i, row := range right {
+		y := startY + 10 + float64(i)*16
+		setText(pdf, 312, y, row[0])
+		setRightAlignedText(pdf, marginRight, y, row[1])
+	}
+	totalY := startY + 10 + float64(max(len(left), len(right)))*16 + 8
+
+	pdf.SetFont("Roboto-Bold", "", 10)
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, 312, totalY, "Total:")
+	setRightAlignedText(pdf, marginRight, totalY, stats.Total)
+	resetTextStyles(pdf)
+
+	pdf.Line(marginLeft, startY-.5, marginRight, startY-.5)
+	pdf.Line(312, totalY-8.5, marginRight, totalY-8.5)
+	pdf.Line(297.5, startY-.5, 298.5, totalY+20)
+}
+
+// addStatsHistogram draws a bar per bucket, as wide as its share of the
+// donations, and returns where it ends.
+func addStatsHistogram(pdf *gopdf.GoPdf, stats *dto.StatsDTO, startY float64) float64 {
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY, "Distribuția sumelor")
+	pdf.SetTextColor(94, 100, 112)
+	setText(pdf, 532, startY, "Număr")
+	pdf.Line(marginLeft, startY+21.5, marginRight, startY+21.5)
+
+	pdf.SetFillColor(94, 100, 112)
+	currentY := startY + 42
+	for _, bucket := range stats.Histogram {
+		setText(pdf, marginLeft, currentY, bucket.Label)
+		if width := bucket.Share * statsBarWidth; width > 0 {
+			pdf.RectFromUpperLeftWithStyle(statsBarX, currentY+1, width, 10, "F")
+		}
+		setRightAlignedText(pdf, marginRight, currentY, bucket.Count)
+		currentY += statsRowHeight
+	}
+	return currentY
+}
+
+func addStatsLargest(pdf *gopdf.GoPdf, stats *dto.StatsDTO, startY float64) {
+	pdf.SetTextColor(0, 0, 0)
+	setText(pdf, marginLeft, startY, "Cele mai mari donații")
+	pdf.SetTextColor(94, 100, 112)
+	setText(pdf, 150, startY, "ID tranzacție")
+	setText(pdf, 532, startY, "Sumă")
+	pdf.Line(marginLeft, startY+21.5, marginRight, startY+21.5)
+
+	currentY := startY + 42
+	for _, donation := range stats.Largest[:min(len(stats.Largest), statsLargestRows)] {
+		setText(pdf, marginLeft, currentY, donation.Created)
+		setText(pdf, 150, currentY, donation.Id)
+		setRightAlignedText(pdf, marginRight, currentY, donation.Gross)
+		currentY += statsRowHeight
+	}
+}
@@ -0,0 +1,623 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A snapshot is a gzipped tar named snapshot-<UTC time>.tar.gz. Its first
+// entry is manifest.json with the size and SHA-256 of every other entry, so
+// an archive can be checked before anything is restored from it.
+
+const (
+	manifestName   = "manifest.json"
+	snapshotLayout = "20060102T150405Z"
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".tar.gz"
+)
+
+type BackupManifest struct {
+	Created time.Time    `json:"created"`
+	Backend string       `json:"backend"`
+	Files   []BackupFile `json:"files"`
+}
+
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Snapshot struct {
+	Path    string
+	Created time.Time
+}
+
+type Backups struct {
+	DataDir string
+	Dir     string
+	Backend string
+}
+
+// NewBackups keeps snapshots in BACKUP_DIR, or in $DATA_DIR/backups.
+func NewBackups(cfg Config) *Backups {
+	dir := os.Getenv("BACKUP_DIR")
+	if dir == "" {
+		dir = filepath.Join(cfg.DataDir, "backups")
+	}
+	backend := cfg.Backend
+	if backend == "" {
+		backend = BackendCSV
+	}
+	return &Backups{DataDir: cfg.DataDir, Dir: dir, Backend: backend}
+}
+
+// Create copies the live files into a staging directory while no write can
+// run, then archives the copies.
+func (b *Backups) Create(now time.Time) (*Snapshot, error) {
+	if err := os.MkdirAll(b.Dir, 0700); err != nil {
+		return nil, err
+	}
+	snapshot := &Snapshot{
+		Path:    filepath.Join(b.Dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+snapshotSuffix),
+		Created: now.UTC().Truncate(time.Second),
+	}
+	if _, err := os.Stat(snapshot.Path); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", snapshot.Path)
+	}
+
+	staging, err := os.MkdirTemp(b.Dir, ".staging-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	names, err := b.copyLiveFiles(staging)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy data files: %w", err)
+	}
+	manifest := &BackupManifest{Created: snapshot.Created, Backend: b.Backend}
+	for _, name := range names {
+		file, err := checksum(filepath.Join(staging, name))
+		if err != nil {
+			return nil, err
+		}
+		file.Name = name
+		manifest.Files = append(manifest.Files, file)
+	}
+	if err := writeArchive(snapshot.Path, staging, manifest); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", snapshot.Path, err)
+	}
+	return snapshot, nil
+}
+
+// liveFiles are the data files relative to DataDir. The repo files depend
+// on the backend; the erasure log and the quarantined and rejected payouts
+// are always kept.
+func (b *Backups) liveFiles() ([]string, error) {
+	var names []string
+	if _, err := os.Stat(filepath.Join(b.DataDir, erasureLogName)); err == nil {
+		names = append(names, erasureLogName)
+	}
+	for _, dir := range []string{"quarantine", "rejected"} {
+		payouts, err := filepath.Glob(filepath.Join(b.DataDir, dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range payouts {
+			names = append(names, dir+"/"+filepath.Base(path))
+		}
+	}
+	return names, nil
+}
+
+func (b *Backups) copyLiveFiles(staging string) ([]string, error) {
+	var names []string
+	switch b.Backend {
+	case BackendCSV:
+		r := NewCSVRepo(b.DataDir)
+		l, err := r.lock()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+		}
+		defer l.unlock()
+		if err := r.recoverJournal(); err != nil {
+			return nil, err
+		}
+		for _, path := range []string{r.PayoutsFile, r.DonationsFile, r.LedgerFile, r.CorrectionsFile} {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			name := filepath.Base(path)
+			if err := copyFile(path, filepath.Join(staging, name)); err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+		}
+	case BackendSQLite:
+		r, err := OpenSQLiteRepo(SQLitePath(b.DataDir))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		name := filepath.Base(SQLitePath(b.DataDir))
+		// VACUUM INTO writes a consistent copy without blocking readers
+		if _, err := r.db.Exec(`VACUUM INTO ?`, filepath.Join(staging, name)); err != nil {
+			return nil, fmt.Errorf("failed to copy database: %w", err)
+		}
+		names = append(names, name)
+	default:
+		return nil, fmt.Errorf("unknown repo backend %q", b.Backend)
+	}
+
+	others, err := b.liveFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range others {
+		if err := copyFile(filepath.Join(b.DataDir, name), filepath.Join(staging, name)); err != nil {
+			return nil, err
+		}
+	}
+	return append(names, others...), nil
+}
+
+func (b *Backups) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []*Snapshot
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		created, err := time.Parse(snapshotLayout, strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix))
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, &Snapshot{Path: filepath.Join(b.Dir, name), Created: created})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.After(snapshots[j].Created)
+	})
+	return snapshots, nil
+}
+
+// RetentionPolicy keeps the newest snapshot of each of the last Daily days,
+// Weekly ISO weeks and Monthly months that have one.
+type RetentionPolicy struct {
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// Keep returns the snapshots the policy retains. The newest snapshot is
+// always kept.
+func (p RetentionPolicy) Keep(snapshots []*Snapshot) map[string]bool {
+	sorted := append([]*Snapshot(nil), snapshots...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+	keep := make(map[string]bool)
+	if len(sorted) > 0 {
+		keep[sorted[0].Path] = true
+	}
+	for _, rule := range []struct {
+		count  int
+		period func(time.Time) string
+	}{
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return strconv.Itoa(year) + "-W" + strconv.Itoa(week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	} {
+		periods := make(map[string]bool)
+		for _, s := range sorted {
+			period := rule.period(s.Created)
+			if len(periods) >= rule.count {
+				break
+			}
+			if !periods[period] {
+				periods[period] = true
+				keep[s.Path] = true
+			}
+		}
+	}
+	return keep
+}
+
+// Prune removes the snapshots the policy does not keep.
+func (b *Backups) Prune(p RetentionPolicy) ([]*Snapshot, error) {
+	snapshots, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	keep := p.Keep(snapshots)
+	var removed []*Snapshot
+	for _, s := range snapshots {
+		if keep[s.Path] {
+			continue
+		}
+		if err := os.Remove(s.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, s)
+	}
+	return removed, nil
+}
+
+// Verify reads the whole archive and checks every file against the
+// manifest.
+func (b *Backups) Verify(path string) (*BackupManifest, error) {
+	return readArchive(path, "")
+}
+
+// Restore checks the archive, snapshots the live files, and replaces them
+// with the archived ones in one journaled commit. It refuses to replace a
+// SQLite database that another process has open. Live files that are not
+// in the archive, e.g. corrections or quarantined payouts written after it,
+// are removed in the same commit.
+func (b *Backups) Restore(path string, now time.Time) (*BackupManifest, *Snapshot, error) {
+	staging, err := os.MkdirTemp(b.DataDir, ".restore-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	manifest, err := readArchive(path, staging)
+	if err != nil {
+		return nil, nil, err
+	}
+	if manifest.Backend != b.Backend {
+		return nil, nil, fmt.Errorf("%s is a %s snapshot but the repo backend is %s", path, manifest.Backend, b.Backend)
+	}
+	if err := checkStagedFiles(staging, manifest); err != nil {
+		return nil, nil, err
+	}
+
+	// check before snapshotting, the lock is taken again for the swap
+	probe, err := b.lockDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	probe.unlock()
+
+	previous, err := b.Create(now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to snapshot the live files before restoring: %w", err)
+	}
+
+	r := NewCSVRepo(b.DataDir)
+	l, err := r.lock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+	if err := r.recoverJournal(); err != nil {
+		return nil, nil, err
+	}
+	dbLock, err := b.lockDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer dbLock.unlock()
+
+	c := &commit{journalFile: r.journalFile()}
+	archived := make(map[string]bool)
+	for _, f := range manifest.Files {
+		target := filepath.Join(b.DataDir, f.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, nil, err
+		}
+		c.add(filepath.Join(staging, f.Name), target)
+		archived[f.Name] = true
+	}
+	live, err := b.liveNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range live {
+		if !archived[name] {
+			c.remove(filepath.Join(b.DataDir, name))
+		}
+	}
+	if b.Backend == BackendSQLite {
+		// move committed transactions into the live database, so it is
+		// whole if the swap fails
+		if err := checkpointSQLite(SQLitePath(b.DataDir)); err != nil {
+			return nil, nil, fmt.Errorf("failed to checkpoint the live database: %w", err)
+		}
+	}
+	if err := c.apply(); err != nil {
+		return nil, nil, fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	if b.Backend == BackendSQLite {
+		// a WAL left from the old database must not be applied to the new one
+		for _, suffix := range []string{"-wal", "-shm"} {
+			if err := os.Remove(SQLitePath(b.DataDir) + suffix); err != nil && !os.IsNotExist(err) {
+				return nil, nil, err
+			}
+		}
+	}
+	return manifest, previous, nil
+}
+
+// lockDatabase locks the SQLite database exclusively, failing if another
+// process has it open. The CSV backend has no database to lock.
+func (b *Backups) lockDatabase() (*fileLock, error) {
+	if b.Backend != BackendSQLite {
+		return nil, nil
+	}
+	l, err := tryLockFile(sqliteLockFile(SQLitePath(b.DataDir)))
+	if err != nil {
+		return nil, fmt.Errorf("the database is open, stop the webhook before restoring: %w", err)
+	}
+	return l, nil
+}
+
+// liveNames lists the repo files of the backend and the other data files
+// that exist, relative to DataDir.
+func (b *Backups) liveNames() ([]string, error) {
+	var paths []string
+	switch b.Backend {
+	case BackendCSV:
+		r := NewCSVRepo(b.DataDir)
+		paths = []string{r.PayoutsFile, r.DonationsFile, r.LedgerFile, r.CorrectionsFile}
+	case BackendSQLite:
+		paths = []string{SQLitePath(b.DataDir)}
+	}
+	var names []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	others, err := b.liveFiles()
+	if err != nil {
+		return nil, err
+	}
+	return append(names, others...), nil
+}
+
+func checkpointSQLite(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	// Restore holds the database lock exclusively
+	r, err := openSQLite(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.checkpoint()
+}
+
+// checkStagedFiles parses the restored CSV files and checks the database,
+// beyond the checksums.
+func checkStagedFiles(staging string, manifest *BackupManifest) error {
+	for _, f := range manifest.Files {
+		path := filepath.Join(staging, f.Name)
+		var err error
+		switch f.Name {
+		case "payouts.csv":
+			_, err = readAnyVersion(path, payoutsSchema)
+		case "donations.csv":
+			_, err = readAnyVersion(path, donationsSchema)
+		case "ledger.csv":
+			_, err = readAnyVersion(path, ledgerSchema)
+		case "corrections.csv":
+			_, err = readAnyVersion(path, correctionsSchema)
+		case filepath.Base(SQLitePath("")):
+			err = checkSQLite(path)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func checkSQLite(path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow(`PRAGMA integrity_check`).Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	return nil
+}
+
+func writeArchive(path, staging string, manifest *BackupManifest) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpFile)
+		}
+	}()
+
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarEntry(tw, manifestName, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		src, err := os.Open(filepath.Join(staging, file.Name))
+		if err != nil {
+			return err
+		}
+		err = writeTarEntry(tw, file.Name, file.Size, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+func writeTarEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, r)
+	return err
+}
+
+// readArchive checks every entry against the manifest, and extracts them to
+// dir unless it is empty.
+func readArchive(path, dir string) (*BackupManifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("%s does not start with a %s", path, manifestName)
+	}
+	manifest := &BackupManifest{}
+	if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %w", path, err)
+	}
+	expected := make(map[string]BackupFile, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if !filepath.IsLocal(file.Name) {
+			return nil, fmt.Errorf("manifest in %s names a file outside the data directory: %s", path, file.Name)
+		}
+		expected[file.Name] = file
+	}
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		file, ok := expected[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s contains %s, which is not in the manifest", path, header.Name)
+		}
+		delete(expected, header.Name)
+		if err := extractEntry(tr, file, dir); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for name := range expected {
+		return nil, fmt.Errorf("%s is missing %s", path, name)
+	}
+	return manifest, nil
+}
+
+func extractEntry(r io.Reader, file BackupFile, dir string) error {
+	w := io.Discard
+	if dir != "" {
+		target := filepath.Join(dir, file.Name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return err
+	}
+	if size != file.Size || hex.EncodeToString(h.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%s does not match its checksum", file.Name)
+	}
+	return nil
+}
+
+func checksum(path string) (BackupFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	return BackupFile{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,216 @@
+package repo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	now := time.Date(2025, time.March, 10, 12, 0, 0, 0, time.UTC)
+	for _, backend := range []string{BackendCSV, BackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			dataDir := t.TempDir()
+			if backend == BackendCSV {
+				r := newTestCSVRepo(t)
+				dataDir = filepath.Dir(r.PayoutsFile)
+			}
+			backups := &Backups{DataDir: dataDir, Dir: t.TempDir(), Backend: backend}
+			store, err := Open(Config{Backend: backend, DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			writePayout := func(id string) {
+				payout, donations := testPayout(id)
+				if err := store.WritePayoutAndDonations(payout, donations); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Join(dataDir, "quarantine"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dataDir, "quarantine", "po_q.json"), []byte(`{"PayoutId":"po_q"}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			writePayout("po_1")
+
+			snapshot, err := backups.Create(now)
+			if err != nil {
+				t.Fatalf("Create failed: %v", err)
+			}
+			manifest, err := backups.Verify(snapshot.Path)
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			if !slices.ContainsFunc(manifest.Files, func(f BackupFile) bool { return f.Name == "quarantine/po_q.json" }) {
+				t.Errorf("Expected the quarantine file in the manifest, got %+v", manifest.Files)
+			}
+
+			writePayout("po_2")
+			newer := filepath.Join(dataDir, "quarantine", "po_new.json")
+			if err := os.WriteFile(newer, []byte(`{"PayoutId":"po_new"}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if backend == BackendSQLite {
+				if _, _, err := backups.Restore(snapshot.Path, now.Add(time.Hour)); err == nil || !strings.Contains(err.Error(), "stop the webhook") {
+					t.Fatalf("Expected restoring an open database to fail, got %v", err)
+				}
+				store.Close()
+			}
+			if _, previous, err := backups.Restore(snapshot.Path, now.Add(time.Hour)); err != nil {
+				t.Fatalf("Restore failed: %v", err)
+			} else if _, err := backups.Verify(previous.Path); err != nil {
+				t.Errorf("Expected a valid snapshot of the replaced files: %v", err)
+			}
+
+			restored, err := Open(Config{Backend: backend, DataDir: dataDir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer restored.Close()
+			if _, err := restored.GetPayoutById("po_1"); err != nil {
+				t.Errorf("Expected po_1 after restoring: %v", err)
+			}
+			if _, err := restored.GetPayoutById("po_2"); err == nil {
+				t.Errorf("Expected po_2 to be gone after restoring")
+			}
+			if _, err := os.Stat(newer); !os.IsNotExist(err) {
+				t.Errorf("Expected the quarantine file written after the snapshot to be removed, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dataDir, "quarantine", "po_q.json")); err != nil {
+				t.Errorf("Expected the archived quarantine file to be restored: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsTamperedSnapshot(t *testing.T) {
+	r := newTestCSVRepo(t)
+	payout, donations := testPayout("po_1")
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	backups := &Backups{DataDir: filepath.Dir(r.PayoutsFile), Dir: t.TempDir(), Backend: BackendCSV}
+	snapshot, err := backups.Create(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := filepath.Join(t.TempDir(), "tampered.tar.gz")
+	rewriteArchive(t, snapshot.Path, tampered, func(name string, data []byte) []byte {
+		if name == "donations.csv" {
+			return []byte(strings.Replace(string(data), "100", "900", 1))
+		}
+		return data
+	})
+	if _, err := backups.Verify(tampered); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a checksum error, got: %v", err)
+	}
+	before, _ := os.ReadFile(r.DonationsFile)
+	if _, _, err := backups.Restore(tampered, time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("Expected restoring a tampered snapshot to fail")
+	}
+	if after, _ := os.ReadFile(r.DonationsFile); string(after) != string(before) {
+		t.Errorf("Expected the live files to be untouched")
+	}
+}
+
+func rewriteArchive(t *testing.T, src, dst string, fn func(name string, data []byte) []byte) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = fn(header.Name, data)
+		header.Size = int64(len(data))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	snapshotsAt := func(times ...string) []*Snapshot {
+		var snapshots []*Snapshot
+		for _, s := range times {
+			created, err := time.Parse(time.DateTime, s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			snapshots = append(snapshots, &Snapshot{Path: s, Created: created})
+		}
+		return snapshots
+	}
+	snapshots := snapshotsAt(
+		"2025-03-10 12:00:00", "2025-03-10 06:00:00", "2025-03-09 12:00:00", "2025-03-08 12:00:00",
+		"2025-03-02 12:00:00", "2025-02-23 12:00:00", "2025-02-01 12:00:00", "2025-01-15 12:00:00",
+	)
+
+	testCases := map[string]struct {
+		policy   RetentionPolicy
+		expected []string
+	}{
+		"nothing":     {policy: RetentionPolicy{}, expected: []string{"2025-03-10 12:00:00"}},
+		"twoDaily":    {policy: RetentionPolicy{Daily: 2}, expected: []string{"2025-03-10 12:00:00", "2025-03-09 12:00:00"}},
+		"threeWeekly": {policy: RetentionPolicy{Weekly: 3}, expected: []string{"2025-03-10 12:00:00", "2025-03-09 12:00:00", "2025-03-02 12:00:00"}},
+		"allMonthly":  {policy: RetentionPolicy{Monthly: 12}, expected: []string{"2025-03-10 12:00:00", "2025-02-23 12:00:00", "2025-01-15 12:00:00"}},
+		"combined": {policy: RetentionPolicy{Daily: 1, Weekly: 2, Monthly: 2}, expected: []string{
+			"2025-03-10 12:00:00", "2025-03-09 12:00:00", "2025-02-23 12:00:00",
+		}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			keep := tc.policy.Keep(snapshots)
+			var kept []string
+			for _, s := range snapshots {
+				if keep[s.Path] {
+					kept = append(kept, s.Path)
+				}
+			}
+			if !slices.Equal(kept, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, kept)
+			}
+		})
+	}
+}
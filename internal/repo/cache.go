@@ -0,0 +1,252 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+// CachedRepo keeps parsed CSV rows and their indexes in memory and reloads
+// them only when the size, modification time or identity of a file changes.
+type CachedRepo struct {
+	Repo *CSVRepo
+
+	mu              sync.RWMutex
+	payoutsStamp    fileStamp
+	donationStamp   fileStamp
+	correctionStamp fileStamp
+	index           *csvIndex
+}
+
+type fileStamp struct {
+	info os.FileInfo
+}
+
+func (s fileStamp) matches(info os.FileInfo) bool {
+	if s.info == nil || info == nil {
+		return s.info == nil && info == nil
+	}
+	return os.SameFile(s.info, info) &&
+		s.info.Size() == info.Size() &&
+		s.info.ModTime().Equal(info.ModTime())
+}
+
+type csvIndex struct {
+	payouts           []*model.Payout
+	payoutsById       map[string]*model.Payout
+	payoutsByMonth    map[string][]*model.Payout
+	donations         []*model.Donation
+	donationsById     map[string]*model.Donation
+	donationsByPayout map[string][]*model.Donation
+	donationsByEmail  map[string][]*model.Donation
+}
+
+func NewCachedRepo(r *CSVRepo) *CachedRepo {
+	return &CachedRepo{Repo: r}
+}
+
+func (c *CachedRepo) GetPayoutsByMonth(start time.Time) ([]*model.Payout, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	payouts := idx.payoutsByMonth[monthKey(start)]
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %d-%02d", start.Year(), start.Month())
+	}
+	return copyPayouts(payouts), nil
+}
+
+func (c *CachedRepo) GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return copyPayouts(payoutsBetween(idx.payouts, start, end)), nil
+}
+
+func (c *CachedRepo) GetPayoutById(id string) (*model.Payout, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := idx.payoutsById[id]
+	if !ok {
+		return nil, fmt.Errorf("payout %w: %s", service.ErrNotFound, id)
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func (c *CachedRepo) GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return copyDonations(idx.donationsByPayout[payoutId]), nil
+}
+
+func (c *CachedRepo) GetDonationById(id string) (*model.Donation, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	d, ok := idx.donationsById[id]
+	if !ok {
+		return nil, fmt.Errorf("donation not found: %s", id)
+	}
+	copied := *d
+	return &copied, nil
+}
+
+func (c *CachedRepo) GetDonationsByEmail(email string) ([]*model.Donation, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return copyDonations(idx.donationsByEmail[email]), nil
+}
+
+// QueryDonations narrows the rows with the id and payout indexes before
+// filtering.
+func (c *CachedRepo) QueryDonations(q service.DonationQuery) (*service.DonationPage, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	candidates := idx.donations
+	switch {
+	case q.Id != "":
+		candidates = nil
+		if d, ok := idx.donationsById[q.Id]; ok {
+			candidates = []*model.Donation{d}
+		}
+	case q.PayoutId != "":
+		candidates = idx.donationsByPayout[q.PayoutId]
+	}
+	page, err := service.FilterDonations(candidates, q)
+	if err != nil {
+		return nil, err
+	}
+	page.Donations = copyDonations(page.Donations)
+	return page, nil
+}
+
+func (c *CachedRepo) GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error) {
+	idx, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	return copyPayouts(pageOf(idx.payouts, cursor, limit)), nil
+}
+
+func (c *CachedRepo) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error {
+	return c.Repo.WritePayoutAndDonations(p, ds)
+}
+
+func (c *CachedRepo) Close() error {
+	return c.Repo.Close()
+}
+
+func (c *CachedRepo) load() (*csvIndex, error) {
+	payoutsInfo, err := statIfExists(c.Repo.PayoutsFile)
+	if err != nil {
+		return nil, err
+	}
+	donationsInfo, err := statIfExists(c.Repo.DonationsFile)
+	if err != nil {
+		return nil, err
+	}
+	correctionsInfo, err := statIfExists(c.Repo.CorrectionsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	idx := c.index
+	fresh := idx != nil && c.payoutsStamp.matches(payoutsInfo) && c.donationStamp.matches(donationsInfo) && c.correctionStamp.matches(correctionsInfo)
+	c.mu.RUnlock()
+	if fresh {
+		return idx, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.index != nil && c.payoutsStamp.matches(payoutsInfo) && c.donationStamp.matches(donationsInfo) && c.correctionStamp.matches(correctionsInfo) {
+		return c.index, nil
+	}
+
+	payouts, err := c.Repo.loadPayouts()
+	if err != nil {
+		return nil, err
+	}
+	donations, err := c.Repo.loadDonations()
+	if err != nil {
+		return nil, err
+	}
+	c.index = buildIndex(payouts, donations)
+	c.payoutsStamp = fileStamp{info: payoutsInfo}
+	c.donationStamp = fileStamp{info: donationsInfo}
+	c.correctionStamp = fileStamp{info: correctionsInfo}
+	return c.index, nil
+}
+
+func buildIndex(payouts []*model.Payout, donations []*model.Donation) *csvIndex {
+	idx := &csvIndex{
+		payouts:           payouts,
+		payoutsById:       make(map[string]*model.Payout, len(payouts)),
+		payoutsByMonth:    make(map[string][]*model.Payout),
+		donations:         donations,
+		donationsById:     make(map[string]*model.Donation, len(donations)),
+		donationsByPayout: make(map[string][]*model.Donation),
+		donationsByEmail:  make(map[string][]*model.Donation),
+	}
+	for _, p := range payouts {
+		idx.payoutsById[p.Id] = p
+		key := monthKey(p.Created)
+		idx.payoutsByMonth[key] = append(idx.payoutsByMonth[key], p)
+	}
+	for _, d := range donations {
+		idx.donationsById[d.Id] = d
+		idx.donationsByPayout[d.PayoutId] = append(idx.donationsByPayout[d.PayoutId], d)
+		idx.donationsByEmail[d.ClientEmail] = append(idx.donationsByEmail[d.ClientEmail], d)
+	}
+	return idx
+}
+
+func monthKey(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+func statIfExists(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return info, err
+}
+
+func copyPayouts(payouts []*model.Payout) []*model.Payout {
+	copied := make([]*model.Payout, len(payouts))
+	for i, p := range payouts {
+		c := *p
+		copied[i] = &c
+	}
+	return copied
+}
+
+func copyDonations(donations []*model.Donation) []*model.Donation {
+	if donations == nil {
+		return nil
+	}
+	copied := make([]*model.Donation, len(donations))
+	for i, d := range donations {
+		c := *d
+		copied[i] = &c
+	}
+	return copied
+}
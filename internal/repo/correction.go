@@ -0,0 +1,309 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+// Corrections are appended, never rewritten, except to pseudonymize or
+// re-encrypt their values. The old and new values are donor data and are
+// encrypted like the donation columns they amend.
+
+func (r *CSVRepo) GetCorrections(donationId string) ([]*model.Correction, error) {
+	l, err := r.rlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	t, err := readTable(r.CorrectionsFile, correctionsSchema)
+	if err != nil {
+		return nil, err
+	}
+	corrections, err := r.correctionsFromTable(t)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []*model.Correction
+	for _, c := range corrections {
+		if c.DonationId == donationId {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+func (r *CSVRepo) WriteCorrection(c *model.Correction) error {
+	if r.LedgerFile == "" {
+		return errNoLedgerFile
+	}
+	l, err := r.lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	if err := r.recoverJournal(); err != nil {
+		return err
+	}
+	t, err := readExistingTable(r.DonationsFile, donationsSchema)
+	if err != nil {
+		return err
+	}
+	ct, err := readTable(r.CorrectionsFile, correctionsSchema)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, record := range t.records {
+		if t.get(record, "id") == c.DonationId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("donation not found: %s", c.DonationId)
+	}
+
+	record, err := r.correctionRecord(c)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt correction: %w", err)
+	}
+	if err := ct.upgrade(); err != nil {
+		return err
+	}
+	ct.records = append(ct.records, record)
+	ledgerRows, err := r.donorLedgerRecords(t, ct, []string{c.DonationId})
+	if err != nil {
+		return fmt.Errorf("failed to chain the correction of donation %s: %w", c.DonationId, err)
+	}
+	cm := &commit{journalFile: r.journalFile()}
+	defer cm.abort()
+	if err := cm.stage(r.CorrectionsFile, correctionsSchema, [][]string{record}); err != nil {
+		return fmt.Errorf("failed to stage correction: %w", err)
+	}
+	if err := cm.stage(r.LedgerFile, ledgerSchema, ledgerRows); err != nil {
+		return fmt.Errorf("failed to stage ledger: %w", err)
+	}
+	if err := cm.apply(); err != nil {
+		return fmt.Errorf("failed to commit correction of donation %s: %w", c.DonationId, err)
+	}
+	return nil
+}
+
+// ReplaceDonor overwrites the stored name and email of a donation and
+// replaces its corrections with the ones sync received.
+func (r *CSVRepo) ReplaceDonor(d *service.ExportedDonor) error {
+	return r.rewriteDonors(func(donations, corrections *csvTable) ([]string, bool, error) {
+		found := false
+		for _, record := range donations.records {
+			if donations.get(record, "id") != d.DonationId {
+				continue
+			}
+			values := map[string]string{"client_name": d.ClientName, "client_email": d.ClientEmail}
+			for column, value := range values {
+				var err error
+				if record[donations.index[column]], err = encryptPII(r.PII, column, value); err != nil {
+					return nil, false, err
+				}
+			}
+			found = true
+		}
+		if !found {
+			return nil, false, fmt.Errorf("donation not found: %s", d.DonationId)
+		}
+
+		if err := corrections.upgrade(); err != nil {
+			return nil, false, err
+		}
+		var records [][]string
+		for _, record := range corrections.records {
+			if corrections.get(record, "donation_id") != d.DonationId {
+				records = append(records, record)
+			}
+		}
+		for _, c := range d.Corrections {
+			record, err := r.correctionRecord(c)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to encrypt correction: %w", err)
+			}
+			records = append(records, record)
+		}
+		corrections.records = records
+		return []string{d.DonationId}, true, nil
+	})
+}
+
+func (r *CSVRepo) correctionRecord(c *model.Correction) ([]string, error) {
+	old, err := encryptPII(r.PII, c.Field, c.OldValue)
+	if err != nil {
+		return nil, err
+	}
+	value, err := encryptPII(r.PII, c.Field, c.NewValue)
+	if err != nil {
+		return nil, err
+	}
+	return correctionsSchema.record(map[string]string{
+		"donation_id": c.DonationId,
+		"field":       c.Field,
+		"old_value":   old,
+		"new_value":   value,
+		"operator":    c.Operator,
+		"reason":      c.Reason,
+		"created":     formatCreated(c.Created),
+	}), nil
+}
+
+func (r *CSVRepo) correctionsFromTable(t *csvTable) ([]*model.Correction, error) {
+	corrections := make([]*model.Correction, len(t.records))
+	for i, record := range t.records {
+		id, field := t.get(record, "donation_id"), t.get(record, "field")
+		created, err := parseCreated(t.get(record, "created"))
+		if err != nil {
+			return nil, fmt.Errorf("correction of donation %s: %w", id, err)
+		}
+		old, err := decryptPII(r.PII, field, t.get(record, "old_value"))
+		if err != nil {
+			return nil, fmt.Errorf("correction of donation %s: %w", id, err)
+		}
+		value, err := decryptPII(r.PII, field, t.get(record, "new_value"))
+		if err != nil {
+			return nil, fmt.Errorf("correction of donation %s: %w", id, err)
+		}
+		corrections[i] = &model.Correction{
+			DonationId: id,
+			Field:      field,
+			OldValue:   old,
+			NewValue:   value,
+			Operator:   t.get(record, "operator"),
+			Reason:     t.get(record, "reason"),
+			Created:    created,
+		}
+	}
+	return corrections, nil
+}
+
+func (c *CachedRepo) GetCorrections(donationId string) ([]*model.Correction, error) {
+	return c.Repo.GetCorrections(donationId)
+}
+
+func (c *CachedRepo) WriteCorrection(correction *model.Correction) error {
+	return c.Repo.WriteCorrection(correction)
+}
+
+func (c *CachedRepo) ReplaceDonor(d *service.ExportedDonor) error {
+	return c.Repo.ReplaceDonor(d)
+}
+
+func (r *SQLiteRepo) GetCorrections(donationId string) ([]*model.Correction, error) {
+	return queryCorrections(r.db, `WHERE donation_id = ? ORDER BY seq`, donationId)
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// queryCorrections reads the corrections matching the WHERE and ORDER BY
+// clauses in tail.
+func queryCorrections(q querier, tail string, args ...any) ([]*model.Correction, error) {
+	rows, err := q.Query(`SELECT donation_id, field, old_value, new_value, operator, reason, created FROM corrections `+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var corrections []*model.Correction
+	for rows.Next() {
+		var c model.Correction
+		var created string
+		if err := rows.Scan(&c.DonationId, &c.Field, &c.OldValue, &c.NewValue, &c.Operator, &c.Reason, &created); err != nil {
+			return nil, err
+		}
+		if c.Created, err = fromSQLiteTime(created); err != nil {
+			return nil, fmt.Errorf("correction of donation %s: %w", c.DonationId, err)
+		}
+		corrections = append(corrections, &c)
+	}
+	return corrections, rows.Err()
+}
+
+func (r *SQLiteRepo) WriteCorrection(c *model.Correction) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM donations WHERE id = ?)`, c.DonationId).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("donation not found: %s", c.DonationId)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO corrections (donation_id, field, old_value, new_value, operator, reason, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.DonationId, c.Field, c.OldValue, c.NewValue, c.Operator, c.Reason, toSQLiteTime(c.Created))
+	if err != nil {
+		return fmt.Errorf("failed to insert correction of donation %s: %w", c.DonationId, err)
+	}
+	if err := chainDonors(tx, []string{c.DonationId}); err != nil {
+		return fmt.Errorf("failed to chain the correction of donation %s: %w", c.DonationId, err)
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepo) ReplaceDonor(d *service.ExportedDonor) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE donations SET client_name = ?, client_email = ? WHERE id = ?`, d.ClientName, d.ClientEmail, d.DonationId)
+	if err != nil {
+		return fmt.Errorf("failed to update donation %s: %w", d.DonationId, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("donation not found: %s", d.DonationId)
+	}
+	if _, err := tx.Exec(`DELETE FROM corrections WHERE donation_id = ?`, d.DonationId); err != nil {
+		return fmt.Errorf("failed to replace the corrections of donation %s: %w", d.DonationId, err)
+	}
+	for _, c := range d.Corrections {
+		if _, err := tx.Exec(`
+			INSERT INTO corrections (donation_id, field, old_value, new_value, operator, reason, created)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			c.DonationId, c.Field, c.OldValue, c.NewValue, c.Operator, c.Reason, toSQLiteTime(c.Created)); err != nil {
+			return fmt.Errorf("failed to insert correction of donation %s: %w", d.DonationId, err)
+		}
+	}
+	if err := chainDonors(tx, []string{d.DonationId}); err != nil {
+		return fmt.Errorf("failed to chain the donor of donation %s: %w", d.DonationId, err)
+	}
+	return tx.Commit()
+}
+
+func (g *GitRepo) WriteCorrection(c *model.Correction) error {
+	if err := g.Store.WriteCorrection(c); err != nil {
+		return err
+	}
+	if err := g.Commit("Amend " + c.Field + " of donation " + c.DonationId); err != nil {
+		return fmt.Errorf("correction of donation %s was written but not committed: %w", c.DonationId, err)
+	}
+	return nil
+}
+
+func (g *GitRepo) ReplaceDonor(d *service.ExportedDonor) error {
+	if err := g.Store.ReplaceDonor(d); err != nil {
+		return err
+	}
+	if err := g.Commit("Sync the donor of donation " + d.DonationId); err != nil {
+		return fmt.Errorf("donor of donation %s was synced but not committed: %w", d.DonationId, err)
+	}
+	return nil
+}
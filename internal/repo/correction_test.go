@@ -0,0 +1,192 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func TestCorrections(t *testing.T) {
+	key, err := GeneratePIIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := newTestCSVRepo(t)
+	if encrypted.PII, err = ParsePIIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	repos := map[string]Store{
+		"csv":       NewCachedRepo(newTestCSVRepo(t)),
+		"encrypted": NewCachedRepo(encrypted),
+		"sqlite":    sqliteRepo,
+	}
+	for name, r := range repos {
+		t.Run(name, func(t *testing.T) {
+			payout, donations := testPayout("po_1")
+			if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.WriteCorrection(&model.Correction{DonationId: "txn_po_9", Field: model.CorrectionClientName, NewValue: "Ana"}); err == nil {
+				t.Errorf("Expected a correction of an unknown donation to fail")
+			}
+
+			s := &service.AmendService{Repo: r}
+			if _, err := s.Amend("txn_po_1", model.CorrectionClientEmail, "ana.pop@example.com", "ion", "typo"); err != nil {
+				t.Fatalf("Amend failed: %v", err)
+			}
+			donation, history, err := s.History("txn_po_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if donation.ClientEmail != "ana.pop@example.com" || len(history) != 1 || history[0].OldValue != "ana@example.com" {
+				t.Errorf("Expected the corrected email and one correction, got %q and %+v", donation.ClientEmail, history)
+			}
+			donations, err = r.GetDonationsByPayoutId("po_1")
+			if err != nil || len(donations) != 1 || donations[0].ClientEmail != "ana.pop@example.com" {
+				t.Errorf("Expected the payout's donation to have the corrected email, got %v, %v", donations, err)
+			}
+			page, err := r.QueryDonations(service.DonationQuery{Email: "ANA.POP@example.com"})
+			if err != nil || page.Total != 1 {
+				t.Errorf("Expected to find the donation by its corrected email, got %v, %v", page, err)
+			}
+			report, err := (&service.LedgerService{Repo: r}).VerifyChain()
+			if err != nil || report.Break != nil {
+				t.Errorf("Expected the chain to stay intact, got %+v, %v", report, err)
+			}
+
+			ids, err := r.PseudonymizeDonor("ana.pop@example.com", service.Pseudonym{Name: "erased-1", Email: "erased-1@erased.invalid"})
+			if err != nil || len(ids) != 1 {
+				t.Fatalf("Expected the donor to be found by the corrected email, got %v, %v", ids, err)
+			}
+			history, err = r.GetCorrections("txn_po_1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 1 || history[0].OldValue != "erased-1@erased.invalid" || history[0].NewValue != "erased-1@erased.invalid" {
+				t.Errorf("Expected the correction values to be pseudonymized, got %+v", history)
+			}
+			report, err = (&service.LedgerService{Repo: r}).VerifyChain()
+			if err != nil || report.Break != nil || report.Head.Kind != service.LedgerDonor {
+				t.Errorf("Expected the erasure to be chained, got %+v, %v", report, err)
+			}
+		})
+	}
+}
+
+func TestCorrectionsAreEncryptedAndMigrated(t *testing.T) {
+	key, err := GeneratePIIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTestCSVRepo(t)
+	if r.PII, err = ParsePIIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	payout, donations := testPayout("po_1")
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	correction := &model.Correction{
+		DonationId: "txn_po_1", Field: model.CorrectionClientName, OldValue: "Ana", NewValue: "Ana Popescu",
+		Operator: "ion", Reason: "typo", Created: time.Date(2025, time.March, 4, 10, 0, 0, 0, time.UTC),
+	}
+	if err := r.WriteCorrection(correction); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(r.CorrectionsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "Popescu") {
+		t.Errorf("Expected the correction values to be encrypted, got %s", data)
+	}
+
+	if _, err := r.RotatePIIKey(nil); err != nil {
+		t.Fatalf("RotatePIIKey failed: %v", err)
+	}
+	if data, _ := os.ReadFile(r.CorrectionsFile); !strings.Contains(string(data), "Popescu") {
+		t.Errorf("Expected rotating to no key to decrypt the corrections, got %s", data)
+	}
+
+	dst, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if _, _, err := MigrateCSVToSQLite(r, dst); err != nil {
+		t.Fatalf("MigrateCSVToSQLite failed: %v", err)
+	}
+	history, err := dst.GetCorrections("txn_po_1")
+	if err != nil || len(history) != 1 || *history[0] != *correction {
+		t.Errorf("Expected the correction to be migrated, got %+v, %v", history, err)
+	}
+	migrated, err := dst.GetDonationsByPayoutId("po_1")
+	if err != nil || migrated[0].ClientName != "Ana Popescu" {
+		t.Errorf("Expected the migrated donation to have the corrected name, got %v, %v", migrated, err)
+	}
+}
+
+func TestReplaceDonor(t *testing.T) {
+	key, err := GeneratePIIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := newTestCSVRepo(t)
+	if encrypted.PII, err = ParsePIIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	repos := map[string]Store{
+		"csv":       NewCachedRepo(newTestCSVRepo(t)),
+		"encrypted": NewCachedRepo(encrypted),
+		"sqlite":    sqliteRepo,
+	}
+	for name, r := range repos {
+		t.Run(name, func(t *testing.T) {
+			payout, donations := testPayout("po_1")
+			if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.WriteCorrection(&model.Correction{DonationId: "txn_po_1", Field: model.CorrectionClientName, OldValue: "Ana", NewValue: "Ana P", Created: day(4, time.March)}); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.ReplaceDonor(&service.ExportedDonor{DonationId: "txn_po_9"}); err == nil {
+				t.Errorf("Expected replacing the donor of an unknown donation to fail")
+			}
+
+			correction := &model.Correction{DonationId: "txn_po_1", Field: model.CorrectionClientEmail, OldValue: "ana@example.com", NewValue: "ana.pop@example.com", Operator: "ion", Reason: "typo", Created: day(5, time.March)}
+			donor := &service.ExportedDonor{DonationId: "txn_po_1", ClientName: "Ana", ClientEmail: "ana@example.com", Corrections: []*model.Correction{correction}}
+			if err := r.ReplaceDonor(donor); err != nil {
+				t.Fatalf("ReplaceDonor failed: %v", err)
+			}
+			history, err := r.GetCorrections("txn_po_1")
+			if err != nil || len(history) != 1 || *history[0] != *correction {
+				t.Errorf("Expected the corrections to be replaced, got %+v, %v", history, err)
+			}
+			donations, err = r.GetDonationsByPayoutId("po_1")
+			if err != nil || donations[0].ClientName != "Ana" || donations[0].ClientEmail != "ana.pop@example.com" {
+				t.Errorf("Expected the stored name and the corrected email, got %v, %v", donations, err)
+			}
+			report, err := (&service.LedgerService{Repo: r}).VerifyChain()
+			if err != nil || report.Break != nil || report.Head.Kind != service.LedgerDonor {
+				t.Errorf("Expected the replaced donor to be chained, got %+v, %v", report, err)
+			}
+		})
+	}
+}
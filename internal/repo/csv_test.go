@@ -0,0 +1,310 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func newTestCSVRepo(t *testing.T) *CSVRepo {
+	t.Helper()
+	r := NewCSVRepo(t.TempDir())
+	for _, f := range []struct {
+		filename string
+		schema   *csvSchema
+	}{{r.PayoutsFile, payoutsSchema}, {r.DonationsFile, donationsSchema}} {
+		tmpFile, err := writeTemp(f.filename, &csvTable{schema: f.schema, header: f.schema.columns()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmpFile, f.filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func lei(amount int64) model.Money {
+	return model.NewMoney(amount, "ron")
+}
+
+func testPayout(id string) (*model.Payout, []*model.Donation) {
+	return &model.Payout{Id: id, Created: day(3, time.March), Gross: lei(100), Fee: lei(10), Net: lei(90)},
+		[]*model.Donation{{Id: "txn_" + id, Created: day(1, time.March), ClientName: "Ana", ClientEmail: "ana@example.com",
+			PayoutId: id, Gross: lei(100), Fee: lei(10), Net: lei(90), Policy: "default"}}
+}
+
+func TestCSVRepoRecover(t *testing.T) {
+	testCases := map[string]struct {
+		journalWritten  bool
+		expectedPayouts int
+	}{
+		"crashBeforeJournalRollsBack":   {journalWritten: false, expectedPayouts: 0},
+		"crashAfterJournalRollsForward": {journalWritten: true, expectedPayouts: 1},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := newTestCSVRepo(t)
+			payout, donations := testPayout("po_1")
+
+			c := &commit{journalFile: r.journalFile()}
+			if err := c.stage(r.PayoutsFile, payoutsSchema, [][]string{payoutRecord(payout)}); err != nil {
+				t.Fatal(err)
+			}
+			record, err := r.donationRecord(donations[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.stage(r.DonationsFile, donationsSchema, [][]string{record}); err != nil {
+				t.Fatal(err)
+			}
+			if tc.journalWritten {
+				if err := writeJournal(c.journalFile, c.entries); err != nil {
+					t.Fatal(err)
+				}
+				// the payouts file was renamed, then the process died
+				if err := os.Rename(c.entries[0].Tmp, c.entries[0].Target); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := r.Recover(); err != nil {
+				t.Fatalf("Recover failed: %v", err)
+			}
+			payouts, err := r.loadPayouts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotDonations, err := r.loadDonations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(payouts) != tc.expectedPayouts || len(gotDonations) != tc.expectedPayouts {
+				t.Errorf("Expected %d payouts and donations, got %d and %d",
+					tc.expectedPayouts, len(payouts), len(gotDonations))
+			}
+			if _, err := os.Stat(r.journalFile()); !os.IsNotExist(err) {
+				t.Errorf("Expected the journal to be removed")
+			}
+			staged, _ := filepath.Glob(filepath.Join(filepath.Dir(r.PayoutsFile), "*.tmp"))
+			if len(staged) > 0 {
+				t.Errorf("Expected staged files to be removed, got %v", staged)
+			}
+		})
+	}
+}
+
+func TestCSVRepoConcurrentWrites(t *testing.T) {
+	const (
+		writers          = 8
+		payoutsPerWriter = 15
+	)
+	base := newTestCSVRepo(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*payoutsPerWriter+writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		// separate repo values open their own lock file descriptors, like separate processes
+		go func(w int) {
+			defer wg.Done()
+			r := &CSVRepo{PayoutsFile: base.PayoutsFile, DonationsFile: base.DonationsFile, LedgerFile: base.LedgerFile, CorrectionsFile: base.CorrectionsFile}
+			for i := 0; i < payoutsPerWriter; i++ {
+				payout, donations := testPayout(fmt.Sprintf("po_%d_%d", w, i))
+				if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			r := &CSVRepo{PayoutsFile: base.PayoutsFile, DonationsFile: base.DonationsFile, LedgerFile: base.LedgerFile, CorrectionsFile: base.CorrectionsFile}
+			for i := 0; i < payoutsPerWriter; i++ {
+				if _, err := r.loadDonations(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent access failed: %v", err)
+	}
+
+	payouts, err := base.loadPayouts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	donations, err := base.loadDonations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payouts) != writers*payoutsPerWriter || len(donations) != writers*payoutsPerWriter {
+		t.Errorf("Expected %d payouts and donations, got %d and %d",
+			writers*payoutsPerWriter, len(payouts), len(donations))
+	}
+	report, err := (&service.LedgerService{Repo: NewCachedRepo(base)}).VerifyChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Break != nil || report.Entries != 3*writers*payoutsPerWriter {
+		t.Errorf("Expected an intact chain of %d entries, got %d entries and %+v",
+			3*writers*payoutsPerWriter, report.Entries, report.Break)
+	}
+}
+
+func TestCachedRepoReloadsOnChange(t *testing.T) {
+	base := newTestCSVRepo(t)
+	cached := NewCachedRepo(base)
+
+	payout, donations := testPayout("po_1")
+	if err := cached.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GetPayoutById("po_1"); err != nil {
+		t.Fatalf("Expected po_1 to be cached, got: %v", err)
+	}
+
+	// a write through another repo value, like the CLI next to the webhook
+	payout, donations = testPayout("po_2")
+	if err := base.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GetPayoutById("po_2"); err != nil {
+		t.Errorf("Expected the cache to reload po_2, got: %v", err)
+	}
+	byEmail, err := cached.GetDonationsByEmail("ana@example.com")
+	if err != nil || len(byEmail) != 2 {
+		t.Errorf("Expected 2 donations by email, got %d (%v)", len(byEmail), err)
+	}
+	march, err := cached.GetPayoutsByMonth(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(march) != 2 {
+		t.Errorf("Expected 2 payouts in March, got %d (%v)", len(march), err)
+	}
+
+	march[0].Gross = lei(1)
+	if p, _ := cached.GetPayoutById(march[0].Id); p.Gross.Equal(lei(1)) {
+		t.Errorf("Expected callers to get copies of cached payouts")
+	}
+}
+
+func TestCSVRepoSchema(t *testing.T) {
+	testCases := map[string]struct {
+		donations       string
+		expectedErr     string
+		migrateFirst    bool
+		expectedEmail   string
+		expectedCreated time.Time
+	}{
+		"columnsMappedByName": {
+			donations:       "#schema=donations/v4\nclient_email,id,created,client_name,payout_id,gross,fee,net,currency,policy\nana@example.com,txn_1,2025-03-01T10:15:00Z,Ana,po_1,100,10,90,ron,default\n",
+			expectedEmail:   "ana@example.com",
+			expectedCreated: time.Date(2025, time.March, 1, 10, 15, 0, 0, time.UTC),
+		},
+		"unknownColumn": {
+			donations:   "#schema=donations/v4\nid,created,client_name,client_email,payout_id,gross,fee,net,currency,policy,iban\n",
+			expectedErr: `unknown column "iban"`,
+		},
+		"missingColumn": {
+			donations:   "#schema=donations/v4\nid,created,client_name,client_email,payout_id,gross,fee,net,currency\n",
+			expectedErr: `missing column "policy"`,
+		},
+		"corruptAmount": {
+			donations:   "#schema=donations/v4\nid,created,client_name,client_email,payout_id,gross,fee,net,currency,policy\ntxn_1,2025-03-01T10:15:00Z,Ana,ana@example.com,po_1,1O0,10,90,ron,default\n",
+			expectedErr: `donation txn_1: gross: invalid amount "1O0"`,
+		},
+		"olderVersionNeedsMigrate": {
+			donations:   "#schema=donations/v3\nid,created,client_name,client_email,payout_id,gross,fee,net,policy\n",
+			expectedErr: "run `cli migrate`",
+		},
+		"displayDatesMigrated": {
+			donations:       "#schema=donations/v2\nid,created,client_name,client_email,payout_id,gross,fee,net,policy\ntxn_1,1 Mar 2025,Ana,ana@example.com,po_1,100,10,90,default\n",
+			migrateFirst:    true,
+			expectedEmail:   "ana@example.com",
+			expectedCreated: day(1, time.March),
+		},
+		"legacyFileMigrated": {
+			donations:       "Id,Created,Name,Email,Payout,Gross,Fee,Net\ntxn_1,1 Mar 2025,Ana,ana@example.com,po_1,100,10,90\n",
+			migrateFirst:    true,
+			expectedEmail:   "ana@example.com",
+			expectedCreated: day(1, time.March),
+		},
+		"headerlessLegacyFileMigrated": {
+			donations:       "txn_1,1 Mar 2025,Ana,ana@example.com,po_1,100,10,90\n",
+			migrateFirst:    true,
+			expectedEmail:   "ana@example.com",
+			expectedCreated: day(1, time.March),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := newTestCSVRepo(t)
+			if err := os.WriteFile(r.DonationsFile, []byte(tc.donations), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tc.migrateFirst {
+				results, err := r.Migrate()
+				if err != nil {
+					t.Fatalf("Migrate failed: %v", err)
+				}
+				if len(results) != 2 || !results[1].Migrated() || results[1].Rows != 1 {
+					t.Errorf("Expected donations to be migrated, got %+v", results)
+				}
+			}
+
+			donations, err := r.loadDonations()
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error containing %q, got: %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadDonations failed: %v", err)
+			}
+			if len(donations) != 1 || donations[0].ClientEmail != tc.expectedEmail || donations[0].Id != "txn_1" || !donations[0].Gross.Equal(lei(100)) {
+				t.Errorf("Expected txn_1 from %s, got %+v", tc.expectedEmail, donations)
+			} else if !donations[0].Created.Equal(tc.expectedCreated) {
+				t.Errorf("Expected created %s, got %s", tc.expectedCreated, donations[0].Created)
+			}
+		})
+	}
+}
+
+func TestWritesKeepFileModes(t *testing.T) {
+	r := newTestCSVRepo(t)
+	if err := os.Chmod(r.DonationsFile, 0640); err != nil {
+		t.Fatal(err)
+	}
+	payout, donations := testPayout("po_1")
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	q := &QuarantineRepo{Dir: filepath.Join(filepath.Dir(r.PayoutsFile), "quarantine")}
+	if err := q.WriteQuarantinedPayout(&model.QuarantinedPayout{PayoutId: "po_2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]os.FileMode{
+		r.PayoutsFile:   0644,
+		r.DonationsFile: 0640,
+		r.LedgerFile:    0644,
+		q.path("po_2"):  0644,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != expected {
+			t.Errorf("Expected %s to have mode %v, got %v", filepath.Base(path), expected, info.Mode().Perm())
+		}
+	}
+}
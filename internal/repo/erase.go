@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+// PseudonymizeDonor matches the donor by the email reads return, with
+// corrections applied, and also overwrites the old and new values in the
+// corrections of the matched donations.
+func (r *CSVRepo) PseudonymizeDonor(email string, p service.Pseudonym) ([]string, error) {
+	var ids []string
+	pseudonym := map[string]string{model.CorrectionClientName: p.Name, model.CorrectionClientEmail: p.Email}
+	err := r.rewriteDonors(func(donations, corrections *csvTable) ([]string, bool, error) {
+		effective := make(map[string]string)
+		for _, record := range corrections.records {
+			if corrections.get(record, "field") != model.CorrectionClientEmail {
+				continue
+			}
+			id := corrections.get(record, "donation_id")
+			value, err := decryptPII(r.PII, model.CorrectionClientEmail, corrections.get(record, "new_value"))
+			if err != nil {
+				return nil, false, fmt.Errorf("correction of donation %s: %w", id, err)
+			}
+			effective[id] = value
+		}
+
+		matched := make(map[string]bool)
+		for _, record := range donations.records {
+			id := donations.get(record, "id")
+			current, ok := effective[id]
+			if !ok {
+				var err error
+				if current, err = decryptPII(r.PII, "client_email", donations.get(record, "client_email")); err != nil {
+					return nil, false, fmt.Errorf("donation %s: %w", id, err)
+				}
+			}
+			if !strings.EqualFold(current, email) {
+				continue
+			}
+			for column, value := range pseudonym {
+				var err error
+				if record[donations.index[column]], err = encryptPII(r.PII, column, value); err != nil {
+					return nil, false, err
+				}
+			}
+			matched[id] = true
+			ids = append(ids, id)
+		}
+
+		for _, record := range corrections.records {
+			if !matched[corrections.get(record, "donation_id")] {
+				continue
+			}
+			field := corrections.get(record, "field")
+			for _, column := range []string{"old_value", "new_value"} {
+				var err error
+				if record[corrections.index[column]], err = encryptPII(r.PII, field, pseudonym[field]); err != nil {
+					return nil, false, err
+				}
+			}
+		}
+		return ids, len(ids) > 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (c *CachedRepo) PseudonymizeDonor(email string, p service.Pseudonym) ([]string, error) {
+	return c.Repo.PseudonymizeDonor(email, p)
+}
+
+func (r *SQLiteRepo) PseudonymizeDonor(email string, p service.Pseudonym) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM effective_donations WHERE client_email = ? COLLATE NOCASE ORDER BY position`, email)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err := tx.Exec(`UPDATE donations SET client_name = ?, client_email = ? WHERE id = ?`,
+			p.Name, p.Email, id); err != nil {
+			return nil, fmt.Errorf("failed to pseudonymize donation %s: %w", id, err)
+		}
+		pseudonym := `CASE field WHEN 'client_name' THEN ? ELSE ? END`
+		if _, err := tx.Exec(`UPDATE corrections SET old_value = `+pseudonym+`, new_value = `+pseudonym+` WHERE donation_id = ?`,
+			p.Name, p.Email, p.Name, p.Email, id); err != nil {
+			return nil, fmt.Errorf("failed to pseudonymize the corrections of donation %s: %w", id, err)
+		}
+	}
+	if err := chainDonors(tx, ids); err != nil {
+		return nil, fmt.Errorf("failed to chain the pseudonymized donations: %w", err)
+	}
+	return ids, tx.Commit()
+}
+
+// PseudonymizeDonor commits the rewrite like any other write. Earlier
+// commits still hold the donor's data until the history is rewritten.
+func (g *GitRepo) PseudonymizeDonor(email string, p service.Pseudonym) ([]string, error) {
+	ids, err := g.Store.PseudonymizeDonor(email, p)
+	if err != nil || len(ids) == 0 {
+		return ids, err
+	}
+	if err := g.Commit("Pseudonymize donor as " + p.Name); err != nil {
+		return nil, fmt.Errorf("donor was pseudonymized but not committed: %w", err)
+	}
+	return ids, nil
+}
+
+const erasureLogName = "erasures.jsonl"
+
+// ErasureLog appends one JSON line per erasure.
+type ErasureLog struct {
+	Path string
+}
+
+func NewErasureLog(dataDir string) *ErasureLog {
+	return &ErasureLog{Path: filepath.Join(dataDir, erasureLogName)}
+}
+
+func (l *ErasureLog) AppendErasure(e *service.ErasureRecord) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func TestPseudonymizeDonor(t *testing.T) {
+	key, err := GeneratePIIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := newTestCSVRepo(t)
+	if encrypted.PII, err = ParsePIIKey(key); err != nil {
+		t.Fatal(err)
+	}
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	repos := map[string]Store{
+		"csv":       NewCachedRepo(newTestCSVRepo(t)),
+		"encrypted": NewCachedRepo(encrypted),
+		"sqlite":    sqliteRepo,
+	}
+	pseudonym := service.Pseudonym{Name: "erased-1", Email: "erased-1@erased.invalid"}
+	for name, r := range repos {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"po_1", "po_2"} {
+				payout, donations := testPayout(id)
+				if id == "po_2" {
+					donations[0].ClientName, donations[0].ClientEmail = "Ion", "ion@example.com"
+				}
+				if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ids, err := r.PseudonymizeDonor("ANA@example.com", pseudonym)
+			if err != nil {
+				t.Fatalf("PseudonymizeDonor failed: %v", err)
+			}
+			if !slices.Equal(ids, []string{"txn_po_1"}) {
+				t.Errorf("Expected txn_po_1 to be rewritten, got %v", ids)
+			}
+
+			page, err := r.QueryDonations(service.DonationQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range page.Donations {
+				expected := map[string]string{"txn_po_1": "erased-1", "txn_po_2": "Ion"}[d.Id]
+				if d.ClientName != expected || !d.Gross.Equal(lei(100)) {
+					t.Errorf("Expected %s to have name %q and gross 100, got %q and %v", d.Id, expected, d.ClientName, d.Gross)
+				}
+			}
+			if ids, _ := r.PseudonymizeDonor("ana@example.com", pseudonym); len(ids) != 0 {
+				t.Errorf("Expected no rows left for the erased email, got %v", ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// GitRepo commits the data files to a git repository in Dir after every
+// successful write, and can push them to Remote on a schedule.
+type GitRepo struct {
+	Store
+	Dir    string
+	Files  []string
+	Remote string
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewGitRepo(store Store, dir string, files []string, remote string) (*GitRepo, error) {
+	g := &GitRepo{Store: store, Dir: dir, Files: files, Remote: remote}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := g.git("init", "--quiet"); err != nil {
+			return nil, fmt.Errorf("failed to init git repository in %s: %w", dir, err)
+		}
+	}
+	return g, nil
+}
+
+func (g *GitRepo) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error {
+	if err := g.Store.WritePayoutAndDonations(p, ds); err != nil {
+		return err
+	}
+	if err := g.Commit("Add payout " + p.Id); err != nil {
+		return fmt.Errorf("payout %s was written but not committed: %w", p.Id, err)
+	}
+	return nil
+}
+
+func (g *GitRepo) InitLedger() (int, error) {
+	n, err := g.Store.InitLedger()
+	if err != nil || n == 0 {
+		return n, err
+	}
+	if err := g.Commit(fmt.Sprintf("Chain %d existing rows", n)); err != nil {
+		return n, fmt.Errorf("the ledger was written but not committed: %w", err)
+	}
+	return n, nil
+}
+
+// A checkpointer moves the writes kept next to its data files into them, so
+// the committed files hold every write.
+type checkpointer interface {
+	checkpoint() error
+}
+
+func (g *GitRepo) Commit(message string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c, ok := g.Store.(checkpointer); ok {
+		if err := c.checkpoint(); err != nil {
+			return fmt.Errorf("failed to checkpoint before committing: %w", err)
+		}
+	}
+	var files []string
+	for _, f := range g.Files {
+		if _, err := os.Stat(filepath.Join(g.Dir, f)); err == nil {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	if _, err := g.git(append([]string{"add", "--"}, files...)...); err != nil {
+		return err
+	}
+	if _, err := g.git("diff", "--cached", "--quiet"); err == nil {
+		return nil
+	}
+	_, err := g.git("commit", "--quiet", "-m", message)
+	return err
+}
+
+func (g *GitRepo) Push() error {
+	if g.Remote == "" {
+		return errors.New("no git remote configured")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	branch, err := g.git("rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	_, err = g.git("push", "--quiet", g.Remote, "HEAD:refs/heads/"+branch)
+	return err
+}
+
+func (g *GitRepo) PushEvery(interval time.Duration) {
+	g.stop = make(chan struct{})
+	g.done = make(chan struct{})
+	go func() {
+		defer close(g.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := g.Push(); err != nil {
+					log.Println("git push failed:", err)
+				}
+			case <-g.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (g *GitRepo) Close() error {
+	if g.stop != nil {
+		close(g.stop)
+		<-g.done
+		g.stop = nil
+	}
+	return g.Store.Close()
+}
+
+func (g *GitRepo) git(args ...string) (string, error) {
+	subcommand := args[0]
+	args = append([]string{
+		"-C", g.Dir,
+		"-c", "user.name=hintermann-stripe-cli",
+		"-c", "user.email=contact@hintermann.ro",
+	}, args...)
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", subcommand, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitRepoCommitsAndPushes(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	remote := t.TempDir()
+	if out, err := exec.Command("git", "init", "--quiet", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare failed: %v: %s", err, out)
+	}
+
+	base := newTestCSVRepo(t)
+	dir := filepath.Dir(base.PayoutsFile)
+	g, err := NewGitRepo(NewCachedRepo(base), dir, []string{"payouts.csv", "donations.csv"}, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	for _, id := range []string{"po_1", "po_2", "po_1"} {
+		payout, donations := testPayout(id)
+		if err := g.WritePayoutAndDonations(payout, donations); err != nil {
+			t.Fatalf("write %s failed: %v", id, err)
+		}
+	}
+	if err := g.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	out, err := exec.Command("git", "-C", remote, "log", "--format=%s", "--all").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Add payout po_2\nAdd payout po_1"
+	if got := strings.TrimSpace(string(out)); got != expected {
+		t.Errorf("Expected remote log:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestGitRepoCommitsCheckpointedSQLite(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	r, err := OpenSQLiteRepo(SQLitePath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewGitRepo(r, dir, []string{filepath.Base(SQLitePath(dir))}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	payout, donations := testPayout("po_1")
+	if err := g.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+
+	committed, err := exec.Command("git", "-C", dir, "show", "HEAD:"+filepath.Base(SQLitePath(dir))).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyDir := t.TempDir()
+	if err := os.WriteFile(SQLitePath(copyDir), committed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := OpenSQLiteRepo(SQLitePath(copyDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.GetPayoutById("po_1"); err != nil {
+		t.Errorf("Expected the committed database to hold po_1, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A commit stages the new contents of every file as temp files, then writes a
+// journal listing them. Once the journal is on disk the commit is decided:
+// the temp files are renamed over their targets and the journal is removed.
+// Recover finishes a commit that has a journal and discards one that has not.
+
+// A journal entry renames Tmp over Target, or removes Target when Remove is
+// set.
+type journalEntry struct {
+	Tmp    string
+	Target string
+	Remove bool `json:",omitempty"`
+}
+
+type commit struct {
+	journalFile string
+	entries     []journalEntry
+	committed   bool
+}
+
+func (c *commit) stage(filename string, schema *csvSchema, newRows [][]string) error {
+	tmpFile, err := writeTempWithAppend(filename, schema, newRows)
+	if err != nil {
+		return err
+	}
+	c.add(tmpFile, filename)
+	return nil
+}
+
+func (c *commit) add(tmpFile, filename string) {
+	c.entries = append(c.entries, journalEntry{Tmp: tmpFile, Target: filename})
+}
+
+func (c *commit) remove(filename string) {
+	c.entries = append(c.entries, journalEntry{Target: filename, Remove: true})
+}
+
+func (c *commit) apply() error {
+	if err := writeJournal(c.journalFile, c.entries); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	c.committed = true
+	return finishCommit(c.journalFile, c.entries)
+}
+
+func (c *commit) abort() {
+	if c.committed {
+		return
+	}
+	for _, e := range c.entries {
+		if !e.Remove {
+			os.Remove(e.Tmp)
+		}
+	}
+}
+
+func (r *CSVRepo) journalFile() string {
+	return r.PayoutsFile + ".journal"
+}
+
+func (r *CSVRepo) Recover() error {
+	l, err := r.lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+	return r.recoverJournal()
+}
+
+// recoverJournal must hold the exclusive lock, so every temp file it finds
+// belongs to a writer that died.
+func (r *CSVRepo) recoverJournal() error {
+	journal := r.journalFile()
+	os.Remove(journal + ".tmp")
+
+	data, err := os.ReadFile(journal)
+	if os.IsNotExist(err) {
+		return removeStagedFiles(r.PayoutsFile, r.DonationsFile, r.LedgerFile, r.CorrectionsFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []journalEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("corrupt journal %s: %w", journal, err)
+	}
+	if err := finishCommit(journal, entries); err != nil {
+		return fmt.Errorf("failed to finish journaled commit: %w", err)
+	}
+	return nil
+}
+
+func removeStagedFiles(filenames ...string) error {
+	for _, filename := range filenames {
+		staged, err := filepath.Glob(filename + ".*.tmp")
+		if err != nil {
+			return err
+		}
+		for _, tmpFile := range staged {
+			if err := os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeJournal(journal string, entries []journalEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	tmpFile := journal + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := os.Rename(tmpFile, journal); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return syncDir(filepath.Dir(journal))
+}
+
+func finishCommit(journal string, entries []journalEntry) error {
+	for _, e := range entries {
+		if e.Remove {
+			if err := os.Remove(e.Target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if _, err := os.Stat(e.Tmp); os.IsNotExist(err) {
+			// already renamed before the crash
+			continue
+		}
+		if err := os.Rename(e.Tmp, e.Target); err != nil {
+			return err
+		}
+	}
+	if err := syncDir(filepath.Dir(journal)); err != nil {
+		return err
+	}
+	if err := os.Remove(journal); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(journal))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
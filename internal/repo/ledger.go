@@ -0,0 +1,407 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+// Rows written before the ledger existed are chained, in file order, once by
+// InitLedger. Writes refuse to start a ledger while unchained rows are
+// stored, so a deleted ledger is never rebuilt from changed rows. Ledgers
+// started before donor entries existed get them from InitLedger too.
+
+var errUnchainedRows = errors.New("rows are stored but the ledger is empty, chain them once with verify-chain -init")
+
+func (r *CSVRepo) GetLedger() ([]*service.LedgerEntry, error) {
+	l, err := r.rlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	t, err := readTable(r.LedgerFile, ledgerSchema)
+	if err != nil {
+		return nil, err
+	}
+	return ledgerFromTable(t)
+}
+
+func (r *CSVRepo) GetLedgerHead() (*service.LedgerEntry, error) {
+	entries, err := r.GetLedger()
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return entries[len(entries)-1], nil
+}
+
+// InitLedger chains the stored rows into an empty ledger, or the donor
+// entries missing from a ledger with entries.
+func (r *CSVRepo) InitLedger() (int, error) {
+	if r.LedgerFile == "" {
+		return 0, errNoLedgerFile
+	}
+	l, err := r.lock()
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	if err := r.recoverJournal(); err != nil {
+		return 0, err
+	}
+	t, err := readTable(r.LedgerFile, ledgerSchema)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := ledgerFromTable(t)
+	if err != nil {
+		return 0, err
+	}
+	payoutsTable, err := readTable(r.PayoutsFile, payoutsSchema)
+	if err != nil {
+		return 0, err
+	}
+	stored, err := payoutsFromTable(payoutsTable)
+	if err != nil {
+		return 0, err
+	}
+	donationsTable, err := readTable(r.DonationsFile, donationsSchema)
+	if err != nil {
+		return 0, err
+	}
+	donations, err := r.donationsFromTable(donationsTable)
+	if err != nil {
+		return 0, err
+	}
+	correctionsTable, err := readTable(r.CorrectionsFile, correctionsSchema)
+	if err != nil {
+		return 0, err
+	}
+	corrections, err := r.correctionsFromTable(correctionsTable)
+	if err != nil {
+		return 0, err
+	}
+	chained, err := initEntries(entries, stored, donations, corrections)
+	if err != nil {
+		return 0, err
+	}
+	records := ledgerRecords(chained)
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	c := &commit{journalFile: r.journalFile()}
+	defer c.abort()
+	if err := c.stage(r.LedgerFile, ledgerSchema, records); err != nil {
+		return 0, err
+	}
+	if err := c.apply(); err != nil {
+		return 0, fmt.Errorf("failed to commit the ledger: %w", err)
+	}
+	return len(records), nil
+}
+
+// initEntries chains every row into an empty ledger, or only the donor
+// entries the ledger is missing.
+func initEntries(entries []*service.LedgerEntry, payouts []*model.Payout, donations []*model.Donation, corrections []*model.Correction) ([]*service.LedgerEntry, error) {
+	if len(entries) == 0 {
+		return service.ChainLedger(nil, payouts, donations, corrections), nil
+	}
+	chained := make(map[string]bool)
+	for _, e := range entries {
+		if e.Kind == service.LedgerDonor {
+			chained[e.Id] = true
+		}
+	}
+	var missing []*model.Donation
+	for _, d := range donations {
+		if !chained[d.Id] {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) == 0 {
+		return nil, fmt.Errorf("the ledger already has %d entries", len(entries))
+	}
+	return service.ChainDonors(entries[len(entries)-1], missing, corrections), nil
+}
+
+// ledgerHead must hold the exclusive lock.
+func (r *CSVRepo) ledgerHead() (*service.LedgerEntry, error) {
+	t, err := readTable(r.LedgerFile, ledgerSchema)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ledgerFromTable(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return entries[len(entries)-1], nil
+	}
+	stored, err := readTable(r.PayoutsFile, payoutsSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored.records) > 0 {
+		return nil, errUnchainedRows
+	}
+	return nil, nil
+}
+
+// nextLedgerRecords must hold the exclusive lock.
+func (r *CSVRepo) nextLedgerRecords(payouts []*model.Payout, ds []*model.Donation) ([][]string, error) {
+	head, err := r.ledgerHead()
+	if err != nil {
+		return nil, err
+	}
+	return ledgerRecords(service.ChainLedger(head, payouts, ds, nil)), nil
+}
+
+// donorLedgerRecords chains the donor data of the donations ids, as the
+// tables about to be committed hold it. It must hold the exclusive lock.
+func (r *CSVRepo) donorLedgerRecords(donations, corrections *csvTable, ids []string) ([][]string, error) {
+	head, err := r.ledgerHead()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := r.donationsFromTable(donations)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := r.correctionsFromTable(corrections)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*model.Donation, len(stored))
+	for _, d := range stored {
+		byId[d.Id] = d
+	}
+	selected := make([]*model.Donation, 0, len(ids))
+	for _, id := range ids {
+		selected = append(selected, byId[id])
+	}
+	return ledgerRecords(service.ChainDonors(head, selected, cs)), nil
+}
+
+func ledgerRecords(entries []*service.LedgerEntry) [][]string {
+	records := make([][]string, len(entries))
+	for i, e := range entries {
+		records[i] = ledgerSchema.record(map[string]string{
+			"seq":       strconv.Itoa(e.Seq),
+			"kind":      e.Kind,
+			"id":        e.Id,
+			"prev_hash": e.PrevHash,
+			"hash":      e.Hash,
+		})
+	}
+	return records
+}
+
+func ledgerFromTable(t *csvTable) ([]*service.LedgerEntry, error) {
+	entries := make([]*service.LedgerEntry, len(t.records))
+	for i, record := range t.records {
+		seq, err := strconv.Atoi(t.get(record, "seq"))
+		if err != nil {
+			return nil, fmt.Errorf("ledger line %d: invalid seq %q", i+3, t.get(record, "seq"))
+		}
+		entries[i] = &service.LedgerEntry{
+			Seq:      seq,
+			Kind:     t.get(record, "kind"),
+			Id:       t.get(record, "id"),
+			PrevHash: t.get(record, "prev_hash"),
+			Hash:     t.get(record, "hash"),
+		}
+	}
+	return entries, nil
+}
+
+func (c *CachedRepo) GetLedger() ([]*service.LedgerEntry, error) {
+	return c.Repo.GetLedger()
+}
+
+func (c *CachedRepo) GetLedgerHead() (*service.LedgerEntry, error) {
+	return c.Repo.GetLedgerHead()
+}
+
+func (c *CachedRepo) InitLedger() (int, error) {
+	return c.Repo.InitLedger()
+}
+
+func (r *SQLiteRepo) GetLedger() ([]*service.LedgerEntry, error) {
+	rows, err := r.db.Query(`SELECT seq, kind, id, prev_hash, hash FROM ledger ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*service.LedgerEntry
+	for rows.Next() {
+		e, err := scanLedgerEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteRepo) GetLedgerHead() (*service.LedgerEntry, error) {
+	e, err := scanLedgerEntry(r.db.QueryRow(`SELECT seq, kind, id, prev_hash, hash FROM ledger ORDER BY seq DESC LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return e, err
+}
+
+// InitLedger chains the stored rows into an empty ledger, or the donor
+// entries missing from a ledger with entries.
+func (r *SQLiteRepo) InitLedger() (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT seq, kind, id, prev_hash, hash FROM ledger ORDER BY seq`)
+	if err != nil {
+		return 0, err
+	}
+	var existing []*service.LedgerEntry
+	for rows.Next() {
+		e, err := scanLedgerEntry(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		existing = append(existing, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	stored, donations, err := allRows(tx)
+	if err != nil {
+		return 0, err
+	}
+	corrections, err := queryCorrections(tx, `ORDER BY seq`)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := initEntries(existing, stored, donations, corrections)
+	if err != nil {
+		return 0, err
+	}
+	if err := insertLedgerEntries(tx, entries); err != nil {
+		return 0, err
+	}
+	return len(entries), tx.Commit()
+}
+
+// ledgerHead reads the head inside a write's transaction.
+func ledgerHead(tx *sql.Tx) (*service.LedgerEntry, error) {
+	head, err := scanLedgerEntry(tx.QueryRow(`SELECT seq, kind, id, prev_hash, hash FROM ledger ORDER BY seq DESC LIMIT 1`))
+	if errors.Is(err, sql.ErrNoRows) {
+		var stored bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM payouts)`).Scan(&stored); err != nil {
+			return nil, err
+		}
+		if stored {
+			return nil, errUnchainedRows
+		}
+		return nil, nil
+	}
+	return head, err
+}
+
+// chainLedger appends the ledger entries for payouts and ds inside the
+// write's transaction, before they are inserted.
+func (r *SQLiteRepo) chainLedger(tx *sql.Tx, payouts []*model.Payout, ds []*model.Donation) error {
+	head, err := ledgerHead(tx)
+	if err != nil {
+		return err
+	}
+	return insertLedgerEntries(tx, service.ChainLedger(head, payouts, ds, nil))
+}
+
+// chainDonors appends donor entries for the donations ids inside the
+// transaction that changed their names, emails or corrections.
+func chainDonors(tx *sql.Tx, ids []string) error {
+	head, err := ledgerHead(tx)
+	if err != nil {
+		return err
+	}
+	var donations []*model.Donation
+	var corrections []*model.Correction
+	for _, id := range ids {
+		d, err := scanDonation(tx.QueryRow(`SELECT id, created, client_name, client_email, payout_id, gross, fee, net, currency, policy FROM donations WHERE id = ?`, id))
+		if err != nil {
+			return fmt.Errorf("donation %s: %w", id, err)
+		}
+		cs, err := queryCorrections(tx, `WHERE donation_id = ? ORDER BY seq`, id)
+		if err != nil {
+			return err
+		}
+		donations = append(donations, d)
+		corrections = append(corrections, cs...)
+	}
+	return insertLedgerEntries(tx, service.ChainDonors(head, donations, corrections))
+}
+
+func insertLedgerEntries(tx *sql.Tx, entries []*service.LedgerEntry) error {
+	for _, e := range entries {
+		if _, err := tx.Exec(`INSERT INTO ledger (seq, kind, id, prev_hash, hash) VALUES (?, ?, ?, ?, ?)`,
+			e.Seq, e.Kind, e.Id, e.PrevHash, e.Hash); err != nil {
+			return fmt.Errorf("failed to append ledger entry %d: %w", e.Seq, err)
+		}
+	}
+	return nil
+}
+
+// allRows reads the stored rows in insertion order.
+func allRows(tx *sql.Tx) ([]*model.Payout, []*model.Donation, error) {
+	rows, err := tx.Query(`SELECT id, created, gross, fee, net, currency FROM payouts ORDER BY rowid`)
+	if err != nil {
+		return nil, nil, err
+	}
+	var payouts []*model.Payout
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = tx.Query(`SELECT id, created, client_name, client_email, payout_id, gross, fee, net, currency, policy FROM donations ORDER BY rowid`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var donations []*model.Donation
+	for rows.Next() {
+		d, err := scanDonation(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		donations = append(donations, d)
+	}
+	return payouts, donations, rows.Err()
+}
+
+func scanLedgerEntry(row scanner) (*service.LedgerEntry, error) {
+	var e service.LedgerEntry
+	if err := row.Scan(&e.Seq, &e.Kind, &e.Id, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
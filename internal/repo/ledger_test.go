@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func TestLedgerChainsRowsOnBothBackends(t *testing.T) {
+	csvRepo := newTestCSVRepo(t)
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	// po_1 predates the ledger
+	for _, r := range []Store{NewCachedRepo(csvRepo), sqliteRepo} {
+		payout, donations := testPayout("po_1")
+		if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(csvRepo.LedgerFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sqliteRepo.db.Exec(`DELETE FROM ledger`); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, r := range map[string]Store{"csv": NewCachedRepo(csvRepo), "sqlite": sqliteRepo} {
+		payout, donations := testPayout("po_2")
+		if err := r.WritePayoutAndDonations(payout, donations); !errors.Is(err, errUnchainedRows) {
+			t.Errorf("%s: expected a write to refuse starting a ledger over stored rows, got %v", name, err)
+		}
+		report, err := (&service.LedgerService{Repo: r}).VerifyChain()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Break == nil || report.Break.Id != "po_1" {
+			t.Errorf("%s: expected the missing ledger to break the chain at po_1, got %+v", name, report.Break)
+		}
+		if n, err := r.InitLedger(); err != nil || n != 3 {
+			t.Fatalf("%s: expected po_1, its donation and its donor to be chained, got %d, %v", name, n, err)
+		}
+		if _, err := r.InitLedger(); err == nil {
+			t.Errorf("%s: expected InitLedger to refuse a ledger with entries", name)
+		}
+	}
+
+	heads := make(map[string]*service.LedgerEntry)
+	for name, r := range map[string]Store{"csv": NewCachedRepo(csvRepo), "sqlite": sqliteRepo} {
+		t.Run(name, func(t *testing.T) {
+			payout, donations := testPayout("po_2")
+			if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+				t.Fatal(err)
+			}
+			report, err := (&service.LedgerService{Repo: r}).VerifyChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Break != nil || report.Entries != 6 {
+				t.Fatalf("Expected an intact chain of 6 entries, got %d and %+v", report.Entries, report.Break)
+			}
+			head, err := r.GetLedgerHead()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *head != *report.Head {
+				t.Errorf("Expected head %+v, got %+v", report.Head, head)
+			}
+			heads[name] = head
+		})
+	}
+	if heads["csv"] != nil && heads["sqlite"] != nil && heads["csv"].Hash != heads["sqlite"].Hash {
+		t.Errorf("Expected the same rows to chain to the same head, got %s and %s", heads["csv"].Hash, heads["sqlite"].Hash)
+	}
+
+	if _, err := sqliteRepo.db.Exec(`UPDATE payouts SET net = 80 WHERE id = 'po_1'`); err != nil {
+		t.Fatal(err)
+	}
+	report, err := (&service.LedgerService{Repo: sqliteRepo}).VerifyChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Break == nil || report.Break.Seq != 1 {
+		t.Errorf("Expected the changed payout to break the chain at #1, got %+v", report.Break)
+	}
+}
+
+func TestLedgerDetectsDonorEdits(t *testing.T) {
+	csvRepo := newTestCSVRepo(t)
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	edits := map[string]struct {
+		r    Store
+		edit func() error
+	}{
+		"csv": {NewCachedRepo(csvRepo), func() error {
+			data, err := os.ReadFile(csvRepo.DonationsFile)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(csvRepo.DonationsFile, []byte(strings.Replace(string(data), ",Ana,", ",Ion,", 1)), 0644)
+		}},
+		"sqlite": {sqliteRepo, func() error {
+			_, err := sqliteRepo.db.Exec(`UPDATE donations SET client_name = 'Ion' WHERE id = 'txn_po_1'`)
+			return err
+		}},
+	}
+	for name, tc := range edits {
+		t.Run(name, func(t *testing.T) {
+			payout, donations := testPayout("po_1")
+			if err := tc.r.WritePayoutAndDonations(payout, donations); err != nil {
+				t.Fatal(err)
+			}
+			if err := tc.edit(); err != nil {
+				t.Fatal(err)
+			}
+			report, err := (&service.LedgerService{Repo: tc.r}).VerifyChain()
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := &service.ChainBreak{Seq: 3, Kind: service.LedgerDonor, Id: "txn_po_1", Reason: "row was changed after it was chained"}
+			if report.Break == nil || *report.Break != *expected {
+				t.Errorf("Expected the edited name to break the chain at %+v, got %+v", expected, report.Break)
+			}
+		})
+	}
+}
+
+func TestOpenLeavesTheLedgerAlone(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payout, donations := testPayout("po_1")
+	if err := store.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	ledger := filepath.Join(dir, "ledger.csv")
+	if err := os.Remove(ledger); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = Open(Config{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := os.Stat(ledger); !os.IsNotExist(err) {
+		t.Errorf("Expected Open not to rebuild the ledger, got %v", err)
+	}
+}
+
+func TestCSVRepoRequiresLedgerFile(t *testing.T) {
+	r := newTestCSVRepo(t)
+	r.LedgerFile = ""
+	payout, donations := testPayout("po_1")
+	if err := r.WritePayoutAndDonations(payout, donations); !errors.Is(err, errNoLedgerFile) {
+		t.Errorf("Expected a write without a ledger file to fail, got %v", err)
+	}
+	if _, err := r.InitLedger(); !errors.Is(err, errNoLedgerFile) {
+		t.Errorf("Expected InitLedger without a ledger file to fail, got %v", err)
+	}
+}
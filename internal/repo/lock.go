@@ -0,0 +1,61 @@
+package repo
+
+import (
+	"errors"
+	"os"
+)
+
+var errLocked = errors.New("locked by another process")
+
+type fileLock struct {
+	f *os.File
+}
+
+func lockFile(path string, exclusive bool) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := flock(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+// tryLockFile takes an exclusive lock, or fails with errLocked instead of
+// waiting for it.
+func tryLockFile(path string) (*fileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryFlock(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileLock{f: f}, nil
+}
+
+func (l *fileLock) unlock() error {
+	if l == nil {
+		return nil
+	}
+	if err := funlock(l.f); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+func (r *CSVRepo) lockFile() string {
+	return r.PayoutsFile + ".lock"
+}
+
+func (r *CSVRepo) lock() (*fileLock, error) {
+	return lockFile(r.lockFile(), true)
+}
+
+func (r *CSVRepo) rlock() (*fileLock, error) {
+	return lockFile(r.lockFile(), false)
+}
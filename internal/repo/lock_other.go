@@ -0,0 +1,20 @@
+//go:build !unix
+
+package repo
+
+import "os"
+
+// Advisory locking is only implemented with flock; elsewhere writers are
+// not protected against each other.
+
+func flock(f *os.File, exclusive bool) error {
+	return nil
+}
+
+func tryFlock(f *os.File) error {
+	return nil
+}
+
+func funlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+)
+
+type MigrationResult struct {
+	File string
+	From int
+	To   int
+	Rows int
+}
+
+func (r MigrationResult) Migrated() bool {
+	return r.From != r.To
+}
+
+// Migrate upgrades both CSV files to the current schema versions in one
+// journaled commit. Files without a schema marker are read positionally.
+func (r *CSVRepo) Migrate() ([]MigrationResult, error) {
+	l, err := r.lock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	if err := r.recoverJournal(); err != nil {
+		return nil, err
+	}
+
+	c := &commit{journalFile: r.journalFile()}
+	defer c.abort()
+
+	var results []MigrationResult
+	files := []struct {
+		filename string
+		schema   *csvSchema
+	}{
+		{r.PayoutsFile, payoutsSchema},
+		{r.DonationsFile, donationsSchema},
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.filename); os.IsNotExist(err) {
+			continue
+		}
+		t, err := readAnyVersion(f.filename, f.schema)
+		if err != nil {
+			return nil, err
+		}
+		result := MigrationResult{File: f.filename, From: t.version, To: f.schema.current(), Rows: len(t.records)}
+		results = append(results, result)
+		if !result.Migrated() {
+			continue
+		}
+		if err := t.upgrade(); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.filename, err)
+		}
+		tmpFile, err := writeTemp(f.filename, t)
+		if err != nil {
+			return nil, err
+		}
+		c.add(tmpFile, f.filename)
+	}
+
+	if len(c.entries) == 0 {
+		return results, nil
+	}
+	if err := c.apply(); err != nil {
+		return nil, fmt.Errorf("failed to commit migration: %w", err)
+	}
+	return results, nil
+}
@@ -0,0 +1,151 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+const (
+	BackendCSV    = "csv"
+	BackendSQLite = "sqlite"
+)
+
+type Store interface {
+	service.Reader
+	service.Writer
+	service.ExportReader
+	service.RawReader
+	service.DonorEraser
+	service.LedgerReader
+	service.LedgerInitializer
+	service.CorrectionStore
+	service.DonorReplacer
+	Close() error
+}
+
+type Config struct {
+	Backend         string
+	DataDir         string
+	GitCommit       bool
+	GitRemote       string
+	GitPushInterval time.Duration
+	PII             *PIICipher
+}
+
+func ConfigFromEnv(dataDir string) (Config, error) {
+	cfg := Config{
+		Backend:   os.Getenv("REPO_BACKEND"),
+		DataDir:   dataDir,
+		GitCommit: os.Getenv("DATA_GIT_COMMIT") == "1",
+		GitRemote: os.Getenv("DATA_GIT_REMOTE"),
+	}
+	if interval := os.Getenv("DATA_GIT_PUSH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DATA_GIT_PUSH_INTERVAL: %w", err)
+		}
+		cfg.GitPushInterval = d
+	}
+	pii, err := LoadPIICipher()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.PII = pii
+	return cfg, nil
+}
+
+func Open(cfg Config) (Store, error) {
+	var store Store
+	var files []string
+	switch cfg.Backend {
+	case "", BackendCSV:
+		r := NewCSVRepo(cfg.DataDir)
+		r.PII = cfg.PII
+		if err := r.Recover(); err != nil {
+			return nil, fmt.Errorf("failed to recover %s: %w", cfg.DataDir, err)
+		}
+		store = NewCachedRepo(r)
+		files = []string{filepath.Base(r.PayoutsFile), filepath.Base(r.DonationsFile), filepath.Base(r.LedgerFile), filepath.Base(r.CorrectionsFile)}
+	case BackendSQLite:
+		if cfg.PII != nil {
+			return nil, fmt.Errorf("PII encryption is only supported by the %s backend", BackendCSV)
+		}
+		r, err := OpenSQLiteRepo(SQLitePath(cfg.DataDir))
+		if err != nil {
+			return nil, err
+		}
+		store = r
+		files = []string{filepath.Base(SQLitePath(cfg.DataDir))}
+	default:
+		return nil, fmt.Errorf("unknown repo backend %q, expected %s or %s", cfg.Backend, BackendCSV, BackendSQLite)
+	}
+
+	if !cfg.GitCommit {
+		return store, nil
+	}
+	g, err := NewGitRepo(store, cfg.DataDir, files, cfg.GitRemote)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if cfg.GitRemote != "" && cfg.GitPushInterval > 0 {
+		g.PushEvery(cfg.GitPushInterval)
+	}
+	return g, nil
+}
+
+func NewCSVRepo(dataDir string) *CSVRepo {
+	return &CSVRepo{
+		DonationsFile:   filepath.Join(dataDir, "donations.csv"),
+		PayoutsFile:     filepath.Join(dataDir, "payouts.csv"),
+		LedgerFile:      filepath.Join(dataDir, "ledger.csv"),
+		CorrectionsFile: filepath.Join(dataDir, "corrections.csv"),
+	}
+}
+
+func SQLitePath(dataDir string) string {
+	return filepath.Join(dataDir, "hintermann.db")
+}
+
+func (r *CSVRepo) Close() error {
+	return nil
+}
+
+func MigrateCSVToSQLite(src *CSVRepo, dst *SQLiteRepo) (int, int, error) {
+	payouts, err := src.loadPayouts()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load payouts: %w", err)
+	}
+	donations, corrections, err := src.loadStoredDonations()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load donations: %w", err)
+	}
+
+	byPayout := make(map[string][]*model.Donation)
+	for _, p := range payouts {
+		byPayout[p.Id] = nil
+	}
+	for _, d := range donations {
+		if _, ok := byPayout[d.PayoutId]; !ok {
+			return 0, 0, fmt.Errorf("donation %s references unknown payout %s", d.Id, d.PayoutId)
+		}
+		byPayout[d.PayoutId] = append(byPayout[d.PayoutId], d)
+	}
+
+	for _, p := range payouts {
+		if err := dst.WritePayoutAndDonations(p, byPayout[p.Id]); err != nil {
+			return 0, 0, fmt.Errorf("failed to migrate payout %s: %w", p.Id, err)
+		}
+	}
+	for _, c := range corrections {
+		if err := dst.WriteCorrection(c); err != nil {
+			return 0, 0, fmt.Errorf("failed to migrate a correction of donation %s: %w", c.DonationId, err)
+		}
+	}
+	return len(payouts), len(donations), nil
+}
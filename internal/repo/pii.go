@@ -0,0 +1,221 @@
+package repo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Donor names and emails are stored as
+//
+//	enc:v1:<key id>:<wrapped data key>:<ciphertext>
+//
+// Every value has its own random AES-256 data key, sealed with the master
+// key. The key id names the master key so a wrong key fails clearly. Values
+// without the prefix are plaintext rows written before encryption was
+// enabled; `cli rotate-key` encrypts them.
+
+const piiPrefix = "enc:v1:"
+
+var piiColumns = []string{"client_name", "client_email"}
+
+type PIICipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func NewPIICipher(key []byte) (*PIICipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("PII key must be 32 bytes, got %d", len(key))
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &PIICipher{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+// LoadPIICipher reads a base64 key from PII_KEY or from the file named by
+// PII_KEY_FILE. Without either, PII is stored in plain text.
+func LoadPIICipher() (*PIICipher, error) {
+	encoded := os.Getenv("PII_KEY")
+	if path := os.Getenv("PII_KEY_FILE"); path != "" {
+		if encoded != "" {
+			return nil, errors.New("set PII_KEY or PII_KEY_FILE, not both")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PII key: %w", err)
+		}
+		encoded = string(data)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+	return ParsePIIKey(encoded)
+}
+
+func ParsePIIKey(encoded string) (*PIICipher, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("PII key is not base64: %w", err)
+	}
+	return NewPIICipher(key)
+}
+
+// GeneratePIIKey returns a new random key in the format ParsePIIKey reads.
+func GeneratePIIKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func (c *PIICipher) Id() string {
+	return c.id
+}
+
+// encrypt binds the ciphertext to its column, so a name cannot be swapped
+// into the email column unnoticed. Empty values stay empty.
+func (c *PIICipher) encrypt(column, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(c.aead, dataKey, []byte(c.id))
+	if err != nil {
+		return "", err
+	}
+	dataAead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAead, []byte(plaintext), []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return piiPrefix + c.id + ":" +
+		base64.RawStdEncoding.EncodeToString(wrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptPII(c *PIICipher, column, value string) (string, error) {
+	if !strings.HasPrefix(value, piiPrefix) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, piiPrefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("%s is not a valid encrypted value", column)
+	}
+	if c == nil {
+		return "", fmt.Errorf("%s is encrypted with key %s but no PII key is configured", column, parts[0])
+	}
+	if parts[0] != c.id {
+		return "", fmt.Errorf("%s is encrypted with key %s, not the configured key %s", column, parts[0], c.id)
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", column, err)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", column, err)
+	}
+	dataKey, err := open(c.aead, wrapped, []byte(c.id))
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to unwrap data key: %w", column, err)
+	}
+	dataAead, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAead, sealed, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to decrypt: %w", column, err)
+	}
+	return string(plaintext), nil
+}
+
+func encryptPII(c *PIICipher, column, plaintext string) (string, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+	return c.encrypt(column, plaintext)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// RotatePIIKey re-encrypts every donor name and email, including those in
+// the corrections, with next in one journaled commit. Plaintext rows are
+// encrypted, and a nil next decrypts everything.
+func (r *CSVRepo) RotatePIIKey(next *PIICipher) (int, error) {
+	rows := 0
+	err := r.rewriteDonors(func(donations, corrections *csvTable) ([]string, bool, error) {
+		for _, record := range donations.records {
+			for _, column := range piiColumns {
+				if err := rotateValue(r.PII, next, column, record, donations.index[column]); err != nil {
+					return nil, false, fmt.Errorf("donation %s: %w", donations.get(record, "id"), err)
+				}
+			}
+			rows++
+		}
+		for _, record := range corrections.records {
+			field := corrections.get(record, "field")
+			for _, column := range []string{"old_value", "new_value"} {
+				if err := rotateValue(r.PII, next, field, record, corrections.index[column]); err != nil {
+					return nil, false, fmt.Errorf("correction of donation %s: %w", corrections.get(record, "donation_id"), err)
+				}
+			}
+		}
+		// re-encrypting leaves the plaintext, and so the ledger, unchanged
+		return nil, rows > 0 || len(corrections.records) > 0, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to rotate PII key: %w", err)
+	}
+	r.PII = next
+	return rows, nil
+}
+
+func rotateValue(current, next *PIICipher, column string, record []string, i int) error {
+	plaintext, err := decryptPII(current, column, record[i])
+	if err != nil {
+		return err
+	}
+	record[i], err = encryptPII(next, column, plaintext)
+	return err
+}
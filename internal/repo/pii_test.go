@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPIIEncryption(t *testing.T) {
+	newCipher := func() *PIICipher {
+		key, err := GeneratePIIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := ParsePIIKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	assertEmail := func(r *CSVRepo, expectedErr string) {
+		t.Helper()
+		donations, err := r.loadDonations()
+		if expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), expectedErr) {
+				t.Errorf("Expected error containing %q, got: %v", expectedErr, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("loadDonations failed: %v", err)
+		}
+		for _, d := range donations {
+			if d.ClientEmail != "ana@example.com" || d.ClientName != "Ana" {
+				t.Errorf("Expected decrypted PII, got %q %q", d.ClientName, d.ClientEmail)
+			}
+		}
+	}
+	fileContains := func(r *CSVRepo, s string) bool {
+		data, err := os.ReadFile(r.DonationsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(string(data), s)
+	}
+
+	r := newTestCSVRepo(t)
+	payout, donations := testPayout("po_1")
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+
+	first := newCipher()
+	r.PII = first
+	payout, donations = testPayout("po_2")
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatal(err)
+	}
+	assertEmail(r, "")
+
+	if n, err := r.RotatePIIKey(first); err != nil || n != 2 {
+		t.Fatalf("Expected 2 rows encrypted, got %d (%v)", n, err)
+	}
+	if fileContains(r, "ana@example.com") || fileContains(r, "Ana") {
+		t.Errorf("Expected no plaintext PII in %s", r.DonationsFile)
+	}
+	assertEmail(&CSVRepo{DonationsFile: r.DonationsFile, PayoutsFile: r.PayoutsFile}, "no PII key is configured")
+
+	second := newCipher()
+	if _, err := r.RotatePIIKey(second); err != nil {
+		t.Fatalf("RotatePIIKey failed: %v", err)
+	}
+	assertEmail(r, "")
+	assertEmail(&CSVRepo{DonationsFile: r.DonationsFile, PayoutsFile: r.PayoutsFile, PII: first}, "not the configured key")
+
+	if _, err := r.RotatePIIKey(nil); err != nil {
+		t.Fatalf("RotatePIIKey to plaintext failed: %v", err)
+	}
+	if !fileContains(r, "ana@example.com") {
+		t.Errorf("Expected plaintext PII after decrypting")
+	}
+	assertEmail(r, "")
+}
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type QuarantineRepo struct {
+	Dir string
+}
+
+func (r *QuarantineRepo) WriteQuarantinedPayout(q *model.QuarantinedPayout) error {
+	if err := os.MkdirAll(r.Dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := r.path(q.PayoutId)
+	f, err := createTemp(path)
+	if err != nil {
+		return err
+	}
+	tmpFile := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return err
+	}
+	return nil
+}
+
+func (r *QuarantineRepo) GetQuarantinedPayout(payoutId string) (*model.QuarantinedPayout, error) {
+	data, err := os.ReadFile(r.path(payoutId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("quarantined payout not found: %s", payoutId)
+		}
+		return nil, err
+	}
+	q := &model.QuarantinedPayout{}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("invalid quarantine file for %s: %w", payoutId, err)
+	}
+	return q, nil
+}
+
+func (r *QuarantineRepo) GetQuarantinedPayouts() ([]*model.QuarantinedPayout, error) {
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var quarantined []*model.QuarantinedPayout
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		q, err := r.GetQuarantinedPayout(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			return nil, err
+		}
+		quarantined = append(quarantined, q)
+	}
+	sort.Slice(quarantined, func(i, j int) bool {
+		return quarantined[i].Quarantined.Before(quarantined[j].Quarantined)
+	})
+	return quarantined, nil
+}
+
+func (r *QuarantineRepo) path(payoutId string) string {
+	return filepath.Join(r.Dir, filepath.Base(payoutId)+".json")
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+func TestQueryDonations(t *testing.T) {
+	csvRepo := newTestCSVRepo(t)
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	payout := &model.Payout{Id: "po_1", Created: day(5, time.March), Gross: lei(700), Fee: lei(30), Net: lei(670)}
+	donations := []*model.Donation{
+		{Id: "txn_1", Created: day(1, time.March), ClientName: "Ana", ClientEmail: "ana@example.com", PayoutId: "po_1", Gross: lei(100), Fee: lei(10), Net: lei(90)},
+		{Id: "txn_2", Created: day(2, time.March), ClientName: "Ion", ClientEmail: "ion@example.com", PayoutId: "po_1", Gross: lei(400), Fee: lei(10), Net: lei(390)},
+		{Id: "txn_3", Created: day(4, time.March), ClientName: "Ana", ClientEmail: "Ana@Example.com", PayoutId: "po_1", Gross: lei(200), Fee: lei(10), Net: lei(190)},
+	}
+	for _, r := range []service.Writer{csvRepo, sqliteRepo} {
+		if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repos := map[string]service.Reader{
+		"csv":    csvRepo,
+		"cached": NewCachedRepo(csvRepo),
+		"sqlite": sqliteRepo,
+	}
+
+	testCases := map[string]struct {
+		query         service.DonationQuery
+		expectedIds   []string
+		expectedTotal int
+	}{
+		"all":          {query: service.DonationQuery{}, expectedIds: []string{"txn_1", "txn_2", "txn_3"}, expectedTotal: 3},
+		"byId":         {query: service.DonationQuery{Id: "txn_2"}, expectedIds: []string{"txn_2"}, expectedTotal: 1},
+		"byEmail":      {query: service.DonationQuery{Email: "ANA@example.com"}, expectedIds: []string{"txn_1", "txn_3"}, expectedTotal: 2},
+		"byDateRange":  {query: service.DonationQuery{From: day(2, 3), To: day(4, 3)}, expectedIds: []string{"txn_2", "txn_3"}, expectedTotal: 2},
+		"byAmount":     {query: service.DonationQuery{MinAmount: 150, MaxAmount: 400}, expectedIds: []string{"txn_2", "txn_3"}, expectedTotal: 2},
+		"sortedByDesc": {query: service.DonationQuery{Sort: service.SortByAmount, Desc: true}, expectedIds: []string{"txn_2", "txn_3", "txn_1"}, expectedTotal: 3},
+		"paginated":    {query: service.DonationQuery{Sort: service.SortByAmount, Offset: 1, Limit: 1}, expectedIds: []string{"txn_3"}, expectedTotal: 3},
+		"noMatch":      {query: service.DonationQuery{PayoutId: "po_2"}, expectedTotal: 0},
+	}
+	for repoName, r := range repos {
+		for name, tc := range testCases {
+			t.Run(repoName+"/"+name, func(t *testing.T) {
+				page, err := r.QueryDonations(tc.query)
+				if err != nil {
+					t.Fatalf("QueryDonations failed: %v", err)
+				}
+				var ids []string
+				for _, d := range page.Donations {
+					ids = append(ids, d.Id)
+				}
+				if !slices.Equal(ids, tc.expectedIds) || page.Total != tc.expectedTotal {
+					t.Errorf("Expected %v of %d, got %v of %d", tc.expectedIds, tc.expectedTotal, ids, page.Total)
+				}
+			})
+		}
+	}
+}
+
+func day(d int, m time.Month) time.Time {
+	return time.Date(2025, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestGetPayoutsBetween(t *testing.T) {
+	csvRepo := newTestCSVRepo(t)
+	sqliteRepo, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqliteRepo.Close()
+
+	for _, created := range []time.Time{day(28, time.February), day(1, time.March), day(31, time.March), day(1, time.April)} {
+		payout, donations := testPayout("po_" + created.Format("0102"))
+		payout.Created = created
+		for _, r := range []service.Writer{csvRepo, sqliteRepo} {
+			if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	repos := map[string]service.Reader{
+		"csv":    csvRepo,
+		"cached": NewCachedRepo(csvRepo),
+		"sqlite": sqliteRepo,
+	}
+	for name, r := range repos {
+		t.Run(name, func(t *testing.T) {
+			payouts, err := r.GetPayoutsBetween(day(1, time.March), day(1, time.April))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, p := range payouts {
+				ids = append(ids, p.Id)
+			}
+			if !slices.Equal(ids, []string{"po_0301", "po_0331"}) {
+				t.Errorf("Expected the March payouts, got %v", ids)
+			}
+			if payouts, err := r.GetPayoutsBetween(day(1, time.May), day(1, time.June)); err != nil || len(payouts) != 0 {
+				t.Errorf("Expected no payouts and no error, got %v, %v", payouts, err)
+			}
+		})
+	}
+}
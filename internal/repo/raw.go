@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+)
+
+// Raw rows are read without parsing dates or amounts, for `cli verify`.
+// Line numbers count the schema marker and header rows.
+
+func (r *CSVRepo) RawPayouts() ([]*service.RawRow, error) {
+	return r.rawRows(r.PayoutsFile, payoutsSchema)
+}
+
+func (r *CSVRepo) RawDonations() ([]*service.RawRow, error) {
+	return r.rawRows(r.DonationsFile, donationsSchema)
+}
+
+func (r *CSVRepo) rawRows(filename string, schema *csvSchema) ([]*service.RawRow, error) {
+	l, err := r.rlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	t, err := readExistingTable(filename, schema)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]*service.RawRow, len(t.records))
+	for i, record := range t.records {
+		rows[i] = &service.RawRow{
+			Source:   filepath.Base(filename),
+			Line:     i + 3,
+			Id:       t.get(record, "id"),
+			Created:  t.get(record, "created"),
+			PayoutId: t.get(record, "payout_id"),
+			Gross:    t.get(record, "gross"),
+			Fee:      t.get(record, "fee"),
+			Net:      t.get(record, "net"),
+			Currency: t.get(record, "currency"),
+		}
+	}
+	return rows, nil
+}
+
+func (c *CachedRepo) RawPayouts() ([]*service.RawRow, error) {
+	return c.Repo.RawPayouts()
+}
+
+func (c *CachedRepo) RawDonations() ([]*service.RawRow, error) {
+	return c.Repo.RawDonations()
+}
+
+func (r *SQLiteRepo) RawPayouts() ([]*service.RawRow, error) {
+	return r.rawRows(`SELECT rowid, id, created, '', CAST(gross AS TEXT), CAST(fee AS TEXT), CAST(net AS TEXT), currency
+		FROM payouts ORDER BY rowid`, "payouts")
+}
+
+func (r *SQLiteRepo) RawDonations() ([]*service.RawRow, error) {
+	return r.rawRows(`SELECT rowid, id, created, payout_id, CAST(gross AS TEXT), CAST(fee AS TEXT), CAST(net AS TEXT), currency
+		FROM donations ORDER BY rowid`, "donations")
+}
+
+func (r *SQLiteRepo) rawRows(query, table string) ([]*service.RawRow, error) {
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var raw []*service.RawRow
+	for rows.Next() {
+		row := &service.RawRow{Source: table}
+		if err := rows.Scan(&row.Line, &row.Id, &row.Created, &row.PayoutId, &row.Gross, &row.Fee, &row.Net, &row.Currency); err != nil {
+			return nil, err
+		}
+		raw = append(raw, row)
+	}
+	return raw, rows.Err()
+}
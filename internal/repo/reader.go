@@ -1,40 +1,51 @@
 package repo
 
 import (
-	"encoding/csv"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
 )
 
 type CSVRepo struct {
 	DonationsFile string
 	PayoutsFile   string
+	LedgerFile    string
+	// CorrectionsFile holds amendments of donor fields; reads apply them.
+	CorrectionsFile string
+	// PII encrypts donor names and emails when set.
+	PII *PIICipher
 }
 
 func (r *CSVRepo) GetPayoutsByMonth(start time.Time) ([]*model.Payout, error) {
+	payouts, err := r.GetPayoutsBetween(start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %d-%02d", start.Year(), start.Month())
+	}
+	return payouts, nil
+}
+
+func (r *CSVRepo) GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error) {
 	payouts, err := r.loadPayouts()
 	if err != nil {
 		return nil, err
 	}
+	return payoutsBetween(payouts, start, end), nil
+}
+
+func payoutsBetween(payouts []*model.Payout, start, end time.Time) []*model.Payout {
 	var filtered []*model.Payout
 	for _, p := range payouts {
-		created, err := time.Parse("2 Jan 2006", p.Created)
-		if err != nil {
-			return nil, fmt.Errorf("invalid time format for %s", p.Id)
-		}
-		end := start.AddDate(0, 1, -1)
-		if (created.Equal(start) || created.After(start)) &&
-			(created.Equal(end) || created.Before(end)) {
+		if !p.Created.Before(start) && p.Created.Before(end) {
 			filtered = append(filtered, p)
 		}
 	}
-	if len(filtered) == 0 {
-		return nil, fmt.Errorf("no payouts found for %d-%02d", start.Year(), start.Month())
-	}
-	return filtered, nil
+	return filtered
 }
 
 func (r *CSVRepo) GetPayoutById(id string) (*model.Payout, error) {
@@ -47,7 +58,7 @@ func (r *CSVRepo) GetPayoutById(id string) (*model.Payout, error) {
 			return p, nil
 		}
 	}
-	return nil, fmt.Errorf("payout not found: %s", id)
+	return nil, fmt.Errorf("payout %w: %s", service.ErrNotFound, id)
 }
 
 func (r *CSVRepo) GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error) {
@@ -64,57 +75,168 @@ func (r *CSVRepo) GetDonationsByPayoutId(payoutId string) ([]*model.Donation, er
 	return filtered, nil
 }
 
-func (r *CSVRepo) loadDonations() ([]*model.Donation, error) {
-	file, err := os.Open(r.DonationsFile)
+func (r *CSVRepo) QueryDonations(q service.DonationQuery) (*service.DonationPage, error) {
+	donations, err := r.loadDonations()
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return service.FilterDonations(donations, q)
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+func (r *CSVRepo) GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error) {
+	payouts, err := r.loadPayouts()
 	if err != nil {
 		return nil, err
 	}
+	return pageOf(payouts, cursor, limit), nil
+}
+
+func pageOf[T any](items []T, cursor, limit int) []T {
+	if cursor >= len(items) {
+		return nil
+	}
+	end := len(items)
+	if limit > 0 && cursor+limit < end {
+		end = cursor + limit
+	}
+	return items[cursor:end]
+}
+
+// loadDonations returns the donations with their corrections applied.
+func (r *CSVRepo) loadDonations() ([]*model.Donation, error) {
+	donations, corrections, err := r.loadStoredDonations()
+	if err != nil {
+		return nil, err
+	}
+	model.ApplyCorrections(donations, corrections)
+	return donations, nil
+}
 
-	donations := make([]*model.Donation, len(records)-1)
-	for i, record := range records[1:] {
+func (r *CSVRepo) loadStoredDonations() ([]*model.Donation, []*model.Correction, error) {
+	l, err := r.rlock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	t, err := readExistingTable(r.DonationsFile, donationsSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	donations, err := r.donationsFromTable(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, err := readTable(r.CorrectionsFile, correctionsSchema)
+	if err != nil {
+		return nil, nil, err
+	}
+	corrections, err := r.correctionsFromTable(ct)
+	if err != nil {
+		return nil, nil, err
+	}
+	return donations, corrections, nil
+}
+
+func (r *CSVRepo) donationsFromTable(t *csvTable) ([]*model.Donation, error) {
+	donations := make([]*model.Donation, len(t.records))
+	for i, record := range t.records {
+		created, err := parseCreated(t.get(record, "created"))
+		if err != nil {
+			return nil, fmt.Errorf("donation %s: %w", t.get(record, "id"), err)
+		}
+		gross, fee, net, err := parseAmounts(t, record)
+		if err != nil {
+			return nil, fmt.Errorf("donation %s: %w", t.get(record, "id"), err)
+		}
+		name, err := decryptPII(r.PII, "client_name", t.get(record, "client_name"))
+		if err != nil {
+			return nil, fmt.Errorf("donation %s: %w", t.get(record, "id"), err)
+		}
+		email, err := decryptPII(r.PII, "client_email", t.get(record, "client_email"))
+		if err != nil {
+			return nil, fmt.Errorf("donation %s: %w", t.get(record, "id"), err)
+		}
 		donations[i] = &model.Donation{
-			Id:          record[0],
-			Created:     record[1],
-			ClientName:  record[2],
-			ClientEmail: record[3],
-			PayoutId:    record[4],
-			Gross:       record[5],
-			Fee:         record[6],
-			Net:         record[7],
+			Id:          t.get(record, "id"),
+			Created:     created,
+			ClientName:  name,
+			ClientEmail: email,
+			PayoutId:    t.get(record, "payout_id"),
+			Gross:       gross,
+			Fee:         fee,
+			Net:         net,
+			Policy:      t.get(record, "policy"),
 		}
 	}
 	return donations, nil
 }
 
 func (r *CSVRepo) loadPayouts() ([]*model.Payout, error) {
-	file, err := os.Open(r.PayoutsFile)
+	l, err := r.rlock()
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
 	}
-	defer file.Close()
+	defer l.unlock()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	t, err := readExistingTable(r.PayoutsFile, payoutsSchema)
 	if err != nil {
 		return nil, err
 	}
+	return payoutsFromTable(t)
+}
 
-	payouts := make([]*model.Payout, len(records)-1)
-	for i, record := range records[1:] {
+func payoutsFromTable(t *csvTable) ([]*model.Payout, error) {
+	payouts := make([]*model.Payout, len(t.records))
+	for i, record := range t.records {
+		created, err := parseCreated(t.get(record, "created"))
+		if err != nil {
+			return nil, fmt.Errorf("payout %s: %w", t.get(record, "id"), err)
+		}
+		gross, fee, net, err := parseAmounts(t, record)
+		if err != nil {
+			return nil, fmt.Errorf("payout %s: %w", t.get(record, "id"), err)
+		}
 		payouts[i] = &model.Payout{
-			Id:      record[0],
-			Created: record[1],
-			Gross:   record[2],
-			Fee:     record[3],
-			Net:     record[4],
+			Id:      t.get(record, "id"),
+			Created: created,
+			Gross:   gross,
+			Fee:     fee,
+			Net:     net,
 		}
 	}
 	return payouts, nil
 }
+
+func readExistingTable(filename string, schema *csvSchema) (*csvTable, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, err
+	}
+	return readTable(filename, schema)
+}
+
+func parseCreated(created string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, created)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid created time %q", created)
+	}
+	return t.UTC(), nil
+}
+
+func formatCreated(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseAmounts(t *csvTable, record []string) (gross, fee, net model.Money, err error) {
+	currency := t.get(record, "currency")
+	if gross, err = model.ParseMoney(t.get(record, "gross"), currency); err != nil {
+		return gross, fee, net, fmt.Errorf("gross: %w", err)
+	}
+	if fee, err = model.ParseMoney(t.get(record, "fee"), currency); err != nil {
+		return gross, fee, net, fmt.Errorf("fee: %w", err)
+	}
+	if net, err = model.ParseMoney(t.get(record, "net"), currency); err != nil {
+		return gross, fee, net, fmt.Errorf("net: %w", err)
+	}
+	return gross, fee, net, nil
+}
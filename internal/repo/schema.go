@@ -0,0 +1,326 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// Every CSV file starts with a "#schema=<name>/v<version>" marker followed by
+// a header row, and columns are looked up by header name. Files written
+// before markers existed have version 0 and are read positionally by
+// `migrate` only.
+
+const schemaMarkerPrefix = "#schema="
+
+type csvSchema struct {
+	name     string
+	legacy   []string
+	versions []csvVersion
+}
+
+type csvVersion struct {
+	columns []string
+	upgrade func(row map[string]string) error
+}
+
+var payoutsSchema = &csvSchema{
+	name:   "payouts",
+	legacy: []string{"id", "created", "gross", "fee", "net"},
+	versions: []csvVersion{
+		{columns: []string{"id", "created", "gross", "fee", "net"}},
+		{columns: []string{"id", "created", "gross", "fee", "net"}, upgrade: upgradeCreated},
+		{columns: []string{"id", "created", "gross", "fee", "net", "currency"}, upgrade: upgradeCurrency},
+	},
+}
+
+var donationsSchema = &csvSchema{
+	name:   "donations",
+	legacy: []string{"id", "created", "client_name", "client_email", "payout_id", "gross", "fee", "net", "policy"},
+	versions: []csvVersion{
+		{columns: []string{"id", "created", "client_name", "client_email", "payout_id", "gross", "fee", "net"}},
+		{
+			columns: []string{"id", "created", "client_name", "client_email", "payout_id", "gross", "fee", "net", "policy"},
+			upgrade: func(row map[string]string) error {
+				if _, ok := row["policy"]; !ok {
+					row["policy"] = ""
+				}
+				return nil
+			},
+		},
+		{
+			columns: []string{"id", "created", "client_name", "client_email", "payout_id", "gross", "fee", "net", "policy"},
+			upgrade: upgradeCreated,
+		},
+		{
+			columns: []string{"id", "created", "client_name", "client_email", "payout_id", "gross", "fee", "net", "currency", "policy"},
+			upgrade: upgradeCurrency,
+		},
+	},
+}
+
+var ledgerSchema = &csvSchema{
+	name: "ledger",
+	versions: []csvVersion{
+		{columns: []string{"seq", "kind", "id", "prev_hash", "hash"}},
+	},
+}
+
+var correctionsSchema = &csvSchema{
+	name: "corrections",
+	versions: []csvVersion{
+		{columns: []string{"donation_id", "field", "old_value", "new_value", "operator", "reason", "created"}},
+	},
+}
+
+// upgradeCreated converts the "2 Jan 2006" dates of older files to RFC 3339
+// timestamps at midnight UTC. The time of day of those rows is not known.
+func upgradeCreated(row map[string]string) error {
+	created, err := time.Parse("2 Jan 2006", row["created"])
+	if err != nil {
+		return fmt.Errorf("invalid created date %q", row["created"])
+	}
+	row["created"] = formatCreated(created)
+	return nil
+}
+
+// upgradeCurrency records the currency of files that predate it; every
+// earlier payout was in lei.
+func upgradeCurrency(row map[string]string) error {
+	if row["currency"] == "" {
+		row["currency"] = model.DefaultCurrency
+	}
+	return nil
+}
+
+func (s *csvSchema) current() int {
+	return len(s.versions)
+}
+
+func (s *csvSchema) columns() []string {
+	return s.versions[len(s.versions)-1].columns
+}
+
+func (s *csvSchema) marker() string {
+	return fmt.Sprintf("%s%s/v%d", schemaMarkerPrefix, s.name, s.current())
+}
+
+func (s *csvSchema) record(row map[string]string) []string {
+	columns := s.columns()
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = row[column]
+	}
+	return record
+}
+
+type csvTable struct {
+	schema  *csvSchema
+	version int
+	header  []string
+	records [][]string
+	index   map[string]int
+}
+
+func (t *csvTable) get(record []string, column string) string {
+	i, ok := t.index[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+// readTable reads a file of the current schema version and fails on unknown,
+// missing or duplicate columns. A missing file is an empty table.
+func readTable(filename string, schema *csvSchema) (*csvTable, error) {
+	t, err := readAnyVersion(filename, schema)
+	if err != nil {
+		return nil, err
+	}
+	if t.version != schema.current() {
+		return nil, fmt.Errorf("%s is %s schema v%d but v%d is required: run `cli migrate`",
+			filename, schema.name, t.version, schema.current())
+	}
+	return t, nil
+}
+
+func readAnyVersion(filename string, schema *csvSchema) (*csvTable, error) {
+	t := &csvTable{schema: schema, version: schema.current(), header: schema.columns()}
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		t.index = columnIndex(t.header)
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	version, err := readMarker(br, schema)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	t.version = version
+
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(records) == 0 {
+		if version == 0 {
+			t.version = schema.current()
+		}
+		t.index = columnIndex(t.header)
+		return t, nil
+	}
+
+	if version == 0 {
+		t.header = schema.legacy
+		t.records = records
+		if schema.isLegacyHeader(records[0]) {
+			t.records = records[1:]
+		}
+		t.index = columnIndex(t.header)
+		return t, nil
+	}
+
+	if version > schema.current() {
+		return nil, fmt.Errorf("%s is %s schema v%d, newer than the supported v%d", filename, schema.name, version, schema.current())
+	}
+	t.header = records[0]
+	t.records = records[1:]
+	if err := checkColumns(t.header, schema.versions[version-1].columns); err != nil {
+		return nil, fmt.Errorf("%s (%s schema v%d): %w", filename, schema.name, version, err)
+	}
+	t.index = columnIndex(t.header)
+	return t, nil
+}
+
+// isLegacyHeader reports whether a version 0 file starts with a header row,
+// named like the legacy id column. Files appended to before headers were
+// written start with a data row.
+func (s *csvSchema) isLegacyHeader(record []string) bool {
+	return len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), s.legacy[0])
+}
+
+func readMarker(br *bufio.Reader, schema *csvSchema) (int, error) {
+	first, err := br.Peek(len(schemaMarkerPrefix))
+	if err == io.EOF || (err == nil && string(first) != schemaMarkerPrefix) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	name, version, ok := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, schemaMarkerPrefix)), "/v")
+	if !ok || name != schema.name {
+		return 0, fmt.Errorf("schema marker %q does not name %s", strings.TrimSpace(line), schema.name)
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid schema version in %q", strings.TrimSpace(line))
+	}
+	return v, nil
+}
+
+func checkColumns(header, expected []string) error {
+	seen := make(map[string]bool, len(header))
+	for _, column := range header {
+		if seen[column] {
+			return fmt.Errorf("duplicate column %q", column)
+		}
+		seen[column] = true
+		if !slices.Contains(expected, column) {
+			return fmt.Errorf("unknown column %q", column)
+		}
+	}
+	for _, column := range expected {
+		if !seen[column] {
+			return fmt.Errorf("missing column %q", column)
+		}
+	}
+	return nil
+}
+
+func columnIndex(header []string) map[string]int {
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[column] = i
+	}
+	return index
+}
+
+// upgrade converts the table's records to the current schema version and
+// column order.
+func (t *csvTable) upgrade() error {
+	if t.version == t.schema.current() && slices.Equal(t.header, t.schema.columns()) {
+		return nil
+	}
+	rows := make([]map[string]string, len(t.records))
+	for i, record := range t.records {
+		row := make(map[string]string, len(t.header))
+		for j, column := range t.header {
+			if j < len(record) {
+				row[column] = record[j]
+			}
+		}
+		rows[i] = row
+	}
+
+	from := t.version
+	if from == 0 {
+		from = 1
+	}
+	for v := from; v < t.schema.current(); v++ {
+		upgrade := t.schema.versions[v].upgrade
+		if upgrade == nil {
+			continue
+		}
+		for i, row := range rows {
+			if err := upgrade(row); err != nil {
+				return fmt.Errorf("row %d to %s schema v%d: %w", i+2, t.schema.name, v+1, err)
+			}
+		}
+	}
+
+	t.records = make([][]string, len(rows))
+	for i, row := range rows {
+		t.records[i] = t.schema.record(row)
+	}
+	t.header = t.schema.columns()
+	t.index = columnIndex(t.header)
+	t.version = t.schema.current()
+	return nil
+}
+
+func (t *csvTable) write(w io.Writer) error {
+	if _, err := io.WriteString(w, t.schema.marker()+"\n"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.header); err != nil {
+		return err
+	}
+	for _, record := range t.records {
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
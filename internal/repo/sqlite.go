@@ -0,0 +1,419 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/diother/hintermann-stripe-cli/internal/service"
+	_ "modernc.org/sqlite"
+)
+
+// Timestamps are stored as RFC 3339 in UTC so they sort and compare as text.
+const sqliteTimeLayout = time.RFC3339
+
+var sqliteMigrations = []string{
+	`CREATE TABLE payouts (
+		id      TEXT PRIMARY KEY,
+		created TEXT NOT NULL,
+		gross   INTEGER NOT NULL,
+		fee     INTEGER NOT NULL,
+		net     INTEGER NOT NULL
+	);
+	CREATE INDEX payouts_created ON payouts (created);
+
+	CREATE TABLE donations (
+		id           TEXT PRIMARY KEY,
+		created      TEXT NOT NULL,
+		client_name  TEXT NOT NULL,
+		client_email TEXT NOT NULL,
+		payout_id    TEXT NOT NULL REFERENCES payouts (id),
+		gross        INTEGER NOT NULL,
+		fee          INTEGER NOT NULL,
+		net          INTEGER NOT NULL,
+		policy       TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX donations_payout_id ON donations (payout_id);
+	CREATE INDEX donations_client_email ON donations (client_email);
+	CREATE INDEX donations_created ON donations (created);`,
+
+	`UPDATE payouts SET created = created || 'T00:00:00Z' WHERE length(created) = 10;
+	UPDATE donations SET created = created || 'T00:00:00Z' WHERE length(created) = 10;`,
+
+	`ALTER TABLE payouts ADD COLUMN currency TEXT NOT NULL DEFAULT 'ron';
+	ALTER TABLE donations ADD COLUMN currency TEXT NOT NULL DEFAULT 'ron';`,
+
+	`CREATE TABLE ledger (
+		seq       INTEGER PRIMARY KEY,
+		kind      TEXT NOT NULL,
+		id        TEXT NOT NULL,
+		prev_hash TEXT NOT NULL,
+		hash      TEXT NOT NULL
+	);`,
+
+	`CREATE TABLE corrections (
+		seq         INTEGER PRIMARY KEY,
+		donation_id TEXT NOT NULL REFERENCES donations (id),
+		field       TEXT NOT NULL,
+		old_value   TEXT NOT NULL,
+		new_value   TEXT NOT NULL,
+		operator    TEXT NOT NULL,
+		reason      TEXT NOT NULL,
+		created     TEXT NOT NULL
+	);
+	CREATE INDEX corrections_donation_id ON corrections (donation_id);
+
+	-- donations with the latest correction of each donor field applied
+	CREATE VIEW effective_donations AS
+	SELECT d.rowid AS position, d.id, d.created,
+		COALESCE((SELECT c.new_value FROM corrections c
+			WHERE c.donation_id = d.id AND c.field = 'client_name' ORDER BY c.seq DESC LIMIT 1), d.client_name) AS client_name,
+		COALESCE((SELECT c.new_value FROM corrections c
+			WHERE c.donation_id = d.id AND c.field = 'client_email' ORDER BY c.seq DESC LIMIT 1), d.client_email) AS client_email,
+		d.payout_id, d.gross, d.fee, d.net, d.currency, d.policy
+	FROM donations d;`,
+}
+
+type SQLiteRepo struct {
+	db   *sql.DB
+	lock *fileLock
+}
+
+// sqliteLockFile is held shared by every open SQLiteRepo, so Restore can
+// tell that the database is in use.
+func sqliteLockFile(path string) string {
+	return path + ".lock"
+}
+
+func OpenSQLiteRepo(path string) (*SQLiteRepo, error) {
+	l, err := lockFile(sqliteLockFile(path), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %w", sqliteLockFile(path), err)
+	}
+	r, err := openSQLite(path)
+	if err != nil {
+		l.unlock()
+		return nil, err
+	}
+	r.lock = l
+	return r, nil
+}
+
+// openSQLite opens the database without the shared lock.
+func openSQLite(path string) (*SQLiteRepo, error) {
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	r := &SQLiteRepo{db: db}
+	if err := r.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// checkpoint moves the WAL into the database file and truncates it, so the
+// file alone holds every committed transaction.
+func (r *SQLiteRepo) checkpoint() error {
+	_, err := r.db.Exec(`PRAGMA wal_checkpoint(TRUNCATE)`)
+	return err
+}
+
+func (r *SQLiteRepo) Close() error {
+	err := r.db.Close()
+	if r.lock != nil {
+		r.lock.unlock()
+		r.lock = nil
+	}
+	return err
+}
+
+func (r *SQLiteRepo) migrate() error {
+	if _, err := r.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return err
+	}
+	var version int
+	if err := r.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteRepo) GetPayoutsByMonth(start time.Time) ([]*model.Payout, error) {
+	payouts, err := r.GetPayoutsBetween(start, start.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %d-%02d", start.Year(), start.Month())
+	}
+	return payouts, nil
+}
+
+func (r *SQLiteRepo) GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error) {
+	rows, err := r.db.Query(`
+		SELECT id, created, gross, fee, net, currency FROM payouts
+		WHERE created >= ? AND created < ?
+		ORDER BY created, rowid`,
+		toSQLiteTime(start), toSQLiteTime(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payouts []*model.Payout
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	return payouts, rows.Err()
+}
+
+func (r *SQLiteRepo) GetPayoutById(id string) (*model.Payout, error) {
+	row := r.db.QueryRow(`SELECT id, created, gross, fee, net, currency FROM payouts WHERE id = ?`, id)
+	p, err := scanPayout(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payout %w: %s", service.ErrNotFound, id)
+	}
+	return p, err
+}
+
+func (r *SQLiteRepo) GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.Query(`
+		SELECT id, created, gross, fee, net, currency FROM payouts
+		ORDER BY rowid
+		LIMIT ? OFFSET ?`, limit, cursor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payouts []*model.Payout
+	for rows.Next() {
+		p, err := scanPayout(rows)
+		if err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	return payouts, rows.Err()
+}
+
+func (r *SQLiteRepo) GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error) {
+	rows, err := r.db.Query(`
+		SELECT id, created, client_name, client_email, payout_id, gross, fee, net, currency, policy FROM effective_donations
+		WHERE payout_id = ?
+		ORDER BY position`, payoutId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var donations []*model.Donation
+	for rows.Next() {
+		d, err := scanDonation(rows)
+		if err != nil {
+			return nil, err
+		}
+		donations = append(donations, d)
+	}
+	return donations, rows.Err()
+}
+
+var sqliteDonationSort = map[service.DonationSort]string{
+	"":                    "created",
+	service.SortByCreated: "created",
+	service.SortByAmount:  "gross",
+	service.SortByEmail:   "client_email",
+	service.SortById:      "id",
+}
+
+func (r *SQLiteRepo) QueryDonations(q service.DonationQuery) (*service.DonationPage, error) {
+	column, ok := sqliteDonationSort[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("cannot sort by %q", q.Sort)
+	}
+	var where []string
+	var args []any
+	if q.Id != "" {
+		where, args = append(where, "id = ?"), append(args, q.Id)
+	}
+	if q.PayoutId != "" {
+		where, args = append(where, "payout_id = ?"), append(args, q.PayoutId)
+	}
+	if q.Email != "" {
+		where, args = append(where, "client_email = ? COLLATE NOCASE"), append(args, q.Email)
+	}
+	if !q.From.IsZero() {
+		where, args = append(where, "created >= ?"), append(args, toSQLiteTime(q.From))
+	}
+	if !q.To.IsZero() {
+		where, args = append(where, "created < ?"), append(args, toSQLiteTime(q.To.AddDate(0, 0, 1)))
+	}
+	if q.MinAmount > 0 {
+		where, args = append(where, "gross >= ?"), append(args, q.MinAmount)
+	}
+	if q.MaxAmount > 0 {
+		where, args = append(where, "gross <= ?"), append(args, q.MaxAmount)
+	}
+	filter := ""
+	if len(where) > 0 {
+		filter = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	page := &service.DonationPage{}
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM effective_donations `+filter, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	order := "ASC"
+	if q.Desc {
+		order = "DESC"
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.Query(`
+		SELECT id, created, client_name, client_email, payout_id, gross, fee, net, currency, policy FROM effective_donations
+		`+filter+`
+		ORDER BY `+column+` `+order+`, position `+order+`
+		LIMIT ? OFFSET ?`, append(args, limit, q.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d, err := scanDonation(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Donations = append(page.Donations, d)
+	}
+	return page, rows.Err()
+}
+
+func (r *SQLiteRepo) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM payouts WHERE id = ?`, p.Id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check existing payout: %w", err)
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	currency, err := sharedCurrency(p.Gross, p.Fee, p.Net)
+	if err != nil {
+		return fmt.Errorf("payout %s: %w", p.Id, err)
+	}
+	if err := r.chainLedger(tx, []*model.Payout{p}, ds); err != nil {
+		return fmt.Errorf("failed to chain payout %s: %w", p.Id, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO payouts (id, created, gross, fee, net, currency) VALUES (?, ?, ?, ?, ?, ?)`,
+		p.Id, toSQLiteTime(p.Created), p.Gross.Amount, p.Fee.Amount, p.Net.Amount, currency); err != nil {
+		return fmt.Errorf("failed to insert payout: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO donations (id, created, client_name, client_email, payout_id, gross, fee, net, currency, policy)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, d := range ds {
+		currency, err := sharedCurrency(d.Gross, d.Fee, d.Net)
+		if err != nil {
+			return fmt.Errorf("donation %s: %w", d.Id, err)
+		}
+		if _, err := stmt.Exec(d.Id, toSQLiteTime(d.Created), d.ClientName, d.ClientEmail, d.PayoutId,
+			d.Gross.Amount, d.Fee.Amount, d.Net.Amount, currency, d.Policy); err != nil {
+			return fmt.Errorf("failed to insert donation %s: %w", d.Id, err)
+		}
+	}
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPayout(row scanner) (*model.Payout, error) {
+	var p model.Payout
+	var created string
+	var gross, fee, net int64
+	var currency string
+	if err := row.Scan(&p.Id, &created, &gross, &fee, &net, &currency); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.Created, err = fromSQLiteTime(created); err != nil {
+		return nil, fmt.Errorf("payout %s: %w", p.Id, err)
+	}
+	p.Gross, p.Fee, p.Net = model.NewMoney(gross, currency), model.NewMoney(fee, currency), model.NewMoney(net, currency)
+	return &p, nil
+}
+
+func scanDonation(row scanner) (*model.Donation, error) {
+	var d model.Donation
+	var created string
+	var gross, fee, net int64
+	var currency string
+	if err := row.Scan(&d.Id, &created, &d.ClientName, &d.ClientEmail, &d.PayoutId, &gross, &fee, &net, &currency, &d.Policy); err != nil {
+		return nil, err
+	}
+	var err error
+	if d.Created, err = fromSQLiteTime(created); err != nil {
+		return nil, fmt.Errorf("donation %s: %w", d.Id, err)
+	}
+	d.Gross, d.Fee, d.Net = model.NewMoney(gross, currency), model.NewMoney(fee, currency), model.NewMoney(net, currency)
+	return &d, nil
+}
+
+func toSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func fromSQLiteTime(created string) (time.Time, error) {
+	t, err := time.Parse(sqliteTimeLayout, created)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid created time %q", created)
+	}
+	return t.UTC(), nil
+}
@@ -0,0 +1,57 @@
+package repo
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+func TestSQLiteRepoRoundTrip(t *testing.T) {
+	r, err := OpenSQLiteRepo(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer r.Close()
+
+	payout := &model.Payout{Id: "po_1", Created: time.Date(2025, time.March, 3, 14, 30, 5, 0, time.UTC), Gross: lei(300), Fee: lei(20), Net: lei(280)}
+	donations := []*model.Donation{
+		{Id: "txn_1", Created: day(1, time.March), ClientName: "Ana", ClientEmail: "ana@example.com", PayoutId: "po_1", Gross: lei(100), Fee: lei(10), Net: lei(90), Policy: "default"},
+		{Id: "txn_2", Created: day(2, time.March), ClientName: "Ion", ClientEmail: "ion@example.com", PayoutId: "po_1", Gross: lei(200), Fee: lei(10), Net: lei(190), Policy: "default"},
+	}
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := r.WritePayoutAndDonations(payout, donations); err != nil {
+		t.Fatalf("second write of an existing payout should be skipped, got: %v", err)
+	}
+
+	got, err := r.GetPayoutById("po_1")
+	if err != nil {
+		t.Fatalf("GetPayoutById failed: %v", err)
+	}
+	if *got != *payout {
+		t.Errorf("Expected payout %+v, got %+v", payout, got)
+	}
+
+	gotDonations, err := r.GetDonationsByPayoutId("po_1")
+	if err != nil {
+		t.Fatalf("GetDonationsByPayoutId failed: %v", err)
+	}
+	if len(gotDonations) != 2 || *gotDonations[1] != *donations[1] {
+		t.Errorf("Expected donations %+v, got %+v", donations, gotDonations)
+	}
+
+	if _, err := r.GetPayoutsByMonth(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Errorf("Expected payouts in March, got: %v", err)
+	}
+	if _, err := r.GetPayoutsByMonth(time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)); err == nil {
+		t.Errorf("Expected no payouts in April")
+	}
+
+	bad := &model.Payout{Id: "po_2", Created: day(3, time.March), Gross: model.NewMoney(100, "eur"), Fee: lei(0), Net: lei(100)}
+	if err := r.WritePayoutAndDonations(bad, nil); err == nil {
+		t.Errorf("Expected amounts in different currencies to fail")
+	}
+}
@@ -1,15 +1,31 @@
 package repo
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/diother/hintermann-stripe-cli/internal/model"
 )
 
+// errNoLedgerFile keeps a repo without a ledger path from staging its
+// ledger in the working directory.
+var errNoLedgerFile = errors.New("the repo has no ledger file")
+
 func (r *CSVRepo) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error {
+	if r.LedgerFile == "" {
+		return errNoLedgerFile
+	}
+	l, err := r.lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
+
+	if err := r.recoverJournal(); err != nil {
+		return err
+	}
 	existingIds, err := readExistingPayoutIds(r.PayoutsFile)
 	if err != nil {
 		return fmt.Errorf("failed to read existing payout IDs: %w", err)
@@ -19,114 +35,210 @@ func (r *CSVRepo) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation)
 		return nil
 	}
 
-	payoutRow := [][]string{
-		{p.Id, p.Created, p.Gross, p.Fee, p.Net},
+	if _, err := sharedCurrency(p.Gross, p.Fee, p.Net); err != nil {
+		return fmt.Errorf("payout %s: %w", p.Id, err)
 	}
-	if err := appendWithTemp(r.PayoutsFile, payoutRow); err != nil {
-		return fmt.Errorf("failed to append payout: %w", err)
+	for _, d := range ds {
+		if _, err := sharedCurrency(d.Gross, d.Fee, d.Net); err != nil {
+			return fmt.Errorf("donation %s: %w", d.Id, err)
+		}
 	}
+	payoutRow := [][]string{payoutRecord(p)}
 
 	donationRows := make([][]string, len(ds))
 	for i, d := range ds {
-		donationRows[i] = []string{
-			d.Id,
-			d.Created,
-			d.ClientName,
-			d.ClientEmail,
-			d.PayoutId,
-			d.Gross,
-			d.Fee,
-			d.Net,
+		if donationRows[i], err = r.donationRecord(d); err != nil {
+			return fmt.Errorf("failed to encrypt donation %s: %w", d.Id, err)
 		}
 	}
 
-	if err := appendWithTemp(r.DonationsFile, donationRows); err != nil {
-		return fmt.Errorf("failed to append donations: %w", err)
+	ledgerRows, err := r.nextLedgerRecords([]*model.Payout{p}, ds)
+	if err != nil {
+		return fmt.Errorf("failed to chain payout %s: %w", p.Id, err)
 	}
 
+	c := &commit{journalFile: r.journalFile()}
+	defer c.abort()
+
+	if err := c.stage(r.PayoutsFile, payoutsSchema, payoutRow); err != nil {
+		return fmt.Errorf("failed to stage payout: %w", err)
+	}
+	if err := c.stage(r.DonationsFile, donationsSchema, donationRows); err != nil {
+		return fmt.Errorf("failed to stage donations: %w", err)
+	}
+	if err := c.stage(r.LedgerFile, ledgerSchema, ledgerRows); err != nil {
+		return fmt.Errorf("failed to stage ledger: %w", err)
+	}
+	if err := c.apply(); err != nil {
+		return fmt.Errorf("failed to commit payout %s: %w", p.Id, err)
+	}
 	return nil
 }
 
-func appendWithTemp(filename string, newRows [][]string) error {
-	tmpFile := filename + ".tmp"
+func payoutRecord(p *model.Payout) []string {
+	return payoutsSchema.record(map[string]string{
+		"id":       p.Id,
+		"created":  formatCreated(p.Created),
+		"gross":    p.Gross.MinorUnits(),
+		"fee":      p.Fee.MinorUnits(),
+		"net":      p.Net.MinorUnits(),
+		"currency": p.Gross.Currency,
+	})
+}
 
-	// 1. create temp file
-	f, err := os.Create(tmpFile)
+func (r *CSVRepo) donationRecord(d *model.Donation) ([]string, error) {
+	name, err := encryptPII(r.PII, "client_name", d.ClientName)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	email, err := encryptPII(r.PII, "client_email", d.ClientEmail)
+	if err != nil {
+		return nil, err
 	}
-	w := csv.NewWriter(f)
+	return donationsSchema.record(map[string]string{
+		"id":           d.Id,
+		"created":      formatCreated(d.Created),
+		"client_name":  name,
+		"client_email": email,
+		"payout_id":    d.PayoutId,
+		"gross":        d.Gross.MinorUnits(),
+		"fee":          d.Fee.MinorUnits(),
+		"net":          d.Net.MinorUnits(),
+		"currency":     d.Gross.Currency,
+		"policy":       d.Policy,
+	}), nil
+}
 
-	defer func() {
-		w.Flush()
-		f.Close()
-		if err != nil {
-			os.Remove(tmpFile)
-		}
-	}()
+// rewriteDonors passes the stored donations and corrections to fn under the
+// lock, and writes both files back in one journaled commit if fn changed
+// any record. The donations fn returns in rechain, whose names or emails it
+// changed, get new donor entries in the same commit.
+func (r *CSVRepo) rewriteDonors(fn func(donations, corrections *csvTable) (rechain []string, changed bool, err error)) error {
+	l, err := r.lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", r.lockFile(), err)
+	}
+	defer l.unlock()
 
-	// 2. copy existing CSV
-	if _, err := os.Stat(filename); err == nil {
-		existing, err := os.Open(filename)
-		if err != nil {
-			return err
+	if err := r.recoverJournal(); err != nil {
+		return err
+	}
+	donations, err := readExistingTable(r.DonationsFile, donationsSchema)
+	if err != nil {
+		return err
+	}
+	corrections, err := readTable(r.CorrectionsFile, correctionsSchema)
+	if err != nil {
+		return err
+	}
+	rechain, changed, err := fn(donations, corrections)
+	if err != nil || !changed {
+		return err
+	}
+	var ledgerRows [][]string
+	if len(rechain) > 0 {
+		if r.LedgerFile == "" {
+			return errNoLedgerFile
 		}
-		defer existing.Close()
-		r := csv.NewReader(existing)
-		for {
-			record, err := r.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			if err := w.Write(record); err != nil {
-				return err
-			}
+		if ledgerRows, err = r.donorLedgerRecords(donations, corrections, rechain); err != nil {
+			return fmt.Errorf("failed to chain the rewritten donors: %w", err)
 		}
 	}
 
-	// 3. append new rows
-	for _, row := range newRows {
-		if err := w.Write(row); err != nil {
+	c := &commit{journalFile: r.journalFile()}
+	defer c.abort()
+	tmpFile, err := writeTemp(r.DonationsFile, donations)
+	if err != nil {
+		return err
+	}
+	c.add(tmpFile, r.DonationsFile)
+	if len(corrections.records) > 0 {
+		if tmpFile, err = writeTemp(r.CorrectionsFile, corrections); err != nil {
 			return err
 		}
+		c.add(tmpFile, r.CorrectionsFile)
 	}
-
-	w.Flush()
-	if err := w.Error(); err != nil {
-		return err
+	if len(ledgerRows) > 0 {
+		if err := c.stage(r.LedgerFile, ledgerSchema, ledgerRows); err != nil {
+			return err
+		}
 	}
-
-	// 4. atomic replace
-	return os.Rename(tmpFile, filename)
+	return c.apply()
 }
 
-func readExistingPayoutIds(filename string) (map[string]struct{}, error) {
-	ids := make(map[string]struct{})
+func writeTempWithAppend(filename string, schema *csvSchema, newRows [][]string) (string, error) {
+	t, err := readTable(filename, schema)
+	if err != nil {
+		return "", err
+	}
+	if err := t.upgrade(); err != nil {
+		return "", err
+	}
+	t.records = append(t.records, newRows...)
+	return writeTemp(filename, t)
+}
 
-	f, err := os.Open(filename)
+func writeTemp(filename string, t *csvTable) (tmpFile string, err error) {
+	f, err := createTemp(filename)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return ids, nil
-		}
-		return nil, err
+		return "", err
 	}
-	defer f.Close()
+	tmpFile = f.Name()
 
-	r := csv.NewReader(f)
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
 		}
 		if err != nil {
-			return nil, err
-		}
-		if len(record) > 0 {
-			ids[record[0]] = struct{}{}
+			os.Remove(tmpFile)
+			tmpFile = ""
 		}
+	}()
+
+	if err := t.write(f); err != nil {
+		return "", err
+	}
+	// make the temp file durable before it can be committed
+	return tmpFile, f.Sync()
+}
+
+// createTemp creates a temp file next to filename with filename's mode, or
+// 0644 for a new file, so renaming it over filename keeps it readable by
+// other users.
+func createTemp(filename string) (*os.File, error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+func readExistingPayoutIds(filename string) (map[string]struct{}, error) {
+	t, err := readTable(filename, payoutsSchema)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]struct{}, len(t.records))
+	for _, record := range t.records {
+		ids[t.get(record, "id")] = struct{}{}
 	}
 	return ids, nil
 }
+
+// sharedCurrency returns the currency of a row, which has one currency
+// column for all of its amounts.
+func sharedCurrency(gross, fee, net model.Money) (string, error) {
+	if gross.Currency != fee.Currency || gross.Currency != net.Currency {
+		return "", fmt.Errorf("amounts in different currencies: %s, %s, %s", gross.Currency, fee.Currency, net.Currency)
+	}
+	return gross.Currency, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type CorrectionStore interface {
+	GetCorrections(donationId string) ([]*model.Correction, error)
+	WriteCorrection(c *model.Correction) error
+}
+
+type AmendStore interface {
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+	CorrectionStore
+}
+
+type AmendService struct {
+	Repo AmendStore
+}
+
+// Amend records a correction of the donor's name or email. The old value is
+// the one reads return now, with earlier corrections applied.
+func (s *AmendService) Amend(donationId, field, value, operator, reason string) (*model.Correction, error) {
+	if operator == "" || reason == "" {
+		return nil, errors.New("operator and reason are required")
+	}
+	value = strings.TrimSpace(value)
+	switch field {
+	case model.CorrectionClientName:
+	case model.CorrectionClientEmail:
+		if !strings.Contains(value, "@") {
+			return nil, fmt.Errorf("invalid email %q", value)
+		}
+	default:
+		return nil, fmt.Errorf("cannot amend %q, only %s and %s", field, model.CorrectionClientName, model.CorrectionClientEmail)
+	}
+
+	donation, err := s.donation(donationId)
+	if err != nil {
+		return nil, err
+	}
+	old := donation.ClientName
+	if field == model.CorrectionClientEmail {
+		old = donation.ClientEmail
+	}
+	if old == value {
+		return nil, fmt.Errorf("donation %s already has %s %q", donationId, field, value)
+	}
+
+	c := &model.Correction{
+		DonationId: donationId,
+		Field:      field,
+		OldValue:   old,
+		NewValue:   value,
+		Operator:   operator,
+		Reason:     reason,
+		Created:    time.Now().UTC(),
+	}
+	if err := s.Repo.WriteCorrection(c); err != nil {
+		return nil, fmt.Errorf("failed to record correction: %w", err)
+	}
+	return c, nil
+}
+
+// History returns the donation with its effective values and every
+// correction made to it, oldest first.
+func (s *AmendService) History(donationId string) (*model.Donation, []*model.Correction, error) {
+	donation, err := s.donation(donationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	corrections, err := s.Repo.GetCorrections(donationId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return donation, corrections, nil
+}
+
+func (s *AmendService) donation(id string) (*model.Donation, error) {
+	if id == "" {
+		return nil, errors.New("donation id is required")
+	}
+	page, err := s.Repo.QueryDonations(DonationQuery{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Donations) == 0 {
+		return nil, fmt.Errorf("donation not found: %s", id)
+	}
+	return page.Donations[0], nil
+}
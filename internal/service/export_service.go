@@ -0,0 +1,277 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+const DefaultExportLimit = 100
+
+var (
+	ErrInvalidCursor  = errors.New("invalid cursor")
+	ErrCursorMismatch = errors.New("cursor does not match the ledger")
+)
+
+type ExportReader interface {
+	GetLedger() ([]*LedgerEntry, error)
+	GetPayoutById(id string) (*model.Payout, error)
+	GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error)
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+	GetCorrections(donationId string) ([]*model.Correction, error)
+}
+
+// DonorReplacer applies a donor change received by sync: it replaces the
+// stored name, email and corrections of a donation.
+type DonorReplacer interface {
+	ReplaceDonor(d *ExportedDonor) error
+}
+
+// ExportBatch holds the changes in ledger order. Cursor is the seq and hash
+// of the last ledger entry they cover.
+type ExportBatch struct {
+	Changes []*ExportChange
+	Cursor  string
+	More    bool
+}
+
+// ExportChange is a payout with its donations, or a later change to the
+// donor data of a donation.
+type ExportChange struct {
+	Payout *ExportedPayout `json:",omitempty"`
+	Donor  *ExportedDonor  `json:",omitempty"`
+}
+
+// ExportedPayout holds the donations as stored, before corrections.
+type ExportedPayout struct {
+	Payout    *model.Payout
+	Donations []*model.Donation
+}
+
+type ExportedDonor struct {
+	DonationId  string
+	ClientName  string
+	ClientEmail string
+	Corrections []*model.Correction
+}
+
+type ExportService struct {
+	Repo ExportReader
+}
+
+func FormatCursor(e *LedgerEntry) string {
+	if e == nil {
+		return ""
+	}
+	return strconv.Itoa(e.Seq) + ":" + e.Hash
+}
+
+// Export returns the changes chained after the ledger entry named by
+// cursor, or from the start for an empty cursor. A cursor whose entry is
+// missing or has another hash fails with ErrCursorMismatch: the ledger was
+// restored or rewritten since it was issued.
+func (s *ExportService) Export(cursor string, limit int) (*ExportBatch, error) {
+	if limit <= 0 {
+		limit = DefaultExportLimit
+	}
+	entries, err := s.Repo.GetLedger()
+	if err != nil {
+		return nil, err
+	}
+	i, err := cursorIndex(entries, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := &ExportBatch{Cursor: cursor}
+	for i < len(entries) && len(batch.Changes) < limit {
+		e := entries[i]
+		change := &ExportChange{}
+		switch e.Kind {
+		case LedgerPayout:
+			if change.Payout, err = s.exportPayout(e.Id); err != nil {
+				return nil, err
+			}
+			// skip the entries written with the payout
+			i++
+			for i < len(entries) && insertedWithPayout(entries, i) {
+				i++
+			}
+		case LedgerDonor:
+			if change.Donor, err = s.exportDonor(e.Id); err != nil {
+				return nil, err
+			}
+			i++
+		default:
+			return nil, fmt.Errorf("ledger entry #%d: %s %s does not follow its payout", e.Seq, e.Kind, e.Id)
+		}
+		batch.Changes = append(batch.Changes, change)
+		batch.Cursor = FormatCursor(entries[i-1])
+	}
+	batch.More = i < len(entries)
+	return batch, nil
+}
+
+// cursorIndex returns the index of the first entry after cursor.
+func cursorIndex(entries []*LedgerEntry, cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	seqText, hash, ok := strings.Cut(cursor, ":")
+	seq, err := strconv.Atoi(seqText)
+	if !ok || err != nil || seq < 1 {
+		return 0, fmt.Errorf("%w %q", ErrInvalidCursor, cursor)
+	}
+	if seq > len(entries) || entries[seq-1].Hash != hash {
+		return 0, fmt.Errorf("%w: entry #%d is not %s", ErrCursorMismatch, seq, hash)
+	}
+	return seq, nil
+}
+
+// insertedWithPayout reports whether entries[i] is a donation, or the
+// donor entry of the donation before it.
+func insertedWithPayout(entries []*LedgerEntry, i int) bool {
+	e, prev := entries[i], entries[i-1]
+	return e.Kind == LedgerDonation || e.Kind == LedgerDonor && prev.Kind == LedgerDonation && prev.Id == e.Id
+}
+
+func (s *ExportService) exportPayout(id string) (*ExportedPayout, error) {
+	p, err := s.Repo.GetPayoutById(id)
+	if err != nil {
+		return nil, err
+	}
+	donations, err := s.Repo.GetDonationsByPayoutId(id)
+	if err != nil {
+		return nil, err
+	}
+	exported := &ExportedPayout{Payout: p}
+	for _, d := range donations {
+		corrections, err := s.Repo.GetCorrections(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		exported.Donations = append(exported.Donations, storedDonation(d, corrections))
+	}
+	return exported, nil
+}
+
+func (s *ExportService) exportDonor(donationId string) (*ExportedDonor, error) {
+	page, err := s.Repo.QueryDonations(DonationQuery{Id: donationId})
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Donations) == 0 {
+		return nil, fmt.Errorf("donation %w: %s", ErrNotFound, donationId)
+	}
+	corrections, err := s.Repo.GetCorrections(donationId)
+	if err != nil {
+		return nil, err
+	}
+	d := storedDonation(page.Donations[0], corrections)
+	return &ExportedDonor{DonationId: d.Id, ClientName: d.ClientName, ClientEmail: d.ClientEmail, Corrections: corrections}, nil
+}
+
+// storedDonation undoes the corrections reads apply: the first correction
+// of a field holds the stored value as its old value.
+func storedDonation(d *model.Donation, corrections []*model.Correction) *model.Donation {
+	stored := *d
+	seen := make(map[string]bool)
+	for _, c := range corrections {
+		if seen[c.Field] {
+			continue
+		}
+		seen[c.Field] = true
+		(&model.Correction{Field: c.Field, NewValue: c.OldValue}).Apply(&stored)
+	}
+	return &stored
+}
+
+type SyncStore interface {
+	Writer
+	DonorReplacer
+}
+
+type SyncService struct {
+	Repo SyncStore
+}
+
+// Apply checks every change in the batch before writing any of them, and
+// writes them in order.
+func (s *SyncService) Apply(batch *ExportBatch) error {
+	for _, c := range batch.Changes {
+		var err error
+		switch {
+		case c.Payout != nil:
+			err = CheckExportedPayout(c.Payout)
+		case c.Donor != nil:
+			err = CheckExportedDonor(c.Donor)
+		default:
+			err = fmt.Errorf("exported change is empty")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, c := range batch.Changes {
+		if c.Payout != nil {
+			if err := s.Repo.WritePayoutAndDonations(c.Payout.Payout, c.Payout.Donations); err != nil {
+				return fmt.Errorf("failed to write payout %s: %w", c.Payout.Payout.Id, err)
+			}
+			continue
+		}
+		if err := s.Repo.ReplaceDonor(c.Donor); err != nil {
+			return fmt.Errorf("failed to update the donor of donation %s: %w", c.Donor.DonationId, err)
+		}
+	}
+	return nil
+}
+
+func CheckExportedDonor(d *ExportedDonor) error {
+	if d.DonationId == "" {
+		return fmt.Errorf("exported donor is missing its donation id")
+	}
+	for _, c := range d.Corrections {
+		if c.DonationId != d.DonationId {
+			return fmt.Errorf("correction of donation %s was sent with donation %s", c.DonationId, d.DonationId)
+		}
+	}
+	return nil
+}
+
+func CheckExportedPayout(p *ExportedPayout) error {
+	if p.Payout == nil || p.Payout.Id == "" {
+		return fmt.Errorf("exported payout is missing its id")
+	}
+	if len(p.Donations) == 0 {
+		return fmt.Errorf("payout %s has no donations", p.Payout.Id)
+	}
+	var grosses, fees, nets []model.Money
+	for _, d := range p.Donations {
+		if d.PayoutId != p.Payout.Id {
+			return fmt.Errorf("donation %s belongs to payout %s, not %s", d.Id, d.PayoutId, p.Payout.Id)
+		}
+		grosses, fees, nets = append(grosses, d.Gross), append(fees, d.Fee), append(nets, d.Net)
+	}
+	sumGross, err := model.SumMoney(grosses...)
+	if err != nil {
+		return fmt.Errorf("payout %s: %w", p.Payout.Id, err)
+	}
+	sumFee, err := model.SumMoney(fees...)
+	if err != nil {
+		return fmt.Errorf("payout %s: %w", p.Payout.Id, err)
+	}
+	sumNet, err := model.SumMoney(nets...)
+	if err != nil {
+		return fmt.Errorf("payout %s: %w", p.Payout.Id, err)
+	}
+
+	net, err := p.Payout.Gross.Sub(p.Payout.Fee)
+	if err != nil || !net.Equal(p.Payout.Net) || !sumGross.Equal(p.Payout.Gross) || !sumFee.Equal(p.Payout.Fee) || !sumNet.Equal(p.Payout.Net) {
+		return fmt.Errorf("payout %s totals (%v, %v, %v) do not match its donations (%v, %v, %v)",
+			p.Payout.Id, p.Payout.Gross, p.Payout.Fee, p.Payout.Net, sumGross, sumFee, sumNet)
+	}
+	return nil
+}
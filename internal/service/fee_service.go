@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// FeePricing is the expected Stripe fee of a charge: Rate basis points of
+// the gross plus Fixed, in minor units of the analysed currency. Fees more
+// than Tolerance basis points of the gross away from it are flagged.
+type FeePricing struct {
+	Rate      int64 `json:"rate"`
+	Fixed     int64 `json:"fixed"`
+	Tolerance int64 `json:"tolerance"`
+}
+
+// DefaultFeePricing is Stripe's standard pricing for EEA cards in Romania,
+// 1.5% + 1.25 lei. International cards cost 3.25% + 1.25 lei and are flagged.
+var DefaultFeePricing = FeePricing{Rate: 150, Fixed: 125, Tolerance: 50}
+
+func (p FeePricing) Validate() error {
+	if p.Rate < 0 || p.Fixed < 0 || p.Tolerance < 0 {
+		return fmt.Errorf("fee pricing cannot be negative: %+v", p)
+	}
+	return nil
+}
+
+// Expected is the fee the pricing gives for gross, rounded to the nearest
+// minor unit.
+func (p FeePricing) Expected(gross int64) int64 {
+	return (gross*p.Rate+5000)/10000 + p.Fixed
+}
+
+type FeeReader interface {
+	GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error)
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+}
+
+// FeeRate is the fee and gross of a donation, payout or month in minor
+// units, and Rate is fee / gross.
+type FeeRate struct {
+	Gross int64   `json:"gross"`
+	Fee   int64   `json:"fee"`
+	Rate  float64 `json:"rate"`
+}
+
+func newFeeRate(gross, fee int64) FeeRate {
+	r := FeeRate{Gross: gross, Fee: fee}
+	if gross > 0 {
+		r.Rate = float64(fee) / float64(gross)
+	}
+	return r
+}
+
+func (r *FeeRate) add(gross, fee int64) {
+	*r = newFeeRate(r.Gross+gross, r.Fee+fee)
+}
+
+type DonationFee struct {
+	Id       string    `json:"id"`
+	Created  time.Time `json:"created"`
+	PayoutId string    `json:"payout_id"`
+	FeeRate
+	Expected int64 `json:"expected"`
+	Flagged  bool  `json:"flagged"`
+}
+
+type PayoutFee struct {
+	Id      string    `json:"id"`
+	Created time.Time `json:"created"`
+	FeeRate
+}
+
+// MonthFee covers the donations made in the month. Change is the rate minus
+// the rate of the previous month with donations.
+type MonthFee struct {
+	Month     time.Time `json:"month"`
+	Donations int       `json:"donations"`
+	FeeRate
+	Change float64 `json:"change"`
+}
+
+type FeeReport struct {
+	Start    time.Time  `json:"start"`
+	Last     time.Time  `json:"last"`
+	Currency string     `json:"currency"`
+	Pricing  FeePricing `json:"pricing"`
+	FeeRate
+	// Expected is the total fee by the pricing.
+	Expected int64 `json:"expected"`
+	Flagged  int   `json:"flagged"`
+	// OtherCurrencies counts the donations left out for their currency.
+	OtherCurrencies int           `json:"other_currencies"`
+	Donations       []DonationFee `json:"donations"`
+	Payouts         []PayoutFee   `json:"payouts"`
+	Months          []MonthFee    `json:"months"`
+}
+
+type FeeService struct {
+	Repo FeeReader
+}
+
+// GetFeeReport computes the effective fee rates of the period's donations in
+// currency, per donation and per month, and of the payouts made in the
+// period. Donations are flagged against pricing, which catches e.g.
+// international cards, since the card's country is not stored.
+func (s *FeeService) GetFeeReport(period Period, currency string, pricing FeePricing) (*FeeReport, error) {
+	if err := pricing.Validate(); err != nil {
+		return nil, err
+	}
+	currency = model.NewMoney(0, currency).Currency
+	page, err := s.Repo.QueryDonations(DonationQuery{From: period.Start, To: period.Last(), Sort: SortByCreated})
+	if err != nil {
+		return nil, err
+	}
+	payouts, err := s.Repo.GetPayoutsBetween(period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FeeReport{
+		Start:     period.Start,
+		Last:      period.Last(),
+		Currency:  currency,
+		Pricing:   pricing,
+		Donations: []DonationFee{},
+		Payouts:   []PayoutFee{},
+	}
+	for month := getMonthStart(period.Start.Year(), period.Start.Month()); month.Before(period.End); month = month.AddDate(0, 1, 0) {
+		report.Months = append(report.Months, MonthFee{Month: month})
+	}
+
+	for _, d := range page.Donations {
+		if d.Gross.Currency != currency || d.Fee.Currency != currency {
+			report.OtherCurrencies++
+			continue
+		}
+		fee := DonationFee{
+			Id:       d.Id,
+			Created:  d.Created,
+			PayoutId: d.PayoutId,
+			FeeRate:  newFeeRate(d.Gross.Amount, d.Fee.Amount),
+			Expected: pricing.Expected(d.Gross.Amount),
+		}
+		fee.Flagged = abs(fee.Fee-fee.Expected)*10000 > pricing.Tolerance*fee.Gross
+		if fee.Flagged {
+			report.Flagged++
+		}
+		report.Donations = append(report.Donations, fee)
+		report.add(fee.Gross, fee.Fee)
+		report.Expected += fee.Expected
+
+		month := &report.Months[monthsBetween(report.Months[0].Month, d.Created)]
+		month.Donations++
+		month.add(fee.Gross, fee.Fee)
+	}
+
+	previous := -1
+	for i := range report.Months {
+		if report.Months[i].Donations == 0 {
+			continue
+		}
+		if previous >= 0 {
+			report.Months[i].Change = report.Months[i].Rate - report.Months[previous].Rate
+		}
+		previous = i
+	}
+
+	for _, p := range payouts {
+		if p.Gross.Currency != currency || p.Fee.Currency != currency {
+			continue
+		}
+		report.Payouts = append(report.Payouts, PayoutFee{Id: p.Id, Created: p.Created, FeeRate: newFeeRate(p.Gross.Amount, p.Fee.Amount)})
+	}
+	return report, nil
+}
+
+func monthsBetween(start, t time.Time) int {
+	return (t.Year()-start.Year())*12 + int(t.Month()) - int(start.Month())
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/stripe/stripe-go/v79"
+)
+
+// Stripe dashboard exports: "Payout reconciliation" itemized reports assign
+// every balance transaction to an automatic payout, and "Balance change from
+// activity" itemized reports contain the payout transactions themselves.
+// Importing a payout needs both: its transaction from the balance change
+// report and its charges from either report.
+
+type StripeReportFormat string
+
+const (
+	PayoutReconciliationReport StripeReportFormat = "payout reconciliation"
+	BalanceChangeReport        StripeReportFormat = "balance change from activity"
+)
+
+const stripeReportTimeLayout = "2006-01-02 15:04:05"
+
+var stripeReportColumns = []string{"balance_transaction_id", "created_utc", "gross", "fee", "net", "reporting_category", "source_id"}
+
+type StripeReport struct {
+	Format       StripeReportFormat
+	Transactions []*ImportedTransaction
+}
+
+type ImportedTransaction struct {
+	Transaction *stripe.BalanceTransaction
+	PayoutId    string
+}
+
+// ParseStripeReport reads either itemized export. Columns are looked up by
+// header name, so optional columns may be present in any order.
+func ParseStripeReport(r io.Reader) (*StripeReport, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("report is empty")
+	}
+	header := make(map[string]int, len(records[0]))
+	for i, column := range records[0] {
+		header[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+	for _, column := range stripeReportColumns {
+		if _, ok := header[column]; !ok {
+			return nil, fmt.Errorf("column %q is missing: not a Stripe itemized report", column)
+		}
+	}
+
+	report := &StripeReport{Format: BalanceChangeReport}
+	if _, ok := header["automatic_payout_id"]; ok {
+		report.Format = PayoutReconciliationReport
+	}
+	get := func(record []string, column string) string {
+		i, ok := header[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	for i, record := range records[1:] {
+		t, err := parseReportRow(record, get)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		if report.Format == PayoutReconciliationReport && t.Transaction.Type != "payout" {
+			t.PayoutId = get(record, "automatic_payout_id")
+		}
+		report.Transactions = append(report.Transactions, t)
+	}
+	return report, nil
+}
+
+func parseReportRow(record []string, get func([]string, string) string) (*ImportedTransaction, error) {
+	id := get(record, "balance_transaction_id")
+	if id == "" {
+		return nil, fmt.Errorf("balance_transaction_id is missing")
+	}
+	created, err := time.Parse(stripeReportTimeLayout, get(record, "created_utc"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid created_utc %q", id, get(record, "created_utc"))
+	}
+	amounts := make([]int64, 3)
+	for i, column := range []string{"gross", "fee", "net"} {
+		if amounts[i], err = parseReportAmount(get(record, column)); err != nil {
+			return nil, fmt.Errorf("%s: invalid %s: %w", id, column, err)
+		}
+	}
+
+	category := get(record, "reporting_category")
+	t := &stripe.BalanceTransaction{
+		ID:       id,
+		Type:     stripe.BalanceTransactionType(category),
+		Created:  created.Unix(),
+		Amount:   amounts[0],
+		Fee:      amounts[1],
+		Net:      amounts[2],
+		Currency: stripe.Currency(get(record, "currency")),
+	}
+	if category == "charge" {
+		t.Source = &stripe.BalanceTransactionSource{
+			ID: get(record, "source_id"),
+			Charge: &stripe.Charge{
+				ID: get(record, "source_id"),
+				BillingDetails: &stripe.ChargeBillingDetails{
+					Name:  get(record, "customer_name"),
+					Email: get(record, "customer_email"),
+				},
+				PaymentMethodDetails: &stripe.ChargePaymentMethodDetails{
+					Type: stripe.ChargePaymentMethodDetailsType(get(record, "payment_method_type")),
+				},
+			},
+		}
+	}
+	imported := &ImportedTransaction{Transaction: t}
+	if category == "payout" {
+		imported.PayoutId = get(record, "source_id")
+	}
+	return imported, nil
+}
+
+// parseReportAmount converts a decimal amount such as "-1,234.50" to the
+// smallest currency unit.
+func parseReportAmount(s string) (int64, error) {
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return 0, fmt.Errorf("is empty")
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%q has more than 2 decimals", s)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	negative := strings.HasPrefix(whole, "-")
+	units, err := strconv.ParseInt(strings.TrimPrefix(whole, "-")+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	if negative {
+		units = -units
+	}
+	return units, nil
+}
+
+type ImportStore interface {
+	Writer
+	GetPayoutById(id string) (*model.Payout, error)
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+}
+
+type ImportService struct {
+	Repo   ImportStore
+	Policy *DonationPolicy
+	DryRun bool
+}
+
+type ImportResult struct {
+	Imported   []string
+	Existing   []string
+	Failed     map[string]ValidationErrors
+	Unassigned []string
+}
+
+// Import merges the reports by balance transaction, groups the charges by
+// payout and writes every payout that passes the webhook's validation and
+// the donation policy. Payouts that are already stored are left untouched,
+// and a payout with a charge stored in another payout fails.
+func (s *ImportService) Import(reports []*StripeReport) (*ImportResult, error) {
+	transactions, err := mergeReports(reports)
+	if err != nil {
+		return nil, err
+	}
+
+	payouts := make(map[string]*stripe.BalanceTransaction)
+	charges := make(map[string][]*stripe.BalanceTransaction)
+	result := &ImportResult{Failed: make(map[string]ValidationErrors)}
+	for _, t := range transactions {
+		switch {
+		case t.Transaction.Type == "payout":
+			payouts[t.PayoutId] = t.Transaction
+		case t.PayoutId == "":
+			result.Unassigned = append(result.Unassigned, t.Transaction.ID)
+		default:
+			charges[t.PayoutId] = append(charges[t.PayoutId], t.Transaction)
+		}
+	}
+
+	ids := make([]string, 0, len(charges))
+	for id := range charges {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		pi, pj := payouts[ids[i]], payouts[ids[j]]
+		if pi == nil || pj == nil || pi.Created == pj.Created {
+			return ids[i] < ids[j]
+		}
+		return pi.Created < pj.Created
+	})
+
+	for _, id := range ids {
+		_, err := s.Repo.GetPayoutById(id)
+		if err == nil {
+			result.Existing = append(result.Existing, id)
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("failed to check payout %s: %w", id, err)
+		}
+
+		payoutTransaction := payouts[id]
+		if payoutTransaction == nil {
+			var errs ValidationErrors
+			errs.add(id, "payout transaction", "is missing: add the balance change report covering it")
+			result.Failed[id] = errs
+			continue
+		}
+		gross, fee, net, errs := validateTransactions(payoutTransaction, charges[id])
+		storedErrs, err := s.storedCharges(charges[id])
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, storedErrs...)
+		decisions, rejected, quarantined := s.policy().evaluateAll(charges[id])
+		errs = append(errs, rejected...)
+		errs = append(errs, quarantined...)
+		if len(errs) > 0 {
+			result.Failed[id] = errs
+			continue
+		}
+
+		payout := model.FromStripePayoutAndTotals(&stripe.Payout{ID: id, Created: payoutTransaction.Created}, gross, fee, net)
+		donations := model.FromChargeTransactionsAndPayoutId(charges[id], id)
+		for i, d := range donations {
+			s.policy().applyTo(d, decisions[i])
+		}
+		if !s.DryRun {
+			if err := s.Repo.WritePayoutAndDonations(payout, donations); err != nil {
+				return result, fmt.Errorf("failed to persist payout %s: %w", id, err)
+			}
+		}
+		result.Imported = append(result.Imported, id)
+	}
+	return result, nil
+}
+
+// storedCharges reports the charges that are already stored as donations.
+func (s *ImportService) storedCharges(charges []*stripe.BalanceTransaction) (ValidationErrors, error) {
+	var errs ValidationErrors
+	for _, charge := range charges {
+		page, err := s.Repo.QueryDonations(DonationQuery{Id: charge.ID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check charge %s: %w", charge.ID, err)
+		}
+		for _, d := range page.Donations {
+			errs.add(charge.ID, "id", "is already stored in payout "+d.PayoutId)
+		}
+	}
+	return errs, nil
+}
+
+func (s *ImportService) policy() *DonationPolicy {
+	if s.Policy == nil {
+		return DefaultDonationPolicy()
+	}
+	return s.Policy
+}
+
+// mergeReports keeps one entry per balance transaction. A transaction that
+// appears in several reports takes its payout and customer details from
+// whichever report has them, and conflicting payouts are an error.
+func mergeReports(reports []*StripeReport) ([]*ImportedTransaction, error) {
+	var merged []*ImportedTransaction
+	byId := make(map[string]*ImportedTransaction)
+	for _, report := range reports {
+		for _, t := range report.Transactions {
+			existing, ok := byId[t.Transaction.ID]
+			if !ok {
+				byId[t.Transaction.ID] = t
+				merged = append(merged, t)
+				continue
+			}
+			if existing.PayoutId != "" && t.PayoutId != "" && existing.PayoutId != t.PayoutId {
+				return nil, fmt.Errorf("%s is in payout %s and in payout %s", t.Transaction.ID, existing.PayoutId, t.PayoutId)
+			}
+			if existing.PayoutId == "" {
+				existing.PayoutId = t.PayoutId
+			}
+			mergeBillingDetails(existing.Transaction, t.Transaction)
+		}
+	}
+	return merged, nil
+}
+
+func mergeBillingDetails(dst, src *stripe.BalanceTransaction) {
+	if dst.Source == nil || src.Source == nil || dst.Source.Charge == nil || src.Source.Charge == nil {
+		return
+	}
+	to, from := dst.Source.Charge, src.Source.Charge
+	if to.BillingDetails.Name == "" {
+		to.BillingDetails.Name = from.BillingDetails.Name
+	}
+	if to.BillingDetails.Email == "" {
+		to.BillingDetails.Email = from.BillingDetails.Email
+	}
+	if to.PaymentMethodDetails.Type == "" {
+		to.PaymentMethodDetails.Type = from.PaymentMethodDetails.Type
+	}
+}
+
+func (r *ImportResult) FailedIds() []string {
+	ids := make([]string, 0, len(r.Failed))
+	for id := range r.Failed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// The ledger chains every payout and donation as it is written: each entry
+// stores the previous entry's hash, and its own hash covers that hash and
+// the row's accounting fields. Donor names and emails are chained apart, in
+// a donor entry after the donation, which is appended again whenever a
+// correction or an erasure changes them. Only a donation's latest donor
+// entry must match its data. Key rotation leaves the plaintext, and so the
+// chain, unchanged.
+
+const (
+	LedgerPayout   = "payout"
+	LedgerDonation = "donation"
+	LedgerDonor    = "donor"
+)
+
+type LedgerEntry struct {
+	Seq      int
+	Kind     string
+	Id       string
+	PrevHash string
+	Hash     string
+}
+
+type LedgerReader interface {
+	GetLedger() ([]*LedgerEntry, error)
+	GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error)
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+	GetCorrections(donationId string) ([]*model.Correction, error)
+}
+
+// LedgerInitializer chains the rows stored before the ledger existed, once:
+// it refuses to run when the ledger has entries, unless donations are
+// missing their donor entries, which it then appends.
+type LedgerInitializer interface {
+	InitLedger() (int, error)
+}
+
+// ChainLedger returns the entries that follow head, which is nil for an
+// empty ledger, for the payouts in order, each followed by its donations
+// and their donor entries. The donations are the stored rows, corrections
+// has their corrections in order. Donations of other payouts are skipped.
+func ChainLedger(head *LedgerEntry, payouts []*model.Payout, donations []*model.Donation, corrections []*model.Correction) []*LedgerEntry {
+	byPayout := make(map[string][]*model.Donation)
+	for _, d := range donations {
+		byPayout[d.PayoutId] = append(byPayout[d.PayoutId], d)
+	}
+	byDonation := correctionsByDonation(corrections)
+	c := newChain(head)
+	for _, p := range payouts {
+		c.add(LedgerPayout, p.Id, payoutFields(p))
+		for _, d := range byPayout[p.Id] {
+			c.add(LedgerDonation, d.Id, donationFields(d))
+			c.add(LedgerDonor, d.Id, donorFields(d, byDonation[d.Id]))
+		}
+	}
+	return c.entries
+}
+
+// ChainDonors returns new donor entries for the stored donations, after a
+// correction or an erasure changed their names, emails or corrections.
+func ChainDonors(head *LedgerEntry, donations []*model.Donation, corrections []*model.Correction) []*LedgerEntry {
+	byDonation := correctionsByDonation(corrections)
+	c := newChain(head)
+	for _, d := range donations {
+		c.add(LedgerDonor, d.Id, donorFields(d, byDonation[d.Id]))
+	}
+	return c.entries
+}
+
+type chain struct {
+	seq     int
+	prev    string
+	entries []*LedgerEntry
+}
+
+func newChain(head *LedgerEntry) *chain {
+	if head == nil {
+		return &chain{}
+	}
+	return &chain{seq: head.Seq, prev: head.Hash}
+}
+
+func (c *chain) add(kind, id, fields string) {
+	c.seq++
+	e := &LedgerEntry{Seq: c.seq, Kind: kind, Id: id, PrevHash: c.prev, Hash: ledgerHash(c.seq, c.prev, kind, fields)}
+	c.entries = append(c.entries, e)
+	c.prev = e.Hash
+}
+
+func correctionsByDonation(corrections []*model.Correction) map[string][]*model.Correction {
+	byDonation := make(map[string][]*model.Correction)
+	for _, c := range corrections {
+		byDonation[c.DonationId] = append(byDonation[c.DonationId], c)
+	}
+	return byDonation
+}
+
+func ledgerHash(seq int, prev, kind, fields string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(seq) + "\n" + prev + "\n" + kind + "\n" + fields))
+	return hex.EncodeToString(sum[:])
+}
+
+func payoutFields(p *model.Payout) string {
+	return strings.Join([]string{
+		p.Id, p.Created.UTC().Format(time.RFC3339),
+		p.Gross.MinorUnits(), p.Fee.MinorUnits(), p.Net.MinorUnits(), p.Gross.Currency,
+	}, "|")
+}
+
+func donationFields(d *model.Donation) string {
+	return strings.Join([]string{
+		d.Id, d.Created.UTC().Format(time.RFC3339), d.PayoutId,
+		d.Gross.MinorUnits(), d.Fee.MinorUnits(), d.Net.MinorUnits(), d.Gross.Currency, d.Policy,
+	}, "|")
+}
+
+// donorFields covers the name and email reads return and every correction
+// of the donation, so edits to either file are detected.
+func donorFields(d *model.Donation, corrections []*model.Correction) string {
+	effective := *d
+	fields := []string{d.Id}
+	for _, c := range corrections {
+		c.Apply(&effective)
+		fields = append(fields, c.Field, c.OldValue, c.NewValue, c.Operator, c.Reason, c.Created.UTC().Format(time.RFC3339))
+	}
+	return strings.Join(append(fields, effective.ClientName, effective.ClientEmail), "|")
+}
+
+// ChainBreak is the first entry or row that does not match the chain. Seq
+// is 0 for a stored row that was never chained.
+type ChainBreak struct {
+	Seq    int
+	Kind   string
+	Id     string
+	Reason string
+}
+
+type ChainReport struct {
+	Entries int
+	Head    *LedgerEntry
+	Break   *ChainBreak
+}
+
+type LedgerService struct {
+	Repo LedgerReader
+}
+
+// CheckInitialized fails while rows are stored but the ledger is empty, so
+// the webhook refuses to start instead of failing every write.
+func (s *LedgerService) CheckInitialized() error {
+	entries, err := s.Repo.GetLedger()
+	if err != nil || len(entries) > 0 {
+		return err
+	}
+	payouts, err := s.Repo.GetPayoutsAfter(0, 1)
+	if err != nil {
+		return err
+	}
+	if len(payouts) > 0 {
+		return errors.New("rows are stored but the ledger is empty, chain them once with `cli verify-chain -init`")
+	}
+	return nil
+}
+
+func (s *LedgerService) VerifyChain() (*ChainReport, error) {
+	entries, err := s.Repo.GetLedger()
+	if err != nil {
+		return nil, err
+	}
+	payouts, err := s.Repo.GetPayoutsAfter(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.Repo.QueryDonations(DonationQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]map[string]string{LedgerPayout: {}, LedgerDonation: {}, LedgerDonor: {}}
+	for _, p := range payouts {
+		fields[LedgerPayout][p.Id] = payoutFields(p)
+	}
+	for _, d := range page.Donations {
+		corrections, err := s.Repo.GetCorrections(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		fields[LedgerDonation][d.Id] = donationFields(d)
+		// reads apply the corrections, applying them again changes nothing
+		fields[LedgerDonor][d.Id] = donorFields(d, corrections)
+	}
+	latest := make(map[string]int)
+	for _, e := range entries {
+		if e.Kind == LedgerDonor {
+			latest[e.Id] = e.Seq
+		}
+	}
+
+	report := &ChainReport{Entries: len(entries)}
+	if len(entries) == 0 && len(payouts) > 0 {
+		report.Break = &ChainBreak{Kind: LedgerPayout, Id: payouts[0].Id, Reason: "the ledger is missing or empty, but rows are stored"}
+		return report, nil
+	}
+	if len(entries) == 0 && len(page.Donations) > 0 {
+		report.Break = &ChainBreak{Kind: LedgerDonation, Id: page.Donations[0].Id, Reason: "the ledger is missing or empty, but rows are stored"}
+		return report, nil
+	}
+	chained := map[string]map[string]bool{LedgerPayout: {}, LedgerDonation: {}, LedgerDonor: {}}
+	prev := ""
+	for i, e := range entries {
+		reason := ""
+		row, ok := fields[e.Kind][e.Id]
+		switch {
+		case e.Seq != i+1:
+			reason = fmt.Sprintf("sequence number should be %d", i+1)
+		case e.PrevHash != prev:
+			reason = "previous hash does not match the entry before it"
+		case e.Kind == LedgerDonor && latest[e.Id] != e.Seq:
+			// a later donor entry covers the current data
+		case !ok:
+			reason = "row is missing"
+		case ledgerHash(e.Seq, e.PrevHash, e.Kind, row) != e.Hash:
+			reason = "row was changed after it was chained"
+		}
+		if reason != "" {
+			report.Break = &ChainBreak{Seq: e.Seq, Kind: e.Kind, Id: e.Id, Reason: reason}
+			return report, nil
+		}
+		chained[e.Kind][e.Id] = true
+		prev = e.Hash
+		report.Head = e
+	}
+
+	for _, p := range payouts {
+		if !chained[LedgerPayout][p.Id] {
+			report.Break = &ChainBreak{Kind: LedgerPayout, Id: p.Id, Reason: "row is not in the ledger"}
+			return report, nil
+		}
+	}
+	for _, d := range page.Donations {
+		if !chained[LedgerDonation][d.Id] {
+			report.Break = &ChainBreak{Kind: LedgerDonation, Id: d.Id, Reason: "row is not in the ledger"}
+			return report, nil
+		}
+	}
+	for _, d := range page.Donations {
+		if !chained[LedgerDonor][d.Id] {
+			report.Break = &ChainBreak{Kind: LedgerDonor, Id: d.Id, Reason: "name and email are not in the ledger, chain them once with verify-chain -init"}
+			return report, nil
+		}
+	}
+	return report, nil
+}
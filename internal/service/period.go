@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+)
+
+// Period is the days from Start up to, but not including, End, at midnight
+// UTC.
+type Period struct {
+	Kind  string
+	Start time.Time
+	End   time.Time
+}
+
+func MonthPeriod(year int, month time.Month) Period {
+	start := getMonthStart(year, month)
+	return Period{Kind: dto.PeriodMonth, Start: start, End: start.AddDate(0, 1, 0)}
+}
+
+func QuarterPeriod(year, quarter int) (Period, error) {
+	if quarter < 1 || quarter > 4 {
+		return Period{}, fmt.Errorf("invalid quarter %d, expected 1 to 4", quarter)
+	}
+	start := getMonthStart(year, time.Month(3*quarter-2))
+	return Period{Kind: dto.PeriodQuarter, Start: start, End: start.AddDate(0, 3, 0)}, nil
+}
+
+// RangePeriod covers from and to, both included. Only their dates are used.
+func RangePeriod(from, to time.Time) (Period, error) {
+	if from.IsZero() || to.IsZero() {
+		return Period{}, errors.New("both dates of the range are required")
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	if !start.Before(end) {
+		return Period{}, fmt.Errorf("range ends on %s, before it starts on %s", to.Format(time.DateOnly), from.Format(time.DateOnly))
+	}
+	return Period{Kind: dto.PeriodRange, Start: start, End: end}, nil
+}
+
+// Last is the last day of the period.
+func (p Period) Last() time.Time {
+	return p.End.AddDate(0, 0, -1)
+}
+
+func (p Period) String() string {
+	return p.Start.Format(time.DateOnly) + " - " + p.Last().Format(time.DateOnly)
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/stripe/stripe-go/v79"
+)
+
+type PolicyAction string
+
+const (
+	PolicyReject     PolicyAction = "reject"
+	PolicyAccept     PolicyAction = "accept"
+	PolicyQuarantine PolicyAction = "quarantine"
+)
+
+type PolicyRule struct {
+	Action      PolicyAction `json:"action"`
+	Placeholder string       `json:"placeholder,omitempty"`
+}
+
+type AmountRule struct {
+	Limit  int64        `json:"limit"`
+	Action PolicyAction `json:"action"`
+}
+
+type PaymentTypeRule struct {
+	Allowed []string     `json:"allowed"`
+	Action  PolicyAction `json:"action"`
+}
+
+type DonationPolicy struct {
+	Name         string           `json:"name"`
+	MissingEmail PolicyRule       `json:"missing_email"`
+	MissingName  PolicyRule       `json:"missing_name"`
+	MinAmount    *AmountRule      `json:"min_amount,omitempty"`
+	MaxAmount    *AmountRule      `json:"max_amount,omitempty"`
+	PaymentTypes *PaymentTypeRule `json:"payment_types,omitempty"`
+}
+
+func DefaultDonationPolicy() *DonationPolicy {
+	return &DonationPolicy{
+		Name:         "default",
+		MissingEmail: PolicyRule{Action: PolicyQuarantine, Placeholder: "anonim@hintermann.ro"},
+		MissingName:  PolicyRule{Action: PolicyAccept},
+	}
+}
+
+func LoadDonationPolicy(path string) (*DonationPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := DefaultDonationPolicy()
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid donation policy %s: %w", path, err)
+	}
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid donation policy %s: %w", path, err)
+	}
+	return policy, nil
+}
+
+func (p *DonationPolicy) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is missing")
+	}
+	actions := map[string]PolicyAction{
+		"missing_email": p.MissingEmail.Action,
+		"missing_name":  p.MissingName.Action,
+	}
+	if p.MinAmount != nil {
+		actions["min_amount"] = p.MinAmount.Action
+	}
+	if p.MaxAmount != nil {
+		actions["max_amount"] = p.MaxAmount.Action
+	}
+	if p.PaymentTypes != nil {
+		actions["payment_types"] = p.PaymentTypes.Action
+	}
+	for rule, action := range actions {
+		if action != PolicyReject && action != PolicyAccept && action != PolicyQuarantine {
+			return fmt.Errorf("%s action %q is not reject, accept or quarantine", rule, action)
+		}
+	}
+	return nil
+}
+
+type policyDecision struct {
+	applied     []string
+	rejected    ValidationErrors
+	quarantined ValidationErrors
+	name        *string
+	email       *string
+}
+
+func (p *DonationPolicy) evaluate(charge *stripe.BalanceTransaction) *policyDecision {
+	d := &policyDecision{}
+	if charge == nil {
+		return d
+	}
+	billing := billingDetails(charge)
+
+	if billing.Email == "" {
+		d.apply(charge.ID, "missing_email", "email", "is missing", p.MissingEmail.Action)
+		if p.MissingEmail.Action == PolicyAccept {
+			d.email = &p.MissingEmail.Placeholder
+		}
+	}
+	if billing.Name == "" {
+		d.apply(charge.ID, "missing_name", "name", "is missing", p.MissingName.Action)
+		if p.MissingName.Action == PolicyAccept {
+			d.name = &p.MissingName.Placeholder
+		}
+	}
+	if p.MinAmount != nil && charge.Amount < p.MinAmount.Limit {
+		d.apply(charge.ID, "min_amount", "amount", fmt.Sprintf("is below %d", p.MinAmount.Limit), p.MinAmount.Action)
+	}
+	if p.MaxAmount != nil && charge.Amount > p.MaxAmount.Limit {
+		d.apply(charge.ID, "max_amount", "amount", fmt.Sprintf("is above %d", p.MaxAmount.Limit), p.MaxAmount.Action)
+	}
+	if p.PaymentTypes != nil && len(p.PaymentTypes.Allowed) > 0 {
+		paymentType := paymentType(charge)
+		if !slices.Contains(p.PaymentTypes.Allowed, paymentType) {
+			rule := fmt.Sprintf("%q is not one of %s", paymentType, strings.Join(p.PaymentTypes.Allowed, ", "))
+			d.apply(charge.ID, "payment_types", "payment type", rule, p.PaymentTypes.Action)
+		}
+	}
+	return d
+}
+
+func (p *DonationPolicy) evaluateAll(charges []*stripe.BalanceTransaction) ([]*policyDecision, ValidationErrors, ValidationErrors) {
+	decisions := make([]*policyDecision, len(charges))
+	var rejected, quarantined ValidationErrors
+	for i, charge := range charges {
+		decisions[i] = p.evaluate(charge)
+		rejected = append(rejected, decisions[i].rejected...)
+		quarantined = append(quarantined, decisions[i].quarantined...)
+	}
+	return decisions, rejected, quarantined
+}
+
+func (d *policyDecision) apply(transactionId, ruleName, field, rule string, action PolicyAction) {
+	switch action {
+	case PolicyAccept:
+		d.applied = append(d.applied, ruleName)
+	case PolicyQuarantine:
+		d.quarantined.add(transactionId, field, rule+" (policy: quarantine)")
+	default:
+		d.rejected.add(transactionId, field, rule+" (policy: reject)")
+	}
+}
+
+func (p *DonationPolicy) label(d *policyDecision) string {
+	if len(d.applied) == 0 {
+		return p.Name
+	}
+	return p.Name + ":" + strings.Join(d.applied, "+")
+}
+
+// overridden returns the policy an operator applies when approving a
+// quarantined payout: the rules that quarantine accept instead, with their
+// placeholders.
+func (p *DonationPolicy) overridden() *DonationPolicy {
+	o := *p
+	accept := func(action PolicyAction) PolicyAction {
+		if action == PolicyQuarantine {
+			return PolicyAccept
+		}
+		return action
+	}
+	o.MissingEmail.Action = accept(o.MissingEmail.Action)
+	o.MissingName.Action = accept(o.MissingName.Action)
+	if p.MinAmount != nil {
+		o.MinAmount = &AmountRule{Limit: p.MinAmount.Limit, Action: accept(p.MinAmount.Action)}
+	}
+	if p.MaxAmount != nil {
+		o.MaxAmount = &AmountRule{Limit: p.MaxAmount.Limit, Action: accept(p.MaxAmount.Action)}
+	}
+	if p.PaymentTypes != nil {
+		o.PaymentTypes = &PaymentTypeRule{Allowed: p.PaymentTypes.Allowed, Action: accept(p.PaymentTypes.Action)}
+	}
+	return &o
+}
+
+// appliedRule reports whether the donation's policy label lists rule among
+// the accepted rules. An override, ";override:<operator>", may follow them.
+func appliedRule(donation *model.Donation, rule string) bool {
+	label, _, _ := strings.Cut(donation.Policy, ";")
+	i := strings.LastIndex(label, ":")
+	if i < 0 {
+		return false
+	}
+	return slices.Contains(strings.Split(label[i+1:], "+"), rule)
+}
+
+func (p *DonationPolicy) applyTo(donation *model.Donation, d *policyDecision) {
+	if d.name != nil {
+		donation.ClientName = *d.name
+	}
+	if d.email != nil {
+		donation.ClientEmail = *d.email
+	}
+	donation.Policy = p.label(d)
+}
+
+func billingDetails(charge *stripe.BalanceTransaction) *stripe.ChargeBillingDetails {
+	if charge.Source == nil || charge.Source.Charge == nil || charge.Source.Charge.BillingDetails == nil {
+		return &stripe.ChargeBillingDetails{}
+	}
+	return charge.Source.Charge.BillingDetails
+}
+
+func paymentType(charge *stripe.BalanceTransaction) string {
+	if charge.Source == nil || charge.Source.Charge == nil || charge.Source.Charge.PaymentMethodDetails == nil {
+		return "unknown"
+	}
+	details := charge.Source.Charge.PaymentMethodDetails
+	if details.Card != nil && details.Card.Wallet != nil && details.Card.Wallet.Type != "" {
+		return string(details.Card.Wallet.Type)
+	}
+	return string(details.Type)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+	"github.com/stripe/stripe-go/v79"
+)
+
+type QuarantineService struct {
+	Quarantine QuarantineStore
+	Repo       Writer
+	Policy     *DonationPolicy
+}
+
+func (s *QuarantineService) GetQuarantinedPayouts() ([]*model.QuarantinedPayout, error) {
+	return s.Quarantine.GetQuarantinedPayouts()
+}
+
+func (s *QuarantineService) GetQuarantinedPayout(payoutId string) (*model.QuarantinedPayout, error) {
+	return s.Quarantine.GetQuarantinedPayout(payoutId)
+}
+
+func (s *QuarantineService) Annotate(payoutId, author, text string) error {
+	if author == "" || text == "" {
+		return errors.New("author and note text are required")
+	}
+	q, err := s.Quarantine.GetQuarantinedPayout(payoutId)
+	if err != nil {
+		return err
+	}
+	q.Notes = append(q.Notes, &model.QuarantineNote{
+		Author:  author,
+		Created: time.Now().UTC(),
+		Text:    text,
+	})
+	return s.Quarantine.WriteQuarantinedPayout(q)
+}
+
+// Approve stores a quarantined payout on an operator's override. The charge
+// and payment transactions become the donations, with the donation policy
+// applied and its quarantine rules accepted; a rejected charge still fails.
+// Their gross minus fees must match what Stripe paid unless
+// acceptDiscrepancy is set, in which case the difference and the left out
+// transactions are recorded in the approval.
+func (s *QuarantineService) Approve(payoutId, operator, reason string, acceptDiscrepancy bool) (*model.Payout, error) {
+	if operator == "" || reason == "" {
+		return nil, errors.New("operator and reason are required")
+	}
+	q, err := s.Quarantine.GetQuarantinedPayout(payoutId)
+	if err != nil {
+		return nil, err
+	}
+	if q.Approval != nil {
+		return nil, fmt.Errorf("payout %s was already approved by %s", payoutId, q.Approval.Operator)
+	}
+	if q.Payout == nil {
+		return nil, fmt.Errorf("payout %s has no payout transaction to reconcile the charges against", payoutId)
+	}
+
+	var charges []*stripe.BalanceTransaction
+	var excluded []string
+	var grosses, fees []model.Money
+	for _, charge := range q.ChargeTransactions() {
+		if charge.Type != "charge" && charge.Type != "payment" {
+			excluded = append(excluded, charge.ID)
+			continue
+		}
+		charges = append(charges, charge)
+		grosses = append(grosses, model.NewMoney(charge.Amount, string(charge.Currency)))
+		fees = append(fees, model.NewMoney(charge.Fee, string(charge.Currency)))
+	}
+	if len(charges) == 0 {
+		return nil, fmt.Errorf("payout %s has no charge transactions to approve", payoutId)
+	}
+	gross, err := model.SumMoney(grosses...)
+	if err != nil {
+		return nil, fmt.Errorf("payout %s: %w", payoutId, err)
+	}
+	fee, err := model.SumMoney(fees...)
+	if err != nil {
+		return nil, fmt.Errorf("payout %s: %w", payoutId, err)
+	}
+	net, _ := gross.Sub(fee)
+	paid := model.NewMoney(-q.Payout.Amount, q.Payout.Currency)
+	discrepancy, err := paid.Sub(net)
+	if err != nil {
+		return nil, fmt.Errorf("payout %s: %w", payoutId, err)
+	}
+	if discrepancy.Amount != 0 && !acceptDiscrepancy {
+		leftOut := "none"
+		if len(excluded) > 0 {
+			leftOut = strings.Join(excluded, ", ")
+		}
+		return nil, fmt.Errorf("payout %s: Stripe paid %s but the charges net %s (left out transactions: %s); accept the discrepancy to approve it anyway",
+			payoutId, paid, net, leftOut)
+	}
+
+	policy := s.policy().overridden()
+	decisions, rejected, _ := policy.evaluateAll(charges)
+	if len(rejected) > 0 {
+		return nil, fmt.Errorf("payout %s is rejected by the donation policy: %w", payoutId, rejected)
+	}
+
+	payout := model.FromStripePayoutAndTotals(q.StripePayout(), gross, fee, net)
+	donations := model.FromChargeTransactionsAndPayoutId(charges, payoutId)
+	for i, d := range donations {
+		policy.applyTo(d, decisions[i])
+		d.Policy += ";override:" + operator
+	}
+	if err := s.Repo.WritePayoutAndDonations(payout, donations); err != nil {
+		return nil, fmt.Errorf("failed to persist payout+donations: %w", err)
+	}
+
+	q.Approval = &model.QuarantineApproval{
+		Operator: operator,
+		Approved: time.Now().UTC(),
+		Reason:   reason,
+	}
+	if discrepancy.Amount != 0 {
+		q.Approval.Discrepancy = &discrepancy
+		q.Approval.Excluded = excluded
+	}
+	if err := s.Quarantine.WriteQuarantinedPayout(q); err != nil {
+		return nil, fmt.Errorf("payout %s was written but the approval was not recorded: %w", payoutId, err)
+	}
+	return payout, nil
+}
+
+func (s *QuarantineService) policy() *DonationPolicy {
+	if s.Policy == nil {
+		return DefaultDonationPolicy()
+	}
+	return s.Policy
+}
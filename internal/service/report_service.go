@@ -1,35 +1,140 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/diother/hintermann-stripe-cli/internal/dto"
-	"github.com/diother/hintermann-stripe-cli/internal/helper"
 	"github.com/diother/hintermann-stripe-cli/internal/model"
 )
 
+// ErrNotFound is wrapped by the error of GetPayoutById when the payout is not
+// stored.
+var ErrNotFound = errors.New("not found")
+
 type Reader interface {
 	GetPayoutsByMonth(start time.Time) ([]*model.Payout, error)
+	// GetPayoutsBetween returns the payouts created in [start, end), and no
+	// error when there are none.
+	GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error)
 	GetPayoutById(id string) (*model.Payout, error)
 	GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error)
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+	GetLedgerHead() (*LedgerEntry, error)
 }
 
 type ReportService struct {
 	Repo Reader
 }
 
-func (s *ReportService) GetMonthlyReport(year int, month time.Month) (*dto.MonthlyReportDTO, error) {
-	start := getMonthStart(year, month)
+func (s *ReportService) GetMonthlyReport(year int, month time.Month) (*dto.PeriodReportDTO, error) {
+	period := MonthPeriod(year, month)
+
+	payouts, err := s.Repo.GetPayoutsByMonth(period.Start)
+	if err != nil {
+		return nil, err
+	}
+	return s.periodReport(period, payouts)
+}
 
-	payouts, err := s.Repo.GetPayoutsByMonth(start)
+func (s *ReportService) GetQuarterlyReport(year, quarter int) (*dto.PeriodReportDTO, error) {
+	period, err := QuarterPeriod(year, quarter)
 	if err != nil {
 		return nil, err
 	}
+	return s.GetPeriodReport(period)
+}
 
-	gross, fee, net := getMonthlyTotals(payouts)
+// GetPeriodReport totals the payouts created in the period.
+func (s *ReportService) GetPeriodReport(period Period) (*dto.PeriodReportDTO, error) {
+	payouts, err := s.Repo.GetPayoutsBetween(period.Start, period.End)
+	if err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %s", period)
+	}
+	return s.periodReport(period, payouts)
+}
+
+// periodReport is issued the day after the period ends.
+func (s *ReportService) periodReport(period Period, payouts []*model.Payout) (*dto.PeriodReportDTO, error) {
+	gross, fee, net, err := getMonthlyTotals(payouts)
+	if err != nil {
+		return nil, err
+	}
 	payoutDTOs := dto.FromPayouts(payouts)
 
-	return dto.FromMonthTotalsAndPayoutDTOs(start, gross, fee, net, payoutDTOs), nil
+	report := dto.FromPeriodTotalsAndPayoutDTOs(period.Kind, period.Start, period.Last(), period.End, gross, fee, net, payoutDTOs)
+	if report.LedgerHead, err = s.ledgerHead(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ledgerHead formats the newest ledger entry for a report footer, e.g.
+// "#42 3f9a...", or is empty for an empty ledger.
+func (s *ReportService) ledgerHead() (string, error) {
+	head, err := s.Repo.GetLedgerHead()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the ledger head: %w", err)
+	}
+	if head == nil {
+		return "", nil
+	}
+	return fmt.Sprintf("#%d %s", head.Seq, head.Hash), nil
+}
+
+// GetAnnualReport totals the year's payouts per month, by payout date, and
+// counts the donations they paid out.
+func (s *ReportService) GetAnnualReport(year int) (*dto.AnnualReportDTO, error) {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	payouts, err := s.Repo.GetPayoutsBetween(start, start.AddDate(1, 0, 0))
+	if err != nil {
+		return nil, err
+	}
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %d", year)
+	}
+
+	byMonth := make(map[time.Month][]*model.Payout)
+	donationCounts := make(map[time.Month]int)
+	donations := 0
+	for _, p := range payouts {
+		month := p.Created.UTC().Month()
+		byMonth[month] = append(byMonth[month], p)
+		ds, err := s.Repo.GetDonationsByPayoutId(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		donationCounts[month] += len(ds)
+		donations += len(ds)
+	}
+
+	gross, fee, net, err := getMonthlyTotals(payouts)
+	if err != nil {
+		return nil, fmt.Errorf("%d: %w", year, err)
+	}
+	months := make([]*dto.MonthTotalsDTO, 0, 12)
+	for month := time.January; month <= time.December; month++ {
+		if len(byMonth[month]) == 0 {
+			zero := model.NewMoney(0, gross.Currency)
+			months = append(months, dto.FromMonthTotals(month, 0, 0, zero, zero, zero))
+			continue
+		}
+		mGross, mFee, mNet, err := getMonthlyTotals(byMonth[month])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", month, err)
+		}
+		months = append(months, dto.FromMonthTotals(month, len(byMonth[month]), donationCounts[month], mGross, mFee, mNet))
+	}
+
+	report := dto.FromAnnualTotals(year, months, donations, gross, fee, net, dto.FromPayouts(payouts))
+	if report.LedgerHead, err = s.ledgerHead(); err != nil {
+		return nil, err
+	}
+	return report, nil
 }
 
 func (s *ReportService) GetPayoutReport(payoutId string) (*dto.PayoutReportDTO, []*dto.DonationDTO, error) {
@@ -53,12 +158,25 @@ func getMonthStart(year int, month time.Month) time.Time {
 	return time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
 }
 
-func getMonthlyTotals(payouts []*model.Payout) (int, int, int) {
-	var gross, fee, net int
-	for _, p := range payouts {
-		gross += helper.MustAtoi(p.Gross)
-		fee += helper.MustAtoi(p.Fee)
-		net += helper.MustAtoi(p.Net)
+func getMonthlyTotals(payouts []*model.Payout) (model.Money, model.Money, model.Money, error) {
+	var zero model.Money
+	grosses := make([]model.Money, len(payouts))
+	fees := make([]model.Money, len(payouts))
+	nets := make([]model.Money, len(payouts))
+	for i, p := range payouts {
+		grosses[i], fees[i], nets[i] = p.Gross, p.Fee, p.Net
+	}
+	gross, err := model.SumMoney(grosses...)
+	if err != nil {
+		return zero, zero, zero, fmt.Errorf("monthly gross: %w", err)
+	}
+	fee, err := model.SumMoney(fees...)
+	if err != nil {
+		return zero, zero, zero, fmt.Errorf("monthly fee: %w", err)
+	}
+	net, err := model.SumMoney(nets...)
+	if err != nil {
+		return zero, zero, zero, fmt.Errorf("monthly net: %w", err)
 	}
-	return gross, fee, net
+	return gross, fee, net, nil
 }
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type DonationSort string
+
+const (
+	SortByCreated DonationSort = "created"
+	SortByAmount  DonationSort = "amount"
+	SortByEmail   DonationSort = "email"
+	SortById      DonationSort = "id"
+)
+
+const DefaultSearchLimit = 50
+
+// DonationQuery filters donations on every non-zero field. From and To are
+// inclusive days, amounts are gross in the smallest currency unit and the
+// email is matched case-insensitively.
+type DonationQuery struct {
+	Id        string
+	Email     string
+	PayoutId  string
+	From      time.Time
+	To        time.Time
+	MinAmount int
+	MaxAmount int
+	Sort      DonationSort
+	Desc      bool
+	Offset    int
+	Limit     int
+}
+
+type DonationPage struct {
+	Donations []*model.Donation
+	Total     int
+}
+
+func (q *DonationQuery) Validate() error {
+	switch q.Sort {
+	case "", SortByCreated, SortByAmount, SortByEmail, SortById:
+	default:
+		return fmt.Errorf("cannot sort by %q: use created, amount, email or id", q.Sort)
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("offset and limit must not be negative")
+	}
+	if q.MinAmount < 0 || q.MaxAmount < 0 || (q.MaxAmount > 0 && q.MinAmount > q.MaxAmount) {
+		return fmt.Errorf("invalid amount range %d-%d", q.MinAmount, q.MaxAmount)
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return fmt.Errorf("invalid date range: %s is before %s", q.To.Format(time.DateOnly), q.From.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// FilterDonations applies the query to donations in write order, for
+// repositories that keep every row in memory.
+func FilterDonations(donations []*model.Donation, q DonationQuery) (*DonationPage, error) {
+	type match struct {
+		donation *model.Donation
+		created  time.Time
+		amount   int
+	}
+	var matches []match
+	for _, d := range donations {
+		if q.Id != "" && d.Id != q.Id {
+			continue
+		}
+		if q.PayoutId != "" && d.PayoutId != q.PayoutId {
+			continue
+		}
+		if q.Email != "" && !strings.EqualFold(d.ClientEmail, q.Email) {
+			continue
+		}
+		created := d.Created
+		if (!q.From.IsZero() && created.Before(q.From)) || (!q.To.IsZero() && !created.Before(q.To.AddDate(0, 0, 1))) {
+			continue
+		}
+		amount := int(d.Gross.Amount)
+		if amount < q.MinAmount || (q.MaxAmount > 0 && amount > q.MaxAmount) {
+			continue
+		}
+		matches = append(matches, match{donation: d, created: created, amount: amount})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if q.Desc {
+			a, b = b, a
+		}
+		switch q.Sort {
+		case SortByAmount:
+			return a.amount < b.amount
+		case SortByEmail:
+			return a.donation.ClientEmail < b.donation.ClientEmail
+		case SortById:
+			return a.donation.Id < b.donation.Id
+		default:
+			return a.created.Before(b.created)
+		}
+	})
+
+	page := &DonationPage{Total: len(matches)}
+	end := len(matches)
+	if q.Limit > 0 && q.Offset+q.Limit < end {
+		end = q.Offset + q.Limit
+	}
+	for i := q.Offset; i < end; i++ {
+		page.Donations = append(page.Donations, matches[i].donation)
+	}
+	return page, nil
+}
+
+type SearchService struct {
+	Repo Reader
+}
+
+func (s *SearchService) SearchDonations(q DonationQuery) (*DonationPage, error) {
+	if q.Limit == 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return s.Repo.QueryDonations(q)
+}
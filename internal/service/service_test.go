@@ -1,7 +1,14 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/diother/hintermann-stripe-cli/internal/model"
 	"github.com/stripe/stripe-go/v79"
@@ -10,86 +17,83 @@ import (
 func TestGetMonthlyTotals(t *testing.T) {
 	testCases := map[string]struct {
 		input         []*model.Payout
-		expectedPanic bool
-		expectedGross int
-		expectedFee   int
-		expectedNet   int
+		expectedErr   bool
+		expectedGross model.Money
+		expectedFee   model.Money
+		expectedNet   model.Money
 	}{
-		"validStrings": {
+		"validAmounts": {
 			input: []*model.Payout{
-				{Gross: "100", Fee: "10", Net: "90"},
-				{Gross: "200", Fee: "20", Net: "180"},
+				{Gross: lei(100), Fee: lei(10), Net: lei(90)},
+				{Gross: lei(200), Fee: lei(20), Net: lei(180)},
 			},
-			expectedPanic: false,
-			expectedGross: 300,
-			expectedFee:   30,
-			expectedNet:   270,
+			expectedGross: lei(300),
+			expectedFee:   lei(30),
+			expectedNet:   lei(270),
 		},
-		"badString": {
+		"mixedCurrencies": {
 			input: []*model.Payout{
-				{Gross: "bad", Fee: "10", Net: "90"},
+				{Gross: lei(100), Fee: lei(10), Net: lei(90)},
+				{Gross: model.NewMoney(100, "eur"), Fee: model.NewMoney(10, "eur"), Net: model.NewMoney(90, "eur")},
 			},
-			expectedPanic: true,
+			expectedErr: true,
 		},
 	}
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			if tc.expectedPanic {
-				defer func() {
-					if r := recover(); r == nil {
-						t.Errorf("expected panic, got none")
-					}
-				}()
-				getMonthlyTotals(tc.input)
-			} else {
-				gross, fee, net := getMonthlyTotals(tc.input)
-				if gross != tc.expectedGross || fee != tc.expectedFee || net != tc.expectedNet {
-					t.Errorf("wanted (%d, %d, %d), got (%d, %d, %d)",
-						tc.expectedGross, tc.expectedFee, tc.expectedNet,
-						gross, fee, net)
+			gross, fee, net, err := getMonthlyTotals(tc.input)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("expected an error, got none")
 				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !gross.Equal(tc.expectedGross) || !fee.Equal(tc.expectedFee) || !net.Equal(tc.expectedNet) {
+				t.Errorf("wanted (%v, %v, %v), got (%v, %v, %v)",
+					tc.expectedGross, tc.expectedFee, tc.expectedNet,
+					gross, fee, net)
 			}
 		})
 	}
 }
 
+func lei(amount int64) model.Money {
+	return model.NewMoney(amount, "ron")
+}
+
 func TestValidateStripePayout(t *testing.T) {
 	testCases := map[string]struct {
-		input       *stripe.Payout
-		expectedErr string
+		input        *stripe.Payout
+		expectedErrs []string
 	}{
 		"validPayout": {&stripe.Payout{
 			ID:                   "test_id",
 			Created:              123,
 			ReconciliationStatus: "completed",
-		}, "",
-		},
-		"nilPayout":            {nil, "is nil"},
-		"idMissing":            {&stripe.Payout{ID: ""}, "id is missing"},
-		"createdIsNotPositive": {&stripe.Payout{ID: "test_id"}, "created is not positive"},
-		"reconciliationStatusNotCompleted": {
-			&stripe.Payout{ID: "test_id", Created: 123},
-			"reconciliation status is not completed",
+		}, nil,
 		},
+		"nilPayout": {nil, []string{"is nil"}},
+		"idMissing": {&stripe.Payout{Created: 123, ReconciliationStatus: "completed"}, []string{"id is missing"}},
+		"allFieldsInvalid": {&stripe.Payout{ID: "test_id"}, []string{
+			"test_id: created is not positive",
+			"test_id: reconciliation status is not completed",
+		}},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := validateStripePayout(tc.input)
-			if tc.expectedErr == "" && err != nil {
-				t.Errorf("Expected no error, got: %v", err)
-			}
-			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
-				t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
-			}
+			assertValidationErrors(t, tc.expectedErrs, validateStripePayout(tc.input))
 		})
 	}
 }
 
 func TestValidatePayoutTransaction(t *testing.T) {
 	testCases := map[string]struct {
-		input       *stripe.BalanceTransaction
-		expectedErr string
+		input        *stripe.BalanceTransaction
+		expectedErrs []string
 	}{
 		"validPayout": {&stripe.BalanceTransaction{
 			Type:    "payout",
@@ -98,215 +102,98 @@ func TestValidatePayoutTransaction(t *testing.T) {
 			Amount:  -100,
 			Fee:     0,
 			Net:     -100,
-		}, "",
-		},
-		"nilPayout":     {nil, "is nil"},
-		"typeNotPayout": {&stripe.BalanceTransaction{}, "type is not payout"},
-		"idMissing":     {&stripe.BalanceTransaction{Type: "payout"}, "id is missing"},
-		"createdNotPositive": {
-			&stripe.BalanceTransaction{Type: "payout", ID: "test_id"},
-			"created is not positive",
-		},
-		"amountNotNegative": {
-			&stripe.BalanceTransaction{Type: "payout", ID: "test_id", Created: 123},
-			"amount is not negative",
+		}, nil,
 		},
+		"nilPayout": {nil, []string{"payout transaction is nil"}},
 		"feeNot0": {&stripe.BalanceTransaction{
 			Type:    "payout",
 			ID:      "test_id",
 			Created: 123,
 			Amount:  -100,
 			Fee:     10,
-		}, "fee is not 0",
-		},
-		"netNotNegative": {&stripe.BalanceTransaction{
-			Type:    "payout",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  -100,
-			Fee:     0,
-		}, "net is not negative",
+			Net:     -100,
+		}, []string{"test_id: fee is not 0"},
 		},
+		"allFieldsInvalid": {&stripe.BalanceTransaction{Fee: 10}, []string{
+			"type is not payout",
+			"id is missing",
+			"created is not positive",
+			"amount is not negative",
+			"fee is not 0",
+			"net is not negative",
+		}},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := validatePayoutTransaction(tc.input)
-			if tc.expectedErr == "" && err != nil {
-				t.Errorf("Expected no error, got: %v", err)
-			}
-			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
-				t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
-			}
+			assertValidationErrors(t, tc.expectedErrs, validatePayoutTransaction(tc.input))
 		})
 	}
 }
 
 func TestValidateChargeTransaction(t *testing.T) {
 	testCases := map[string]struct {
-		input       *stripe.BalanceTransaction
-		expectedErr string
+		input        *stripe.BalanceTransaction
+		expectedErrs []string
 	}{
-		"validCharge": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-			Net:     90,
-			Source: &stripe.BalanceTransactionSource{
-				Charge: &stripe.Charge{
-					BillingDetails: &stripe.ChargeBillingDetails{
-						Email: "test@gmail.com",
-					},
-				},
-			},
-		}, "",
-		},
-		"nilCharge":     {nil, "is nil"},
-		"typeNotCharge": {&stripe.BalanceTransaction{}, "type is not charge or payment"},
-		"idMissing":     {&stripe.BalanceTransaction{Type: "charge"}, "id is missing"},
-		"createdNotPositive": {
-			&stripe.BalanceTransaction{Type: "charge", ID: "test_id"},
-			"created is not positive",
-		},
-		"amountNotPositive": {
-			&stripe.BalanceTransaction{Type: "charge", ID: "test_id", Created: 123},
-			"amount is not positive",
-		},
-		"feeNotPositive": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-		}, "fee is not positive",
-		},
-		"netNotPositive": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-		}, "net is not positive",
-		},
-		"nilSource": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-			Net:     90,
-		}, "source is nil",
+		"validCharge": {validCharge("test_id", 100, 10), nil},
+		"nilCharge":   {nil, []string{"is nil"}},
+		"allFieldsInvalid": {&stripe.BalanceTransaction{ID: "test_id"}, []string{
+			"test_id: type is not charge or payment",
+			"test_id: created is not positive",
+			"test_id: amount is not positive",
+			"test_id: fee is not positive",
+			"test_id: net is not positive",
+			"test_id: source is nil",
+		}},
+		"idMissing": {validCharge("", 100, 10), []string{"id is missing"}},
+		"nilChargeObject": {withSource(validCharge("test_id", 100, 10), &stripe.BalanceTransactionSource{}),
+			[]string{"test_id: charge object is nil"},
 		},
-		"nilChargeObject": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-			Net:     90,
-			Source:  &stripe.BalanceTransactionSource{},
-		}, "charge object is nil",
+		"nilBillingDetails": {
+			withSource(validCharge("test_id", 100, 10), &stripe.BalanceTransactionSource{Charge: &stripe.Charge{}}),
+			[]string{"test_id: billing details is nil"},
 		},
-		"nilBillingDetails": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-			Net:     90,
-			Source:  &stripe.BalanceTransactionSource{Charge: &stripe.Charge{}},
-		}, "billing details is nil",
-		},
-		"emailMissing": {&stripe.BalanceTransaction{
-			Type:    "charge",
-			ID:      "test_id",
-			Created: 123,
-			Amount:  100,
-			Fee:     10,
-			Net:     90,
-			Source: &stripe.BalanceTransactionSource{
-				Charge: &stripe.Charge{
-					BillingDetails: &stripe.ChargeBillingDetails{},
-				},
-			},
-		}, "email is missing",
+		"emailMissingIsLeftToPolicy": {withSource(validCharge("test_id", 100, 10), &stripe.BalanceTransactionSource{
+			Charge: &stripe.Charge{BillingDetails: &stripe.ChargeBillingDetails{}},
+		}), nil,
 		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := validateChargeTransaction(tc.input)
-			if tc.expectedErr == "" && err != nil {
-				t.Errorf("Expected no error, got: %v", err)
-			}
-			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
-				t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
-			}
+			assertValidationErrors(t, tc.expectedErrs, validateChargeTransaction(tc.input))
 		})
 	}
 }
 
 func TestValidateChargeTransactions(t *testing.T) {
 	testCases := map[string]struct {
-		input       []*stripe.BalanceTransaction
-		expectedErr string
+		input        []*stripe.BalanceTransaction
+		expectedErrs []string
 	}{
-		"emptySlice": {
-			input:       []*stripe.BalanceTransaction{},
-			expectedErr: "slice is nil",
-		},
+		"emptySlice": {[]*stripe.BalanceTransaction{}, []string{"charges is empty"}},
 		"validCharges": {[]*stripe.BalanceTransaction{
-			{
-				Type:    "charge",
-				ID:      "test_id",
-				Created: 123,
-				Amount:  100,
-				Fee:     10,
-				Net:     90,
-				Source: &stripe.BalanceTransactionSource{
-					Charge: &stripe.Charge{
-						BillingDetails: &stripe.ChargeBillingDetails{
-							Email: "test@gmail.com",
-							Name:  "John Doe",
-						},
-					},
-				},
-			},
-			{
-				Type:    "charge",
-				ID:      "test_id",
-				Created: 123,
-				Amount:  200,
-				Fee:     20,
-				Net:     180,
-				Source: &stripe.BalanceTransactionSource{
-					Charge: &stripe.Charge{
-						BillingDetails: &stripe.ChargeBillingDetails{
-							Email: "test@gmail.com",
-							Name:  "John Doe",
-						},
-					},
-				},
-			},
-		}, "",
-		},
-		"invalidCharge": {
-			[]*stripe.BalanceTransaction{{Type: "charge", ID: ""}},
-			"index 0 id is missing",
+			validCharge("ch_1", 100, 10),
+			validCharge("ch_2", 200, 20),
+		}, nil,
 		},
+		"collectsEveryCharge": {[]*stripe.BalanceTransaction{
+			validCharge("ch_1", 100, 0),
+			validCharge("ch_2", 200, 20),
+			withSource(validCharge("ch_3", 300, 30), nil),
+			nil,
+		}, []string{
+			"ch_1: fee is not positive",
+			"ch_3: source is nil",
+			"index 3 is nil",
+		}},
 		"stripeFee": {
 			[]*stripe.BalanceTransaction{{ID: "fee_1", Type: "stripe_fee"}},
-			"stripe_fee transactions were not expected",
+			[]string{"fee_1: type stripe_fee was not expected"},
 		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			err := validateChargeTransactions(tc.input)
-			if tc.expectedErr == "" && err != nil {
-				t.Errorf("Expected no error, got: %v", err)
-			}
-			if tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr) {
-				t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
-			}
+			assertValidationErrors(t, tc.expectedErrs, validateChargeTransactions(tc.input))
 		})
 	}
 }
@@ -315,10 +202,10 @@ func TestValidateMatchingSums(t *testing.T) {
 	testCases := map[string]struct {
 		payout        *stripe.BalanceTransaction
 		charges       []*stripe.BalanceTransaction
-		expectedGross int
-		expectedFee   int
-		expectedNet   int
-		expectedErr   string
+		expectedGross model.Money
+		expectedFee   model.Money
+		expectedNet   model.Money
+		expectedErrs  []string
 	}{
 		"matchingSums": {
 			payout: &stripe.BalanceTransaction{
@@ -330,10 +217,9 @@ func TestValidateMatchingSums(t *testing.T) {
 				{Amount: 100, Fee: 3},
 				{Amount: 200, Fee: 3},
 			},
-			expectedGross: 300,
-			expectedFee:   6,
-			expectedNet:   294,
-			expectedErr:   "",
+			expectedGross: lei(300),
+			expectedFee:   lei(6),
+			expectedNet:   lei(294),
 		},
 		"nonMatchingSums": {
 			payout: &stripe.BalanceTransaction{
@@ -345,34 +231,1351 @@ func TestValidateMatchingSums(t *testing.T) {
 				{Amount: 100, Fee: 3},
 				{Amount: 200, Fee: 3},
 			},
-			expectedGross: 0,
-			expectedFee:   0,
-			expectedNet:   0,
-			expectedErr:   "payout amount does not match total charges minus fees. amount 295 != net 294",
+			expectedErrs: []string{"po_2: amount does not match total charges minus fees. amount 295 != net 294"},
+		},
+		"currencyMismatch": {
+			payout: &stripe.BalanceTransaction{
+				ID:       "po_3",
+				Type:     "payout",
+				Amount:   -97,
+				Currency: "ron",
+			},
+			charges: []*stripe.BalanceTransaction{
+				{ID: "ch_1", Amount: 100, Fee: 3, Currency: "eur"},
+			},
+			expectedErrs: []string{"ch_1: currency does not match the payout currency ron"},
 		},
 	}
 
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
-			gross, fee, net, err := validateMatchingSums(tc.payout, tc.charges)
+			gross, fee, net, errs := validateMatchingSums(tc.payout, tc.charges)
 
-			if tc.expectedErr == "" && err != nil {
-				t.Errorf("Expected no error, got: %v", err)
-			}
-			if tc.expectedErr != "" {
-				if err == nil || err.Error() != tc.expectedErr {
-					t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
-				}
-			}
-			if gross != tc.expectedGross {
+			assertValidationErrors(t, tc.expectedErrs, errs)
+			if !gross.Equal(tc.expectedGross) {
 				t.Errorf("Expected gross %v, got %v", tc.expectedGross, gross)
 			}
-			if fee != tc.expectedFee {
+			if !fee.Equal(tc.expectedFee) {
 				t.Errorf("Expected fee %v, got %v", tc.expectedFee, fee)
 			}
-			if net != tc.expectedNet {
+			if !net.Equal(tc.expectedNet) {
 				t.Errorf("Expected net %v, got %v", tc.expectedNet, net)
 			}
 		})
 	}
 }
+
+func TestValidateTransactions(t *testing.T) {
+	payout := &stripe.BalanceTransaction{
+		ID:      "po_1",
+		Type:    "payout",
+		Created: 123,
+		Amount:  -171,
+		Net:     -171,
+	}
+	charges := []*stripe.BalanceTransaction{
+		validCharge("ch_1", 100, 10),
+		withSource(validCharge("ch_2", 100, 10), nil),
+	}
+
+	_, _, _, errs := validateTransactions(payout, charges)
+	assertValidationErrors(t, []string{
+		"ch_2: source is nil",
+		"po_1: amount does not match total charges minus fees. amount 171 != net 180",
+	}, errs)
+}
+
+func TestDonationPolicyEvaluate(t *testing.T) {
+	policy := &DonationPolicy{
+		Name:         "v2",
+		MissingEmail: PolicyRule{Action: PolicyAccept, Placeholder: "anonim@hintermann.ro"},
+		MissingName:  PolicyRule{Action: PolicyAccept, Placeholder: "Anonim"},
+		MinAmount:    &AmountRule{Limit: 100, Action: PolicyReject},
+		MaxAmount:    &AmountRule{Limit: 100000, Action: PolicyQuarantine},
+		PaymentTypes: &PaymentTypeRule{Allowed: []string{"card", "apple_pay"}, Action: PolicyQuarantine},
+	}
+	anonymous := withSource(validCharge("ch_anon", 500, 10), &stripe.BalanceTransactionSource{
+		Charge: &stripe.Charge{
+			BillingDetails: &stripe.ChargeBillingDetails{},
+			PaymentMethodDetails: &stripe.ChargePaymentMethodDetails{
+				Type: "card",
+				Card: &stripe.ChargePaymentMethodDetailsCard{
+					Wallet: &stripe.ChargePaymentMethodDetailsCardWallet{Type: "apple_pay"},
+				},
+			},
+		},
+	})
+
+	testCases := map[string]struct {
+		input               *stripe.BalanceTransaction
+		expectedPolicy      string
+		expectedName        string
+		expectedEmail       string
+		expectedRejected    []string
+		expectedQuarantined []string
+	}{
+		"anonymousWalletAccepted": {
+			input:          anonymous,
+			expectedPolicy: "v2:missing_email+missing_name",
+			expectedName:   "Anonim",
+			expectedEmail:  "anonim@hintermann.ro",
+		},
+		"belowMinimumRejected": {
+			input:            validCharge("ch_small", 50, 10),
+			expectedPolicy:   "v2",
+			expectedName:     "John Doe",
+			expectedEmail:    "test@gmail.com",
+			expectedRejected: []string{"ch_small: amount is below 100 (policy: reject)"},
+			expectedQuarantined: []string{
+				`ch_small: payment type "unknown" is not one of card, apple_pay (policy: quarantine)`,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			d := policy.evaluate(tc.input)
+			assertValidationErrors(t, tc.expectedRejected, d.rejected)
+			assertValidationErrors(t, tc.expectedQuarantined, d.quarantined)
+
+			donation := model.FromChargeTransactionAndPayoutId(tc.input, "po_1")
+			policy.applyTo(donation, d)
+			if donation.Policy != tc.expectedPolicy {
+				t.Errorf("Expected policy %q, got %q", tc.expectedPolicy, donation.Policy)
+			}
+			if donation.ClientName != tc.expectedName || donation.ClientEmail != tc.expectedEmail {
+				t.Errorf("Expected client (%q, %q), got (%q, %q)",
+					tc.expectedName, tc.expectedEmail, donation.ClientName, donation.ClientEmail)
+			}
+		})
+	}
+}
+
+func TestWebhookServiceOutcomes(t *testing.T) {
+	anonymous := func() *stripe.BalanceTransaction {
+		return withSource(validCharge("ch_anon", 500, 10), &stripe.BalanceTransactionSource{
+			Charge: &stripe.Charge{BillingDetails: &stripe.ChargeBillingDetails{Name: "Ana"}},
+		})
+	}
+	rejectSmall := &DonationPolicy{
+		Name:         "v2",
+		MissingEmail: PolicyRule{Action: PolicyQuarantine},
+		MinAmount:    &AmountRule{Limit: 100, Action: PolicyReject},
+	}
+
+	testCases := map[string]struct {
+		policy              *DonationPolicy
+		charges             []*stripe.BalanceTransaction
+		expectedErr         error
+		expectedReport      []string
+		expectedQuarantined bool
+		expectedRejected    bool
+	}{
+		"valid": {
+			policy:  DefaultDonationPolicy(),
+			charges: []*stripe.BalanceTransaction{validCharge("ch_1", 500, 10)},
+		},
+		"missingEmailQuarantined": {
+			policy:              DefaultDonationPolicy(),
+			charges:             []*stripe.BalanceTransaction{anonymous()},
+			expectedErr:         ErrQuarantined,
+			expectedReport:      []string{"ch_anon: email is missing (policy: quarantine)"},
+			expectedQuarantined: true,
+		},
+		"belowMinimumRejected": {
+			policy:           rejectSmall,
+			charges:          []*stripe.BalanceTransaction{validCharge("ch_small", 50, 10)},
+			expectedErr:      ErrRejected,
+			expectedReport:   []string{"ch_small: amount is below 100 (policy: reject)"},
+			expectedRejected: true,
+		},
+		"rejectedWithQuarantinedCharge": {
+			policy:      rejectSmall,
+			charges:     []*stripe.BalanceTransaction{validCharge("ch_small", 50, 10), anonymous()},
+			expectedErr: ErrRejected,
+			expectedReport: []string{
+				"ch_small: amount is below 100 (policy: reject)",
+				"ch_anon: email is missing (policy: quarantine)",
+			},
+			expectedRejected: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var net int64
+			for _, charge := range tc.charges {
+				net += charge.Net
+			}
+			payoutTransaction := &stripe.BalanceTransaction{ID: "txn_po", Type: "payout", Created: 123, Amount: -net, Net: -net}
+			writer := &memoryWriter{}
+			quarantine, rejected := memoryQuarantine{}, memoryQuarantine{}
+			s := &WebhookService{Repo: writer, Quarantine: quarantine, Rejected: rejected, Policy: tc.policy}
+
+			err := s.handleTransactions(&stripe.Payout{ID: "po_1", Created: 123}, payoutTransaction, tc.charges)
+			if tc.expectedErr == nil && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("Expected %v, got %v", tc.expectedErr, err)
+			}
+			if (quarantine["po_1"] != nil) != tc.expectedQuarantined || (rejected["po_1"] != nil) != tc.expectedRejected {
+				t.Errorf("Expected quarantined %v and rejected %v, got %v and %v",
+					tc.expectedQuarantined, tc.expectedRejected, quarantine["po_1"] != nil, rejected["po_1"] != nil)
+			}
+			if stored := len(writer.payouts) > 0; stored != (tc.expectedErr == nil) {
+				t.Errorf("Expected the payout to be stored: %v, got %v", tc.expectedErr == nil, stored)
+			}
+			var validationErrs ValidationErrors
+			errors.As(err, &validationErrs)
+			assertValidationErrors(t, tc.expectedReport, validationErrs)
+			for _, q := range []*model.QuarantinedPayout{quarantine["po_1"], rejected["po_1"]} {
+				if q != nil && len(q.Report) != len(tc.expectedReport) {
+					t.Errorf("Expected the stored report to have %d issues, got %d", len(tc.expectedReport), len(q.Report))
+				}
+			}
+		})
+	}
+}
+
+func validCharge(id string, amount, fee int64) *stripe.BalanceTransaction {
+	return &stripe.BalanceTransaction{
+		Type:    "charge",
+		ID:      id,
+		Created: 123,
+		Amount:  amount,
+		Fee:     fee,
+		Net:     amount - fee,
+		Source: &stripe.BalanceTransactionSource{
+			Charge: &stripe.Charge{
+				BillingDetails: &stripe.ChargeBillingDetails{
+					Email: "test@gmail.com",
+					Name:  "John Doe",
+				},
+			},
+		},
+	}
+}
+
+func withSource(charge *stripe.BalanceTransaction, source *stripe.BalanceTransactionSource) *stripe.BalanceTransaction {
+	charge.Source = source
+	return charge
+}
+
+func assertValidationErrors(t *testing.T, expected []string, errs ValidationErrors) {
+	t.Helper()
+	got := make([]string, len(errs))
+	for i, e := range errs {
+		got[i] = e.Error()
+	}
+	if len(expected) == 0 && len(got) == 0 {
+		return
+	}
+	if !slices.Equal(expected, got) {
+		t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+type memoryQuarantine map[string]*model.QuarantinedPayout
+
+func (m memoryQuarantine) WriteQuarantinedPayout(q *model.QuarantinedPayout) error {
+	m[q.PayoutId] = q
+	return nil
+}
+
+func (m memoryQuarantine) GetQuarantinedPayout(payoutId string) (*model.QuarantinedPayout, error) {
+	q, ok := m[payoutId]
+	if !ok {
+		return nil, fmt.Errorf("quarantined payout not found: %s", payoutId)
+	}
+	return q, nil
+}
+
+func (m memoryQuarantine) GetQuarantinedPayouts() ([]*model.QuarantinedPayout, error) {
+	var quarantined []*model.QuarantinedPayout
+	for _, q := range m {
+		quarantined = append(quarantined, q)
+	}
+	return quarantined, nil
+}
+
+type memoryWriter struct {
+	payouts   []*model.Payout
+	donations []*model.Donation
+}
+
+func (m *memoryWriter) WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error {
+	m.payouts = append(m.payouts, p)
+	m.donations = append(m.donations, ds...)
+	return nil
+}
+
+func TestQuarantineServiceApprove(t *testing.T) {
+	payoutTransaction := &stripe.BalanceTransaction{ID: "txn_po", Type: "payout", Created: 123, Amount: -171, Net: -171}
+	charges := []*stripe.BalanceTransaction{
+		validCharge("ch_1", 100, 10),
+		withSource(validCharge("ch_2", 100, 10), nil),
+		{ID: "fee_1", Type: "stripe_fee", Amount: -9},
+	}
+	quarantined := model.FromQuarantinedStripeData(&stripe.Payout{ID: "po_1", Created: 123}, payoutTransaction, charges)
+	_, _, _, errs := validateTransactions(payoutTransaction, charges)
+	quarantined.Report = errs.issues()
+
+	store := memoryQuarantine{"po_1": quarantined}
+	writer := &memoryWriter{}
+	s := &QuarantineService{Quarantine: store, Repo: writer}
+
+	if err := s.Annotate("po_1", "ana", "anonymous wallet payment"); err != nil {
+		t.Fatalf("Annotate failed: %v", err)
+	}
+	if _, err := s.Approve("po_1", "ana", "", false); err == nil {
+		t.Errorf("Expected approval without a reason to fail")
+	}
+	// fee_1 is left out, so the charges net 9 more than Stripe paid
+	if _, err := s.Approve("po_1", "ana", "confirmed in the Stripe dashboard", false); err == nil || !strings.Contains(err.Error(), "fee_1") {
+		t.Errorf("Expected approval with a discrepancy to fail naming fee_1, got %v", err)
+	}
+	if len(writer.payouts) != 0 {
+		t.Fatalf("Expected nothing written, got %v", writer.payouts)
+	}
+	payout, err := s.Approve("po_1", "ana", "confirmed in the Stripe dashboard", true)
+	if err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+
+	if !payout.Gross.Equal(lei(200)) || !payout.Fee.Equal(lei(20)) || !payout.Net.Equal(lei(180)) {
+		t.Errorf("Expected totals (200, 20, 180), got (%v, %v, %v)", payout.Gross, payout.Fee, payout.Net)
+	}
+	if len(writer.donations) != 2 {
+		t.Fatalf("Expected 2 donations written, got %d", len(writer.donations))
+	}
+	if d := writer.donations[1]; d.ClientEmail != "anonim@hintermann.ro" || d.Policy != "default:missing_email+missing_name;override:ana" || !appliedRule(d, "missing_email") {
+		t.Errorf("Expected ch_2 with the placeholder email and the override in its policy, got %q %q", d.ClientEmail, d.Policy)
+	}
+	approval := store["po_1"].Approval
+	if len(store["po_1"].Notes) != 1 || approval == nil || approval.Operator != "ana" {
+		t.Errorf("Expected the note and approval to be recorded, got %+v", store["po_1"])
+	}
+	if approval.Discrepancy == nil || !approval.Discrepancy.Equal(lei(-9)) || !slices.Equal(approval.Excluded, []string{"fee_1"}) {
+		t.Errorf("Expected a discrepancy of -9 from fee_1, got %v and %v", approval.Discrepancy, approval.Excluded)
+	}
+	if _, err := s.Approve("po_1", "ana", "again", true); err == nil {
+		t.Errorf("Expected a second approval to fail")
+	}
+}
+
+func TestQuarantineServiceApprovePolicy(t *testing.T) {
+	wallet := withSource(validCharge("ch_wallet", 500, 10), &stripe.BalanceTransactionSource{
+		Charge: &stripe.Charge{
+			BillingDetails: &stripe.ChargeBillingDetails{Name: "Ana", Email: "ana@example.com"},
+			PaymentMethodDetails: &stripe.ChargePaymentMethodDetails{
+				Type: "card",
+				Card: &stripe.ChargePaymentMethodDetailsCard{
+					Wallet: &stripe.ChargePaymentMethodDetailsCardWallet{Type: "google_pay"},
+				},
+			},
+		},
+	})
+	payoutTransaction := &stripe.BalanceTransaction{ID: "txn_po", Type: "payout", Created: 123, Amount: -490, Net: -490}
+	quarantined := model.FromQuarantinedStripeData(&stripe.Payout{ID: "po_1", Created: 123}, payoutTransaction, []*stripe.BalanceTransaction{wallet})
+
+	testCases := map[string]struct {
+		action         PolicyAction
+		expectedPolicy string
+		expectedErr    bool
+	}{
+		"walletQuarantined": {action: PolicyQuarantine, expectedPolicy: "v2:payment_types;override:ana"},
+		"walletRejected":    {action: PolicyReject, expectedErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			q := *quarantined
+			writer := &memoryWriter{}
+			s := &QuarantineService{Quarantine: memoryQuarantine{"po_1": &q}, Repo: writer, Policy: &DonationPolicy{
+				Name:         "v2",
+				MissingEmail: PolicyRule{Action: PolicyQuarantine},
+				PaymentTypes: &PaymentTypeRule{Allowed: []string{"card", "apple_pay"}, Action: tc.action},
+			}}
+			_, err := s.Approve("po_1", "ana", "checked", false)
+			if tc.expectedErr {
+				if err == nil || len(writer.donations) != 0 {
+					t.Errorf("Expected the approval to fail, got %v and %v", err, writer.donations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Approve failed: %v", err)
+			}
+			if writer.donations[0].Policy != tc.expectedPolicy {
+				t.Errorf("Expected policy %q, got %q", tc.expectedPolicy, writer.donations[0].Policy)
+			}
+		})
+	}
+}
+
+type memoryExport struct {
+	memoryWriter
+}
+
+func (m *memoryExport) GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error) {
+	if cursor >= len(m.payouts) {
+		return nil, nil
+	}
+	end := min(cursor+limit, len(m.payouts))
+	return m.payouts[cursor:end], nil
+}
+
+func (m *memoryExport) GetDonationsByPayoutId(payoutId string) ([]*model.Donation, error) {
+	var donations []*model.Donation
+	for _, d := range m.donations {
+		if d.PayoutId == payoutId {
+			donations = append(donations, d)
+		}
+	}
+	return donations, nil
+}
+
+func (m *memoryExport) GetPayoutById(id string) (*model.Payout, error) {
+	for _, p := range m.payouts {
+		if p.Id == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("payout %w: %s", ErrNotFound, id)
+}
+
+func (m *memoryExport) QueryDonations(q DonationQuery) (*DonationPage, error) {
+	return FilterDonations(m.donations, q)
+}
+
+type memorySync struct {
+	memoryLedger
+}
+
+func (m *memorySync) ReplaceDonor(d *ExportedDonor) error {
+	for _, donation := range m.donations {
+		if donation.Id == d.DonationId {
+			donation.ClientName, donation.ClientEmail = d.ClientName, d.ClientEmail
+			m.corrections = slices.DeleteFunc(m.corrections, func(c *model.Correction) bool { return c.DonationId == d.DonationId })
+			m.corrections = append(m.corrections, d.Corrections...)
+			return nil
+		}
+	}
+	return fmt.Errorf("donation %w: %s", ErrNotFound, d.DonationId)
+}
+
+func TestExportAndSync(t *testing.T) {
+	source := &memoryLedger{}
+	for _, id := range []string{"po_1", "po_2", "po_3"} {
+		p := &model.Payout{Id: id, Created: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), Gross: lei(200), Fee: lei(20), Net: lei(180)}
+		ds := []*model.Donation{
+			{Id: id + "_ch_1", PayoutId: id, Created: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), ClientName: "Ana", ClientEmail: "ana@example.com", Gross: lei(100), Fee: lei(10), Net: lei(90)},
+			{Id: id + "_ch_2", PayoutId: id, Created: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), ClientName: "Ion", ClientEmail: "ion@example.com", Gross: lei(100), Fee: lei(10), Net: lei(90)},
+		}
+		source.chain(func(head *LedgerEntry) []*LedgerEntry { return ChainLedger(head, []*model.Payout{p}, ds, nil) })
+		source.WritePayoutAndDonations(p, ds)
+	}
+	restored := slices.Clone(source.entries)
+
+	// po_1_ch_1 is corrected, po_2_ch_2 erased
+	stored := *source.donations[0]
+	source.corrections = []*model.Correction{{DonationId: "po_1_ch_1", Field: model.CorrectionClientName, OldValue: "Ana", NewValue: "Ana Maria", Operator: "ion"}}
+	source.donations[0].ClientName = "Ana Maria"
+	source.chain(func(head *LedgerEntry) []*LedgerEntry {
+		return ChainDonors(head, []*model.Donation{&stored}, source.corrections)
+	})
+	source.donations[3].ClientName, source.donations[3].ClientEmail = "erased-1", "erased-1@erased.invalid"
+	source.chain(func(head *LedgerEntry) []*LedgerEntry { return ChainDonors(head, source.donations[3:4], nil) })
+
+	export := &ExportService{Repo: source}
+	target := &memorySync{}
+	sync := &SyncService{Repo: target}
+
+	cursor, changes := "", 0
+	for {
+		batch, err := export.Export(cursor, 2)
+		if err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		if err := sync.Apply(batch); err != nil {
+			t.Fatalf("Apply failed: %v", err)
+		}
+		cursor, changes = batch.Cursor, changes+len(batch.Changes)
+		if !batch.More {
+			break
+		}
+	}
+
+	if head := source.entries[len(source.entries)-1]; cursor != FormatCursor(head) || changes != 5 {
+		t.Errorf("Expected 5 changes up to cursor %s, got %d up to %s", FormatCursor(head), changes, cursor)
+	}
+	if len(target.payouts) != 3 || len(target.donations) != 6 {
+		t.Fatalf("Expected 3 payouts and 6 donations, got %d and %d", len(target.payouts), len(target.donations))
+	}
+	if d := target.donations[0]; d.ClientName != "Ana" || len(target.corrections) != 1 || target.corrections[0].NewValue != "Ana Maria" {
+		t.Errorf("Expected the stored name and its correction, got %q and %+v", d.ClientName, target.corrections)
+	}
+	if d := target.donations[3]; d.ClientName != "erased-1" || d.ClientEmail != "erased-1@erased.invalid" {
+		t.Errorf("Expected the erasure to be synced, got %q and %q", d.ClientName, d.ClientEmail)
+	}
+
+	if batch, err := export.Export(cursor, 2); err != nil || len(batch.Changes) != 0 || batch.Cursor != cursor {
+		t.Errorf("Expected no changes after the last cursor, got %+v, %v", batch, err)
+	}
+	if _, err := export.Export("nope", 2); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected an invalid cursor to fail, got %v", err)
+	}
+	source.entries = restored
+	if _, err := export.Export(cursor, 2); !errors.Is(err, ErrCursorMismatch) {
+		t.Errorf("Expected a cursor past the restored ledger to be rejected, got %v", err)
+	}
+	source.chain(func(head *LedgerEntry) []*LedgerEntry { return ChainDonors(head, source.donations[:2], nil) })
+	if _, err := export.Export(cursor, 2); !errors.Is(err, ErrCursorMismatch) {
+		t.Errorf("Expected a cursor naming a rewritten entry to be rejected, got %v", err)
+	}
+}
+
+func TestCheckExportedPayout(t *testing.T) {
+	payout := func() *model.Payout {
+		return &model.Payout{Id: "po_1", Gross: lei(200), Fee: lei(20), Net: lei(180)}
+	}
+	donation := func(payoutId string, gross model.Money) *model.Donation {
+		return &model.Donation{Id: "ch_" + gross.MinorUnits(), PayoutId: payoutId, Gross: gross, Fee: lei(10), Net: lei(90)}
+	}
+
+	testCases := map[string]struct {
+		input       *ExportedPayout
+		expectedErr bool
+	}{
+		"valid": {
+			input: &ExportedPayout{Payout: payout(), Donations: []*model.Donation{donation("po_1", lei(100)), donation("po_1", lei(100))}},
+		},
+		"noDonations": {
+			input:       &ExportedPayout{Payout: payout()},
+			expectedErr: true,
+		},
+		"foreignDonation": {
+			input:       &ExportedPayout{Payout: payout(), Donations: []*model.Donation{donation("po_1", lei(100)), donation("po_2", lei(100))}},
+			expectedErr: true,
+		},
+		"sumMismatch": {
+			input:       &ExportedPayout{Payout: payout(), Donations: []*model.Donation{donation("po_1", lei(100)), donation("po_1", lei(101))}},
+			expectedErr: true,
+		},
+		"mixedCurrencies": {
+			input:       &ExportedPayout{Payout: payout(), Donations: []*model.Donation{donation("po_1", lei(100)), donation("po_1", model.NewMoney(100, "eur"))}},
+			expectedErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := CheckExportedPayout(tc.input)
+			if (err != nil) != tc.expectedErr {
+				t.Errorf("Expected error: %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestImportStripeReports(t *testing.T) {
+	balanceChange := `balance_transaction_id,created_utc,available_on_utc,currency,gross,fee,net,reporting_category,source_id,description,customer_email,customer_name
+txn_1,2024-03-01 10:00:00,2024-03-03 00:00:00,ron,100.00,10.00,90.00,charge,ch_1,,ana@example.com,Ana
+txn_po_1,2024-03-05 02:00:00,2024-03-05 00:00:00,ron,-180.00,0.00,-180.00,payout,po_1,STRIPE PAYOUT,,
+txn_po_2,2024-03-06 02:00:00,2024-03-06 00:00:00,ron,-90.00,0.00,-90.00,payout,po_2,STRIPE PAYOUT,,
+`
+	reconciliation := `automatic_payout_id,balance_transaction_id,created_utc,gross,fee,net,reporting_category,source_id,customer_email,customer_name
+po_1,txn_1,2024-03-01 10:00:00,100.00,10.00,90.00,charge,ch_1,,
+po_1,txn_2,2024-03-02 11:00:00,100.00,10.00,90.00,charge,ch_2,ion@example.com,Ion
+po_2,txn_3,2024-03-03 12:00:00,"1,000.00",10.00,990.00,charge,ch_3,maria@example.com,Maria
+`
+	var reports []*StripeReport
+	for _, data := range []string{balanceChange, reconciliation} {
+		report, err := ParseStripeReport(strings.NewReader(data))
+		if err != nil {
+			t.Fatalf("ParseStripeReport failed: %v", err)
+		}
+		reports = append(reports, report)
+	}
+	if reports[0].Format != BalanceChangeReport || reports[1].Format != PayoutReconciliationReport {
+		t.Fatalf("Expected balance change and reconciliation formats, got %q and %q", reports[0].Format, reports[1].Format)
+	}
+
+	store := &memoryExport{}
+	s := &ImportService{Repo: store}
+	result, err := s.Import(reports)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(result.Imported) != 1 || result.Imported[0] != "po_1" {
+		t.Errorf("Expected po_1 to be imported, got %v", result.Imported)
+	}
+	if len(result.Failed["po_2"]) != 1 || result.Failed["po_2"][0].Field != "amount" {
+		t.Errorf("Expected po_2 to fail the sum check, got %v", result.Failed["po_2"])
+	}
+	if len(store.donations) != 2 || store.donations[0].ClientEmail != "ana@example.com" {
+		t.Errorf("Expected 2 donations with merged customer details, got %+v", store.donations)
+	}
+	if !store.payouts[0].Created.Equal(time.Date(2024, time.March, 5, 2, 0, 0, 0, time.UTC)) || !store.payouts[0].Net.Equal(lei(18000)) {
+		t.Errorf("Expected payout created 2024-03-05 02:00 with net 18000, got %+v", store.payouts[0])
+	}
+
+	result, err = s.Import(reports)
+	if err != nil {
+		t.Fatalf("Second import failed: %v", err)
+	}
+	if len(result.Imported) != 0 || len(result.Existing) != 1 || len(store.payouts) != 1 {
+		t.Errorf("Expected the second import to skip po_1, got %+v", result)
+	}
+
+	// the charges are stored, but not the payout
+	store.payouts = nil
+	result, err = s.Import(reports)
+	if err != nil {
+		t.Fatalf("Import without the payout failed: %v", err)
+	}
+	if len(result.Imported) != 0 || len(result.Failed["po_1"]) != 2 || result.Failed["po_1"][0].Field != "id" {
+		t.Errorf("Expected po_1 to fail with its stored charges, got %+v", result)
+	}
+
+	// the payout is stored without donations
+	store.payouts, store.donations = []*model.Payout{{Id: "po_1"}}, nil
+	result, err = s.Import(reports)
+	if err != nil {
+		t.Fatalf("Import without the donations failed: %v", err)
+	}
+	if len(result.Imported) != 0 || len(result.Existing) != 1 {
+		t.Errorf("Expected po_1 to be skipped as stored, got %+v", result)
+	}
+}
+
+func TestParseReportAmount(t *testing.T) {
+	testCases := map[string]struct {
+		input       string
+		expected    int64
+		expectedErr bool
+	}{
+		"whole":      {input: "12", expected: 1200},
+		"oneDecimal": {input: "12.5", expected: 1250},
+		"thousands":  {input: "1,234.56", expected: 123456},
+		"negative":   {input: "-0.50", expected: -50},
+		"tooPrecise": {input: "1.234", expectedErr: true},
+		"empty":      {input: "", expectedErr: true},
+		"notANumber": {input: "abc", expectedErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			amount, err := parseReportAmount(tc.input)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Expected error: %v, got %v", tc.expectedErr, err)
+			}
+			if amount != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, amount)
+			}
+		})
+	}
+}
+
+type memoryRaw struct {
+	payouts, donations []*RawRow
+}
+
+func (m *memoryRaw) RawPayouts() ([]*RawRow, error)   { return m.payouts, nil }
+func (m *memoryRaw) RawDonations() ([]*RawRow, error) { return m.donations, nil }
+
+func TestVerify(t *testing.T) {
+	payout := func(id, gross, fee, net string) *RawRow {
+		return &RawRow{Source: "payouts.csv", Id: id, Created: "2025-03-03T10:00:00Z", Gross: gross, Fee: fee, Net: net, Currency: "ron"}
+	}
+	donation := func(id, payoutId, gross, fee, net string) *RawRow {
+		return &RawRow{Source: "donations.csv", Id: id, PayoutId: payoutId, Created: "2025-03-01T10:00:00Z", Gross: gross, Fee: fee, Net: net, Currency: "ron"}
+	}
+	badDate := donation("txn_1", "po_1", "100", "10", "90")
+	badDate.Created = "1 Mar 2025"
+
+	testCases := map[string]struct {
+		payouts        []*RawRow
+		donations      []*RawRow
+		expectedIssues []string
+	}{
+		"consistent": {
+			payouts:   []*RawRow{payout("po_1", "300", "20", "280")},
+			donations: []*RawRow{donation("txn_1", "po_1", "100", "10", "90"), donation("txn_2", "po_1", "200", "10", "190")},
+		},
+		"sumMismatch": {
+			payouts:        []*RawRow{payout("po_1", "300", "20", "280")},
+			donations:      []*RawRow{donation("txn_1", "po_1", "100", "10", "90")},
+			expectedIssues: []string{"po_1 fee", "po_1 gross", "po_1 net"},
+		},
+		"duplicates": {
+			payouts:        []*RawRow{payout("po_1", "100", "10", "90"), payout("po_1", "100", "10", "90")},
+			donations:      []*RawRow{donation("txn_1", "po_1", "100", "10", "90"), donation("txn_1", "po_1", "100", "10", "90")},
+			expectedIssues: []string{"po_1 id", "txn_1 id"},
+		},
+		"orphanDonation": {
+			payouts:        []*RawRow{payout("po_1", "100", "10", "90")},
+			donations:      []*RawRow{donation("txn_1", "po_1", "100", "10", "90"), donation("txn_2", "po_9", "100", "10", "90")},
+			expectedIssues: []string{"txn_2 payout_id"},
+		},
+		"netMismatch": {
+			payouts:        []*RawRow{payout("po_1", "100", "10", "91")},
+			donations:      []*RawRow{donation("txn_1", "po_1", "100", "10", "91")},
+			expectedIssues: []string{"po_1 net", "txn_1 net"},
+		},
+		"malformedAmountAndDate": {
+			payouts:        []*RawRow{payout("po_1", "100", "10", "90")},
+			donations:      []*RawRow{badDate, donation("txn_2", "po_1", "1O0", "10", "90")},
+			expectedIssues: []string{"txn_1 created", "txn_2 gross"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			report, err := (&VerifyService{Repo: &memoryRaw{payouts: tc.payouts, donations: tc.donations}}).Verify()
+			if err != nil {
+				t.Fatalf("Verify failed: %v", err)
+			}
+			var issues []string
+			for _, issue := range report.Issues {
+				issues = append(issues, issue.Id+" "+issue.Field)
+			}
+			slices.Sort(issues)
+			if !slices.Equal(issues, tc.expectedIssues) {
+				t.Errorf("Expected issues %v, got %v", tc.expectedIssues, issues)
+			}
+		})
+	}
+}
+
+type memorySubject struct {
+	donations   []*model.Donation
+	corrections []*model.Correction
+}
+
+func (m *memorySubject) QueryDonations(q DonationQuery) (*DonationPage, error) {
+	return FilterDonations(m.donations, q)
+}
+
+func (m *memorySubject) GetCorrections(donationId string) ([]*model.Correction, error) {
+	var filtered []*model.Correction
+	for _, c := range m.corrections {
+		if c.DonationId == donationId {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+// WriteCorrection applies the correction in place, like the effective
+// values the repos return.
+func (m *memorySubject) WriteCorrection(c *model.Correction) error {
+	m.corrections = append(m.corrections, c)
+	model.ApplyCorrections(m.donations, []*model.Correction{c})
+	return nil
+}
+
+func (m *memorySubject) PseudonymizeDonor(email string, p Pseudonym) ([]string, error) {
+	var ids []string
+	for _, d := range m.donations {
+		if strings.EqualFold(d.ClientEmail, email) {
+			d.ClientName, d.ClientEmail = p.Name, p.Email
+			ids = append(ids, d.Id)
+		}
+	}
+	return ids, nil
+}
+
+type memoryErasureLog []*ErasureRecord
+
+func (m *memoryErasureLog) AppendErasure(e *ErasureRecord) error {
+	*m = append(*m, e)
+	return nil
+}
+
+func TestSubjectService(t *testing.T) {
+	repo := &memorySubject{donations: []*model.Donation{
+		{Id: "txn_1", ClientName: "Ana", ClientEmail: "ana@example.com", PayoutId: "po_1", Gross: lei(100), Fee: lei(10), Net: lei(90)},
+		{Id: "txn_2", ClientName: "Ion", ClientEmail: "ion@example.com", PayoutId: "po_1", Gross: lei(200), Fee: lei(10), Net: lei(190)},
+		{Id: "txn_3", ClientName: "Ana", ClientEmail: "Ana@Example.com", PayoutId: "po_2", Gross: lei(300), Fee: lei(10), Net: lei(290)},
+	}}
+	quarantine := memoryQuarantine{"po_3": {PayoutId: "po_3", Charges: []*model.QuarantinedTransaction{
+		{Id: "ch_4", ClientName: "Ana", ClientEmail: "ana@example.com"},
+		{Id: "ch_5", ClientName: "Ion", ClientEmail: "ion@example.com"},
+	}}}
+	rejected := memoryQuarantine{"po_4": {PayoutId: "po_4", Charges: []*model.QuarantinedTransaction{
+		{Id: "ch_6", ClientName: "Ana", ClientEmail: "ANA@example.com"},
+	}}}
+	log := &memoryErasureLog{}
+	s := &SubjectService{Repo: repo, Quarantine: quarantine, Rejected: rejected, Log: log}
+
+	records, err := s.Export("ana@example.com")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(records.Donations) != 2 || len(records.Quarantined) != 1 || records.Quarantined[0].Id != "ch_4" {
+		t.Errorf("Expected 2 donations and ch_4, got %d donations and %v", len(records.Donations), records.Quarantined)
+	}
+	if len(records.Rejected) != 1 || records.Rejected[0].Id != "ch_6" {
+		t.Errorf("Expected the rejected ch_6, got %v", records.Rejected)
+	}
+
+	if _, err := s.Erase("ana@example.com", "ion", ""); err == nil {
+		t.Errorf("Expected erasure without a reason to fail")
+	}
+	record, err := s.Erase("ana@example.com", "ion", "request 2025-04")
+	if err != nil {
+		t.Fatalf("Erase failed: %v", err)
+	}
+	if !slices.Equal(record.DonationIds, []string{"txn_1", "txn_3"}) || !slices.Equal(record.QuarantinedPayouts, []string{"po_3"}) {
+		t.Errorf("Expected txn_1, txn_3 and po_3 to be erased, got %v and %v", record.DonationIds, record.QuarantinedPayouts)
+	}
+	for _, d := range repo.donations {
+		if d.ClientName == "Ana" || strings.Contains(strings.ToLower(d.ClientEmail), "ana@") {
+			t.Errorf("Expected %s to be pseudonymized, got %q %q", d.Id, d.ClientName, d.ClientEmail)
+		}
+	}
+	if !repo.donations[0].Gross.Equal(lei(100)) || repo.donations[1].ClientName != "Ion" {
+		t.Errorf("Expected amounts and other donors to be kept, got %+v", repo.donations[:2])
+	}
+	if charge := quarantine["po_3"].Charges[0]; charge.ClientName != record.Pseudonym {
+		t.Errorf("Expected the quarantined charge to be pseudonymized, got %q", charge.ClientName)
+	}
+	if charge := rejected["po_4"].Charges[0]; charge.ClientName != record.Pseudonym || !slices.Equal(record.RejectedPayouts, []string{"po_4"}) {
+		t.Errorf("Expected the rejected charge to be pseudonymized, got %q and %v", charge.ClientName, record.RejectedPayouts)
+	}
+	if len(*log) != 1 || strings.Contains(fmt.Sprint(*(*log)[0]), "ana@") {
+		t.Errorf("Expected one log entry without the email, got %v", *log)
+	}
+	if _, err := s.Erase("ana@example.com", "ion", "again"); err == nil {
+		t.Errorf("Expected a second erasure to find nothing")
+	}
+}
+
+func TestAmendService(t *testing.T) {
+	repo := &memorySubject{donations: []*model.Donation{
+		{Id: "txn_1", ClientName: "Ana", ClientEmail: "ana@example.com", PayoutId: "po_1", Gross: lei(100), Fee: lei(10), Net: lei(90)},
+	}}
+	s := &AmendService{Repo: repo}
+
+	testCases := map[string]struct {
+		donationId string
+		field      string
+		value      string
+		reason     string
+	}{
+		"unknownDonation": {donationId: "txn_9", field: model.CorrectionClientName, value: "Ana Pop", reason: "typo"},
+		"amountField":     {donationId: "txn_1", field: "gross", value: "1", reason: "typo"},
+		"invalidEmail":    {donationId: "txn_1", field: model.CorrectionClientEmail, value: "ana", reason: "typo"},
+		"unchanged":       {donationId: "txn_1", field: model.CorrectionClientName, value: "Ana", reason: "typo"},
+		"noReason":        {donationId: "txn_1", field: model.CorrectionClientName, value: "Ana Pop"},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := s.Amend(tc.donationId, tc.field, tc.value, "ion", tc.reason); err == nil {
+				t.Errorf("Expected the amendment to fail")
+			}
+		})
+	}
+
+	if _, err := s.Amend("txn_1", model.CorrectionClientEmail, "ana.pop@example.com", "ion", "donor asked"); err != nil {
+		t.Fatalf("Amend failed: %v", err)
+	}
+	if _, err := s.Amend("txn_1", model.CorrectionClientEmail, " ana@pop.ro ", "maria", "second request"); err != nil {
+		t.Fatalf("Amend failed: %v", err)
+	}
+	donation, history, err := s.History("txn_1")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if donation.ClientEmail != "ana@pop.ro" || donation.ClientName != "Ana" {
+		t.Errorf("Expected the latest email, got %q %q", donation.ClientName, donation.ClientEmail)
+	}
+	if len(history) != 2 || history[0].OldValue != "ana@example.com" || history[1].OldValue != "ana.pop@example.com" || history[1].Operator != "maria" {
+		t.Errorf("Expected the two corrections in order, got %+v", history)
+	}
+	if !donation.Gross.Equal(lei(100)) {
+		t.Errorf("Expected the amounts to be kept, got %s", donation.Gross)
+	}
+}
+
+type memoryLedger struct {
+	memoryExport
+	entries     []*LedgerEntry
+	corrections []*model.Correction
+}
+
+// chain appends entries after the head, as a repo write does.
+func (m *memoryLedger) chain(fn func(head *LedgerEntry) []*LedgerEntry) {
+	var head *LedgerEntry
+	if len(m.entries) > 0 {
+		head = m.entries[len(m.entries)-1]
+	}
+	m.entries = append(m.entries, fn(head)...)
+}
+
+func (m *memoryLedger) GetCorrections(donationId string) ([]*model.Correction, error) {
+	var corrections []*model.Correction
+	for _, c := range m.corrections {
+		if c.DonationId == donationId {
+			corrections = append(corrections, c)
+		}
+	}
+	return corrections, nil
+}
+
+func (m *memoryLedger) GetLedger() ([]*LedgerEntry, error) { return m.entries, nil }
+
+func (m *memoryLedger) GetPayoutsAfter(cursor, limit int) ([]*model.Payout, error) {
+	return m.payouts, nil
+}
+
+func (m *memoryLedger) QueryDonations(q DonationQuery) (*DonationPage, error) {
+	return FilterDonations(m.donations, q)
+}
+
+func TestVerifyChain(t *testing.T) {
+	newLedger := func() *memoryLedger {
+		m := &memoryLedger{}
+		for _, id := range []string{"po_1", "po_2"} {
+			p := &model.Payout{Id: id, Created: time.Unix(100, 0).UTC(), Gross: lei(100), Fee: lei(10), Net: lei(90)}
+			ds := []*model.Donation{{Id: "txn_" + id, PayoutId: id, Created: time.Unix(50, 0).UTC(), ClientName: "Ana", ClientEmail: "ana@example.com", Gross: lei(100), Fee: lei(10), Net: lei(90)}}
+			m.chain(func(head *LedgerEntry) []*LedgerEntry { return ChainLedger(head, []*model.Payout{p}, ds, nil) })
+			m.WritePayoutAndDonations(p, ds)
+		}
+		return m
+	}
+
+	testCases := map[string]struct {
+		tamper        func(m *memoryLedger)
+		expectedBreak *ChainBreak
+	}{
+		"intact": {tamper: func(m *memoryLedger) {}},
+		"changedAmount": {
+			tamper:        func(m *memoryLedger) { m.donations[0].Gross = lei(900) },
+			expectedBreak: &ChainBreak{Seq: 2, Kind: LedgerDonation, Id: "txn_po_1", Reason: "row was changed after it was chained"},
+		},
+		"changedPolicy": {
+			tamper:        func(m *memoryLedger) { m.donations[1].Policy = "override:ana" },
+			expectedBreak: &ChainBreak{Seq: 5, Kind: LedgerDonation, Id: "txn_po_2", Reason: "row was changed after it was chained"},
+		},
+		"donorEditedOutOfBand": {
+			tamper:        func(m *memoryLedger) { m.donations[0].ClientName = "Ana Maria" },
+			expectedBreak: &ChainBreak{Seq: 3, Kind: LedgerDonor, Id: "txn_po_1", Reason: "row was changed after it was chained"},
+		},
+		"donorErased": {
+			tamper: func(m *memoryLedger) {
+				m.donations[0].ClientName, m.donations[0].ClientEmail = "erased-1", "erased-1@erased.invalid"
+				m.chain(func(head *LedgerEntry) []*LedgerEntry { return ChainDonors(head, m.donations[:1], nil) })
+			},
+		},
+		"donorCorrected": {
+			tamper: func(m *memoryLedger) {
+				stored := *m.donations[0]
+				m.corrections = append(m.corrections, &model.Correction{DonationId: "txn_po_1", Field: model.CorrectionClientName, OldValue: "Ana", NewValue: "Ana Maria", Operator: "ion"})
+				m.donations[0].ClientName = "Ana Maria"
+				m.chain(func(head *LedgerEntry) []*LedgerEntry {
+					return ChainDonors(head, []*model.Donation{&stored}, m.corrections)
+				})
+			},
+		},
+		"correctionEditedOutOfBand": {
+			tamper: func(m *memoryLedger) {
+				stored := *m.donations[0]
+				m.corrections = append(m.corrections, &model.Correction{DonationId: "txn_po_1", Field: model.CorrectionClientName, OldValue: "Ana", NewValue: "Ana Maria", Operator: "ion"})
+				m.donations[0].ClientName = "Ana Maria"
+				m.chain(func(head *LedgerEntry) []*LedgerEntry {
+					return ChainDonors(head, []*model.Donation{&stored}, m.corrections)
+				})
+				m.corrections[0].Operator = "maria"
+			},
+			expectedBreak: &ChainBreak{Seq: 7, Kind: LedgerDonor, Id: "txn_po_1", Reason: "row was changed after it was chained"},
+		},
+		"removedEntry": {
+			tamper:        func(m *memoryLedger) { m.entries = append(m.entries[:1], m.entries[2:]...) },
+			expectedBreak: &ChainBreak{Seq: 3, Kind: LedgerDonor, Id: "txn_po_1", Reason: "sequence number should be 2"},
+		},
+		"rehashedEntry": {
+			tamper: func(m *memoryLedger) {
+				m.payouts[1].Net = lei(0)
+				m.entries[3] = ChainLedger(m.entries[2], m.payouts[1:2], nil, nil)[0]
+			},
+			expectedBreak: &ChainBreak{Seq: 5, Kind: LedgerDonation, Id: "txn_po_2", Reason: "previous hash does not match the entry before it"},
+		},
+		"missingRow": {
+			tamper:        func(m *memoryLedger) { m.payouts = m.payouts[1:] },
+			expectedBreak: &ChainBreak{Seq: 1, Kind: LedgerPayout, Id: "po_1", Reason: "row is missing"},
+		},
+		"unchainedRow": {
+			tamper: func(m *memoryLedger) {
+				m.donations = append(m.donations, &model.Donation{Id: "txn_x", PayoutId: "po_1", Gross: lei(1), Fee: lei(0), Net: lei(1)})
+			},
+			expectedBreak: &ChainBreak{Kind: LedgerDonation, Id: "txn_x", Reason: "row is not in the ledger"},
+		},
+		"deletedLedger": {
+			tamper:        func(m *memoryLedger) { m.entries = nil },
+			expectedBreak: &ChainBreak{Kind: LedgerPayout, Id: "po_1", Reason: "the ledger is missing or empty, but rows are stored"},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := newLedger()
+			tc.tamper(m)
+			report, err := (&LedgerService{Repo: m}).VerifyChain()
+			if err != nil {
+				t.Fatalf("VerifyChain failed: %v", err)
+			}
+			if !reflect.DeepEqual(report.Break, tc.expectedBreak) {
+				t.Errorf("Expected break %+v, got %+v", tc.expectedBreak, report.Break)
+			}
+			if tc.expectedBreak == nil && report.Head != m.entries[len(m.entries)-1] {
+				t.Errorf("Expected head %+v, got %+v", m.entries[len(m.entries)-1], report.Head)
+			}
+		})
+	}
+}
+
+func TestLedgerServiceCheckInitialized(t *testing.T) {
+	p := &model.Payout{Id: "po_1", Created: time.Unix(100, 0).UTC(), Gross: lei(100), Fee: lei(10), Net: lei(90)}
+	testCases := map[string]struct {
+		payouts     []*model.Payout
+		entries     []*LedgerEntry
+		expectedErr bool
+	}{
+		"empty":     {},
+		"chained":   {payouts: []*model.Payout{p}, entries: ChainLedger(nil, []*model.Payout{p}, nil, nil)},
+		"unchained": {payouts: []*model.Payout{p}, expectedErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m := &memoryLedger{entries: tc.entries}
+			m.payouts = tc.payouts
+			if err := (&LedgerService{Repo: m}).CheckInitialized(); (err != nil) != tc.expectedErr {
+				t.Errorf("Expected error %v, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+type memoryReports struct {
+	memoryExport
+}
+
+func (m *memoryReports) GetPayoutsByMonth(start time.Time) ([]*model.Payout, error) {
+	payouts, _ := m.GetPayoutsBetween(start, start.AddDate(0, 1, 0))
+	if len(payouts) == 0 {
+		return nil, fmt.Errorf("no payouts found for %d-%02d", start.Year(), start.Month())
+	}
+	return payouts, nil
+}
+
+func (m *memoryReports) GetPayoutsBetween(start, end time.Time) ([]*model.Payout, error) {
+	var payouts []*model.Payout
+	for _, p := range m.payouts {
+		if !p.Created.Before(start) && p.Created.Before(end) {
+			payouts = append(payouts, p)
+		}
+	}
+	return payouts, nil
+}
+
+func (m *memoryReports) GetPayoutById(id string) (*model.Payout, error) {
+	for _, p := range m.payouts {
+		if p.Id == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("payout %w: %s", ErrNotFound, id)
+}
+
+func (m *memoryReports) QueryDonations(q DonationQuery) (*DonationPage, error) {
+	return FilterDonations(m.donations, q)
+}
+
+func (m *memoryReports) GetLedgerHead() (*LedgerEntry, error) {
+	return &LedgerEntry{Seq: 7, Hash: "abc"}, nil
+}
+
+func newMemoryReports() *memoryReports {
+	m := &memoryReports{}
+	add := func(id string, created time.Time, amounts ...int64) {
+		p := &model.Payout{Id: id, Created: created, Gross: lei(0), Fee: lei(0), Net: lei(0)}
+		for i, amount := range amounts {
+			d := &model.Donation{
+				Id: fmt.Sprintf("txn_%s_%d", id, i), Created: created.AddDate(0, 0, -2), PayoutId: id,
+				ClientName: "Ana", ClientEmail: "ana@example.com",
+				Gross: lei(amount), Fee: lei(amount / 10), Net: lei(amount - amount/10),
+			}
+			p.Gross, _ = p.Gross.Add(d.Gross)
+			p.Fee, _ = p.Fee.Add(d.Fee)
+			p.Net, _ = p.Net.Add(d.Net)
+			m.donations = append(m.donations, d)
+		}
+		m.payouts = append(m.payouts, p)
+	}
+	add("po_1", time.Date(2024, time.December, 30, 0, 0, 0, 0, time.UTC), 5000)
+	add("po_2", time.Date(2025, time.January, 10, 0, 0, 0, 0, time.UTC), 1000, 2000)
+	add("po_3", time.Date(2025, time.January, 20, 0, 0, 0, 0, time.UTC), 3000)
+	add("po_4", time.Date(2025, time.March, 5, 0, 0, 0, 0, time.UTC), 4000)
+	return m
+}
+
+func TestGetAnnualReport(t *testing.T) {
+	s := &ReportService{Repo: newMemoryReports()}
+
+	report, err := s.GetAnnualReport(2025)
+	if err != nil {
+		t.Fatalf("GetAnnualReport failed: %v", err)
+	}
+	if report.Gross != lei(10000).String() || report.Fee != lei(1000).String() || report.Donations != "4" || len(report.Payouts) != 3 {
+		t.Errorf("Expected 100 lei gross, 10 lei fees, 4 donations and 3 payouts, got %+v", report)
+	}
+	if len(report.Months) != 12 {
+		t.Fatalf("Expected 12 months, got %d", len(report.Months))
+	}
+	january, february, march := report.Months[0], report.Months[1], report.Months[2]
+	if january.Payouts != "2" || january.Donations != "3" || january.Net != lei(5400).String() {
+		t.Errorf("Expected 2 payouts, 3 donations and 54 lei net in January, got %+v", january)
+	}
+	if february.Payouts != "0" || february.Gross != lei(0).String() {
+		t.Errorf("Expected an empty February, got %+v", february)
+	}
+	if march.Month != "Martie" || march.Donations != "1" {
+		t.Errorf("Expected one donation in Martie, got %+v", march)
+	}
+	if report.YearStart != "1 Jan 2025" || report.YearEnd != "31 Dec 2025" || report.LedgerHead != "#7 abc" {
+		t.Errorf("Unexpected period or ledger head: %s - %s, %s", report.YearStart, report.YearEnd, report.LedgerHead)
+	}
+
+	if _, err := s.GetAnnualReport(2023); err == nil {
+		t.Errorf("Expected a year without payouts to fail")
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	date := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	quarter := func(year, q int) (Period, error) { return QuarterPeriod(year, q) }
+	testCases := map[string]struct {
+		period        func() (Period, error)
+		expectedErr   bool
+		expectedStart time.Time
+		expectedLast  time.Time
+	}{
+		"february":     {period: func() (Period, error) { return MonthPeriod(2024, time.February), nil }, expectedStart: date(2024, 2, 1), expectedLast: date(2024, 2, 29)},
+		"firstQuarter": {period: func() (Period, error) { return quarter(2025, 1) }, expectedStart: date(2025, 1, 1), expectedLast: date(2025, 3, 31)},
+		"lastQuarter":  {period: func() (Period, error) { return quarter(2025, 4) }, expectedStart: date(2025, 10, 1), expectedLast: date(2025, 12, 31)},
+		"noQuarter":    {period: func() (Period, error) { return quarter(2025, 5) }, expectedErr: true},
+		"range": {
+			period:        func() (Period, error) { return RangePeriod(date(2025, 1, 15).Add(13*time.Hour), date(2025, 2, 14)) },
+			expectedStart: date(2025, 1, 15), expectedLast: date(2025, 2, 14),
+		},
+		"singleDay":     {period: func() (Period, error) { return RangePeriod(date(2025, 1, 15), date(2025, 1, 15)) }, expectedStart: date(2025, 1, 15), expectedLast: date(2025, 1, 15)},
+		"reversedRange": {period: func() (Period, error) { return RangePeriod(date(2025, 2, 1), date(2025, 1, 1)) }, expectedErr: true},
+		"openRange":     {period: func() (Period, error) { return RangePeriod(date(2025, 2, 1), time.Time{}) }, expectedErr: true},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p, err := tc.period()
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !p.Start.Equal(tc.expectedStart) || !p.Last().Equal(tc.expectedLast) {
+				t.Errorf("Expected %s to %s, got %s", tc.expectedStart, tc.expectedLast, p)
+			}
+		})
+	}
+}
+
+func TestGetPeriodReport(t *testing.T) {
+	s := &ReportService{Repo: newMemoryReports()}
+
+	report, err := s.GetQuarterlyReport(2025, 1)
+	if err != nil {
+		t.Fatalf("GetQuarterlyReport failed: %v", err)
+	}
+	if report.Kind != "quarter" || report.PeriodStart != "1 Jan 2025" || report.PeriodEnd != "31 Mar 2025" || report.Issued != "1 Apr 2025" {
+		t.Errorf("Unexpected quarter heading: %+v", report)
+	}
+	if len(report.Payouts) != 3 || report.Gross != lei(10000).String() {
+		t.Errorf("Expected 3 payouts and 100 lei gross, got %d and %s", len(report.Payouts), report.Gross)
+	}
+
+	period, err := RangePeriod(time.Date(2024, time.December, 15, 0, 0, 0, 0, time.UTC), time.Date(2025, time.January, 10, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = s.GetPeriodReport(period)
+	if err != nil {
+		t.Fatalf("GetPeriodReport failed: %v", err)
+	}
+	if report.Kind != "range" || len(report.Payouts) != 2 || report.PeriodEnd != "10 Jan 2025" || report.Issued != "11 Jan 2025" {
+		t.Errorf("Expected po_1 and po_2 up to 10 Jan 2025, got %+v", report)
+	}
+
+	report, err = s.GetMonthlyReport(2025, time.March)
+	if err != nil || report.Kind != "month" || report.PeriodEnd != "31 Mar 2025" || report.LedgerHead != "#7 abc" {
+		t.Errorf("Unexpected monthly report %+v, %v", report, err)
+	}
+	if _, err := s.GetQuarterlyReport(2025, 2); err == nil {
+		t.Errorf("Expected a quarter without payouts to fail")
+	}
+}
+
+func TestGetDonorStatements(t *testing.T) {
+	repo := newMemoryReports()
+	repo.donations = append(repo.donations,
+		&model.Donation{Id: "txn_6", Created: time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC), ClientName: "Ana Pop", ClientEmail: "ANA@example.com", Gross: lei(500)},
+		&model.Donation{Id: "txn_7", Created: time.Date(2025, time.June, 2, 0, 0, 0, 0, time.UTC), ClientName: "Ion", ClientEmail: "ion@example.com", Gross: model.NewMoney(700, "eur")},
+		&model.Donation{Id: "txn_8", Created: time.Date(2025, time.June, 3, 0, 0, 0, 0, time.UTC), ClientName: "Ion", ClientEmail: "ion@example.com", Gross: lei(300)},
+		&model.Donation{Id: "txn_9", Created: time.Date(2025, time.June, 4, 0, 0, 0, 0, time.UTC), ClientName: "erased-1", ClientEmail: "erased-1@erased.invalid", Gross: lei(300)},
+		&model.Donation{Id: "txn_10", Created: time.Date(2025, time.June, 5, 0, 0, 0, 0, time.UTC), ClientName: "Anonim", ClientEmail: "anonim@hintermann.ro", Gross: lei(300), Policy: "2025-01:missing_email+missing_name"},
+		&model.Donation{Id: "txn_11", Created: time.Date(2025, time.June, 6, 0, 0, 0, 0, time.UTC), ClientName: "Anonim", ClientEmail: "anonim@hintermann.ro", Gross: lei(300), Policy: "2025-01:missing_email"},
+		&model.Donation{Id: "txn_12", Created: time.Date(2025, time.June, 7, 0, 0, 0, 0, time.UTC), ClientName: "Legacy", Gross: lei(300)},
+	)
+	s := &ReportService{Repo: repo}
+
+	statements, err := s.GetDonorStatements(2025)
+	if err != nil {
+		t.Fatalf("GetDonorStatements failed: %v", err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("Expected statements for ana and ion only, got %d", len(statements))
+	}
+	ana, ion := statements[0], statements[1]
+	// txn_po_1_0 was made on 28 Dec 2024 and is left out
+	if ana.Count != "5" || ana.Total != lei(10500).String() || ana.ClientName != "Ana Pop" || ana.Issued != "1 Jan 2026" {
+		t.Errorf("Unexpected statement for ana: %+v", ana)
+	}
+	if ana.Donations[0].Id != "txn_po_2_0" || ana.Donations[4].Id != "txn_6" {
+		t.Errorf("Expected ana's donations oldest first, got %s to %s", ana.Donations[0].Id, ana.Donations[4].Id)
+	}
+	if ion.Total != "7.00 EUR + 3.00 lei" {
+		t.Errorf("Expected a total per currency, got %q", ion.Total)
+	}
+
+	statement, err := s.GetDonorStatement(2025, "ion@EXAMPLE.com")
+	if err != nil || statement.Count != "2" {
+		t.Errorf("Expected ion's statement, got %+v, %v", statement, err)
+	}
+	if _, err := s.GetDonorStatement(2024, "ion@example.com"); err == nil {
+		t.Errorf("Expected a year without donations to fail")
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	repo := newMemoryReports()
+	repo.donations = append(repo.donations,
+		&model.Donation{Id: "txn_ion", Created: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), ClientName: "Ion", ClientEmail: "Ion@example.com", Gross: lei(12000)},
+		&model.Donation{Id: "txn_eur", Created: time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC), ClientName: "Ion", ClientEmail: "ion@example.com", Gross: model.NewMoney(700, "eur")},
+	)
+	s := &StatsService{Repo: repo}
+	period, _ := QuarterPeriod(2025, 1)
+
+	stats, err := s.GetStats(period, "RON", 2)
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	// ana gave in December 2024, ion only in the quarter
+	if stats.Count != 5 || stats.OtherCurrencies != 1 || stats.UniqueDonors != 2 || stats.NewDonors != 1 || stats.ReturningDonors != 1 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if stats.Total != 22000 || stats.Mean != 4400 || stats.Median != 3000 {
+		t.Errorf("Expected total 22000, mean 4400 and median 3000, got %d, %d and %d", stats.Total, stats.Mean, stats.Median)
+	}
+	expectedPercentiles := []Percentile{{10, 1000}, {25, 2000}, {75, 4000}, {90, 12000}}
+	if !reflect.DeepEqual(stats.Percentiles, expectedPercentiles) {
+		t.Errorf("Expected percentiles %v, got %v", expectedPercentiles, stats.Percentiles)
+	}
+	expectedHistogram := []HistogramBucket{{0, 5000, 4}, {5000, 10000, 0}, {10000, 20000, 1}, {20000, 50000, 0}, {50000, 100000, 0}, {100000, 0, 0}}
+	if !reflect.DeepEqual(stats.Histogram, expectedHistogram) {
+		t.Errorf("Expected histogram %v, got %v", expectedHistogram, stats.Histogram)
+	}
+	if len(stats.Largest) != 2 || stats.Largest[0].Id != "txn_ion" || stats.Largest[1].Id != "txn_po_4_0" {
+		t.Errorf("Expected txn_ion and txn_po_4_0 as the largest, got %v", stats.Largest)
+	}
+	if d := stats.DTO(); d.Histogram[0].Label != "sub 50.00 lei" || d.Histogram[0].Share != 0.8 || d.Histogram[5].Label != "peste 1000.00 lei" {
+		t.Errorf("Unexpected histogram labels: %+v, %+v", d.Histogram[0], d.Histogram[5])
+	}
+
+	empty, err := s.GetStats(MonthPeriod(2025, time.June), "ron", 2)
+	if err != nil || empty.Count != 0 || empty.Mean != 0 || len(empty.Percentiles) != 0 || len(empty.Largest) != 0 {
+		t.Errorf("Expected empty statistics, got %+v, %v", empty, err)
+	}
+	if _, err := s.GetStats(period, "ron", -1); err == nil {
+		t.Error("Expected an error for a negative top")
+	}
+
+	// anonymous donations are not donors, so the placeholder does not return
+	repo.donations = append(repo.donations,
+		&model.Donation{Id: "txn_anon_1", Created: time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC), ClientEmail: "anonim@hintermann.ro", Gross: lei(1000), Policy: "v2:missing_email"},
+		&model.Donation{Id: "txn_anon_2", Created: time.Date(2025, time.August, 1, 0, 0, 0, 0, time.UTC), ClientEmail: "anonim@hintermann.ro", Gross: lei(1000), Policy: "v2:missing_email"},
+		&model.Donation{Id: "txn_anon_3", Created: time.Date(2025, time.August, 2, 0, 0, 0, 0, time.UTC), Gross: lei(1000)},
+		&model.Donation{Id: "txn_ion_2", Created: time.Date(2025, time.August, 3, 0, 0, 0, 0, time.UTC), ClientEmail: "ion@example.com", Gross: lei(1000)},
+	)
+	august, err := s.GetStats(MonthPeriod(2025, time.August), "ron", 0)
+	if err != nil {
+		t.Fatalf("GetStats failed: %v", err)
+	}
+	if august.Count != 3 || august.AnonymousDonations != 2 || august.UniqueDonors != 1 || august.NewDonors != 0 || august.ReturningDonors != 1 {
+		t.Errorf("Expected 3 donations, 2 anonymous and ion returning, got %+v", august)
+	}
+}
+
+func TestGetFeeReport(t *testing.T) {
+	repo := newMemoryReports()
+	repo.donations = append(repo.donations,
+		&model.Donation{Id: "txn_intl", Created: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), Gross: lei(1000), Fee: lei(300)},
+		&model.Donation{Id: "txn_eur", Created: time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC), Gross: model.NewMoney(1000, "eur"), Fee: model.NewMoney(100, "eur")},
+		&model.Donation{Id: "txn_edge", Created: time.Date(2025, time.March, 20, 0, 0, 0, 0, time.UTC), Gross: lei(1000), Fee: lei(110)},
+	)
+	s := &FeeService{Repo: repo}
+	period, _ := QuarterPeriod(2025, 1)
+
+	report, err := s.GetFeeReport(period, "ron", FeePricing{Rate: 1000, Tolerance: 100})
+	if err != nil {
+		t.Fatalf("GetFeeReport failed: %v", err)
+	}
+	if report.Gross != 12000 || report.Fee != 1410 || report.Expected != 1200 || report.OtherCurrencies != 1 {
+		t.Errorf("Unexpected totals: %+v", report.FeeRate)
+	}
+	// txn_edge is exactly one point above the expected rate
+	var flagged []string
+	for _, d := range report.Donations {
+		if d.Flagged {
+			flagged = append(flagged, d.Id)
+		}
+	}
+	if report.Flagged != 1 || !reflect.DeepEqual(flagged, []string{"txn_intl"}) {
+		t.Errorf("Expected only txn_intl flagged, got %v", flagged)
+	}
+
+	if len(report.Months) != 3 {
+		t.Fatalf("Expected 3 months, got %d", len(report.Months))
+	}
+	jan, feb, mar := report.Months[0], report.Months[1], report.Months[2]
+	if jan.Donations != 3 || jan.Rate != 0.1 || jan.Change != 0 {
+		t.Errorf("Unexpected January: %+v", jan)
+	}
+	if feb.Donations != 1 || feb.Rate != 0.3 || math.Abs(feb.Change-0.2) > 1e-9 {
+		t.Errorf("Unexpected February: %+v", feb)
+	}
+	if mar.Donations != 2 || mar.Rate != 0.102 || math.Abs(mar.Change+0.198) > 1e-9 {
+		t.Errorf("Unexpected March: %+v", mar)
+	}
+
+	if len(report.Payouts) != 3 || report.Payouts[0].Id != "po_2" || report.Payouts[0].Rate != 0.1 {
+		t.Errorf("Expected po_2 to po_4 at 10%%, got %+v", report.Payouts)
+	}
+
+	if fee := DefaultFeePricing.Expected(10000); fee != 275 {
+		t.Errorf("Expected 1.5%% + 1.25 lei of 100 lei to be 275, got %d", fee)
+	}
+	if _, err := s.GetFeeReport(period, "ron", FeePricing{Rate: -1}); err == nil {
+		t.Errorf("Expected negative pricing to fail")
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// Donor statements cover the donations made in a year, by donation date,
+// grouped by email without case. The newest donation's name is used.
+// Donations without an email, or with the policy's placeholder email, are not
+// one donor's and get no statement.
+
+// GetDonorStatements returns one statement per donor, sorted by email.
+// Pseudonymized donors and donations without an email are skipped.
+func (s *ReportService) GetDonorStatements(year int) ([]*dto.DonorStatementDTO, error) {
+	return s.donorStatements(year, "")
+}
+
+func (s *ReportService) GetDonorStatement(year int, email string) (*dto.DonorStatementDTO, error) {
+	if email == "" {
+		return nil, errors.New("email is required")
+	}
+	statements, err := s.donorStatements(year, email)
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no donations found for %s in %d", email, year)
+	}
+	return statements[0], nil
+}
+
+func (s *ReportService) donorStatements(year int, email string) ([]*dto.DonorStatementDTO, error) {
+	page, err := s.Repo.QueryDonations(DonationQuery{
+		Email: email,
+		From:  time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC),
+		Sort:  SortByCreated,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byDonor := make(map[string][]*model.Donation)
+	for _, d := range page.Donations {
+		key := donorKey(d)
+		if key == "" {
+			continue
+		}
+		byDonor[key] = append(byDonor[key], d)
+	}
+	emails := make([]string, 0, len(byDonor))
+	for key := range byDonor {
+		emails = append(emails, key)
+	}
+	slices.Sort(emails)
+
+	statements := make([]*dto.DonorStatementDTO, len(emails))
+	for i, key := range emails {
+		donations := byDonor[key]
+		newest := donations[len(donations)-1]
+		statements[i] = dto.FromDonorDonations(year, newest.ClientName, newest.ClientEmail, totalsByCurrency(donations), donations)
+	}
+	return statements, nil
+}
+
+// donorKey is the donation's email without case, or "" when the donation is
+// not one donor's: it has no email, a pseudonym or the policy's placeholder.
+func donorKey(d *model.Donation) string {
+	key := strings.ToLower(d.ClientEmail)
+	if key == "" || strings.HasSuffix(key, erasedEmailDomain) || appliedRule(d, "missing_email") {
+		return ""
+	}
+	return key
+}
+
+// totalsByCurrency sums the gross amounts per currency, in the order the
+// currencies first appear.
+func totalsByCurrency(donations []*model.Donation) []model.Money {
+	var totals []model.Money
+	for _, d := range donations {
+		i := slices.IndexFunc(totals, func(m model.Money) bool { return m.Currency == d.Gross.Currency })
+		if i < 0 {
+			totals = append(totals, d.Gross)
+			continue
+		}
+		totals[i].Amount += d.Gross.Amount
+	}
+	return totals
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/dto"
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// StatsPercentiles are reported besides the median.
+var StatsPercentiles = []int{10, 25, 75, 90}
+
+// statsHistogramEdges are the lower bounds of the histogram buckets after
+// the first, in minor units.
+var statsHistogramEdges = []int64{5000, 10000, 20000, 50000, 100000}
+
+type StatsReader interface {
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+}
+
+type Percentile struct {
+	Percent int   `json:"percent"`
+	Amount  int64 `json:"amount"`
+}
+
+// HistogramBucket counts the donations from Min up to, but not including,
+// Max. The last bucket has no Max.
+type HistogramBucket struct {
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max,omitempty"`
+	Count int   `json:"count"`
+}
+
+// DonationStats cover the gross amounts of the donations made in a period in
+// one currency, in minor units. Donations in other currencies are only
+// counted.
+type DonationStats struct {
+	Start    time.Time `json:"start"`
+	Last     time.Time `json:"last"`
+	Currency string    `json:"currency"`
+	Count    int       `json:"count"`
+	// OtherCurrencies counts the donations left out for their currency.
+	OtherCurrencies int `json:"other_currencies"`
+	UniqueDonors    int `json:"unique_donors"`
+	// NewDonors gave for the first time in the period.
+	NewDonors       int `json:"new_donors"`
+	ReturningDonors int `json:"returning_donors"`
+	// AnonymousDonations have no donor: no email, a pseudonym or the
+	// policy's placeholder. They are counted in the amounts only.
+	AnonymousDonations int               `json:"anonymous_donations"`
+	Total              int64             `json:"total"`
+	Mean               int64             `json:"mean"`
+	Median             int64             `json:"median"`
+	Percentiles        []Percentile      `json:"percentiles"`
+	Histogram          []HistogramBucket `json:"histogram"`
+	Largest            []*model.Donation `json:"largest"`
+}
+
+type StatsService struct {
+	Repo StatsReader
+}
+
+// GetStats computes the statistics of the period's donations in currency,
+// with the top largest donations.
+func (s *StatsService) GetStats(period Period, currency string, top int) (*DonationStats, error) {
+	if top < 0 {
+		return nil, fmt.Errorf("top cannot be negative: %d", top)
+	}
+	currency = model.NewMoney(0, currency).Currency
+	page, err := s.Repo.QueryDonations(DonationQuery{From: period.Start, To: period.Last(), Sort: SortByCreated})
+	if err != nil {
+		return nil, err
+	}
+	earlier, err := s.Repo.QueryDonations(DonationQuery{To: period.Start.AddDate(0, 0, -1)})
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, d := range earlier.Donations {
+		if key := donorKey(d); key != "" {
+			known[key] = true
+		}
+	}
+
+	stats := &DonationStats{Start: period.Start, Last: period.Last(), Currency: currency, Percentiles: []Percentile{}}
+	var donations []*model.Donation
+	donors := make(map[string]bool)
+	for _, d := range page.Donations {
+		if d.Gross.Currency != currency {
+			stats.OtherCurrencies++
+			continue
+		}
+		donations = append(donations, d)
+		email := donorKey(d)
+		if email == "" {
+			stats.AnonymousDonations++
+			continue
+		}
+		if donors[email] {
+			continue
+		}
+		donors[email] = true
+		if known[email] {
+			stats.ReturningDonors++
+		} else {
+			stats.NewDonors++
+		}
+	}
+	stats.Count = len(donations)
+	stats.UniqueDonors = len(donors)
+
+	amounts := make([]int64, len(donations))
+	for i, d := range donations {
+		amounts[i] = d.Gross.Amount
+		stats.Total += d.Gross.Amount
+	}
+	slices.Sort(amounts)
+	stats.Histogram = histogram(amounts)
+	if len(amounts) > 0 {
+		stats.Mean = (stats.Total + int64(len(amounts))/2) / int64(len(amounts))
+		stats.Median = median(amounts)
+		for _, p := range StatsPercentiles {
+			stats.Percentiles = append(stats.Percentiles, Percentile{Percent: p, Amount: percentile(amounts, p)})
+		}
+	}
+
+	largest := slices.Clone(donations)
+	slices.SortStableFunc(largest, func(a, b *model.Donation) int {
+		switch {
+		case a.Gross.Amount > b.Gross.Amount:
+			return -1
+		case a.Gross.Amount < b.Gross.Amount:
+			return 1
+		}
+		return 0
+	})
+	stats.Largest = largest[:min(top, len(largest))]
+	return stats, nil
+}
+
+func median(sorted []int64) int64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// percentile uses the nearest rank: the smallest amount with at least p
+// percent of the amounts at or below it.
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func histogram(sorted []int64) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(statsHistogramEdges)+1)
+	for i := range buckets {
+		if i > 0 {
+			buckets[i].Min = statsHistogramEdges[i-1]
+		}
+		if i < len(statsHistogramEdges) {
+			buckets[i].Max = statsHistogramEdges[i]
+		}
+	}
+	for _, amount := range sorted {
+		i, _ := slices.BinarySearch(statsHistogramEdges, amount+1)
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+// DTO formats the statistics for the PDF page.
+func (s *DonationStats) DTO() *dto.StatsDTO {
+	money := func(amount int64) model.Money { return model.NewMoney(amount, s.Currency) }
+	percentiles := make([]*dto.PercentileDTO, len(s.Percentiles))
+	for i, p := range s.Percentiles {
+		percentiles[i] = dto.FromPercentile(p.Percent, money(p.Amount))
+	}
+	buckets := make([]*dto.HistogramBucketDTO, len(s.Histogram))
+	for i, b := range s.Histogram {
+		buckets[i] = dto.FromHistogramBucket(money(b.Min), money(b.Max), b.Max == 0, b.Count, s.Count)
+	}
+	return dto.FromStats(s.Start, s.Last, s.Count, s.OtherCurrencies, s.UniqueDonors, s.NewDonors, s.ReturningDonors, s.AnonymousDonations,
+		money(s.Total), money(s.Mean), money(s.Median), percentiles, buckets, s.Largest)
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// Pseudonym replaces a donor's name and email. The amounts, dates and
+// payouts of the rows stay as they are for the accounts.
+type Pseudonym struct {
+	Name  string
+	Email string
+}
+
+// DonorEraser rewrites every donation with the email, compared without
+// case, and returns the IDs of the rewritten rows.
+type DonorEraser interface {
+	PseudonymizeDonor(email string, p Pseudonym) ([]string, error)
+}
+
+type SubjectStore interface {
+	QueryDonations(q DonationQuery) (*DonationPage, error)
+	GetCorrections(donationId string) ([]*model.Correction, error)
+	DonorEraser
+}
+
+// erasedEmailDomain ends every pseudonymized email.
+const erasedEmailDomain = "@erased.invalid"
+
+type ErasureLog interface {
+	AppendErasure(e *ErasureRecord) error
+}
+
+// SubjectRecords is everything stored about one donor, for a GDPR access
+// request.
+type SubjectRecords struct {
+	Email       string                          `json:"email"`
+	Exported    time.Time                       `json:"exported"`
+	Donations   []*model.Donation               `json:"donations"`
+	Corrections []*model.Correction             `json:"corrections"`
+	Quarantined []*model.QuarantinedTransaction `json:"quarantined"`
+	Rejected    []*model.QuarantinedTransaction `json:"rejected"`
+}
+
+// ErasureRecord is what the erasure log keeps. It names the pseudonym and
+// the rewritten rows, never the erased email.
+type ErasureRecord struct {
+	Erased             time.Time `json:"erased"`
+	Operator           string    `json:"operator"`
+	Reason             string    `json:"reason"`
+	Pseudonym          string    `json:"pseudonym"`
+	DonationIds        []string  `json:"donation_ids"`
+	QuarantinedPayouts []string  `json:"quarantined_payouts"`
+	RejectedPayouts    []string  `json:"rejected_payouts"`
+}
+
+type SubjectService struct {
+	Repo       SubjectStore
+	Quarantine QuarantineStore
+	// Rejected holds the payouts the donation policy rejected, if set.
+	Rejected QuarantineStore
+	Log      ErasureLog
+}
+
+func (s *SubjectService) Export(email string) (*SubjectRecords, error) {
+	if email == "" {
+		return nil, errors.New("email is required")
+	}
+	page, err := s.Repo.QueryDonations(DonationQuery{Email: email})
+	if err != nil {
+		return nil, err
+	}
+	records := &SubjectRecords{
+		Email:       email,
+		Exported:    time.Now().UTC(),
+		Donations:   page.Donations,
+		Corrections: []*model.Correction{},
+	}
+	if records.Donations == nil {
+		records.Donations = []*model.Donation{}
+	}
+	for _, d := range records.Donations {
+		corrections, err := s.Repo.GetCorrections(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		records.Corrections = append(records.Corrections, corrections...)
+	}
+	if records.Quarantined, err = donorCharges(s.Quarantine, email); err != nil {
+		return nil, err
+	}
+	if records.Rejected, err = donorCharges(s.Rejected, email); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// donorCharges returns the charges with the email kept in store.
+func donorCharges(store QuarantineStore, email string) ([]*model.QuarantinedTransaction, error) {
+	charges := []*model.QuarantinedTransaction{}
+	if store == nil {
+		return charges, nil
+	}
+	payouts, err := store.GetQuarantinedPayouts()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range payouts {
+		for _, charge := range q.Charges {
+			if strings.EqualFold(charge.ClientEmail, email) {
+				charges = append(charges, charge)
+			}
+		}
+	}
+	return charges, nil
+}
+
+// Erase pseudonymizes the donor in the stored donations and in the
+// quarantined and rejected payouts, and logs the erasure.
+func (s *SubjectService) Erase(email, operator, reason string) (*ErasureRecord, error) {
+	if email == "" || operator == "" || reason == "" {
+		return nil, errors.New("email, operator and reason are required")
+	}
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return nil, err
+	}
+	record := &ErasureRecord{
+		Erased:    time.Now().UTC(),
+		Operator:  operator,
+		Reason:    reason,
+		Pseudonym: pseudonym.Name,
+	}
+	if record.DonationIds, err = s.Repo.PseudonymizeDonor(email, pseudonym); err != nil {
+		return nil, fmt.Errorf("failed to pseudonymize donations: %w", err)
+	}
+	if record.DonationIds == nil {
+		record.DonationIds = []string{}
+	}
+
+	if record.QuarantinedPayouts, err = pseudonymizeCharges(s.Quarantine, email, pseudonym); err != nil {
+		return nil, err
+	}
+	if record.RejectedPayouts, err = pseudonymizeCharges(s.Rejected, email, pseudonym); err != nil {
+		return nil, err
+	}
+
+	if len(record.DonationIds) == 0 && len(record.QuarantinedPayouts) == 0 && len(record.RejectedPayouts) == 0 {
+		return nil, fmt.Errorf("no records found for %s", email)
+	}
+	if err := s.Log.AppendErasure(record); err != nil {
+		return nil, fmt.Errorf("donor was erased but the erasure was not logged: %w", err)
+	}
+	return record, nil
+}
+
+// pseudonymizeCharges rewrites the charges with the email kept in store and
+// returns the IDs of the rewritten payouts.
+func pseudonymizeCharges(store QuarantineStore, email string, pseudonym Pseudonym) ([]string, error) {
+	ids := []string{}
+	if store == nil {
+		return ids, nil
+	}
+	payouts, err := store.GetQuarantinedPayouts()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range payouts {
+		changed := false
+		for _, charge := range q.Charges {
+			if strings.EqualFold(charge.ClientEmail, email) {
+				charge.ClientName, charge.ClientEmail = pseudonym.Name, pseudonym.Email
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		if err := store.WriteQuarantinedPayout(q); err != nil {
+			return nil, fmt.Errorf("failed to pseudonymize payout %s: %w", q.PayoutId, err)
+		}
+		ids = append(ids, q.PayoutId)
+	}
+	return ids, nil
+}
+
+// newPseudonym is random rather than derived from the email, so it cannot be
+// traced back by hashing candidate addresses.
+func newPseudonym() (Pseudonym, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return Pseudonym{}, err
+	}
+	name := "erased-" + hex.EncodeToString(b)
+	return Pseudonym{Name: name, Email: name + erasedEmailDomain}, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+type ValidationError struct {
+	TransactionId string
+	Field         string
+	Rule          string
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Rule
+	if e.Field != "" {
+		msg = e.Field + " " + e.Rule
+	}
+	if e.TransactionId != "" {
+		return e.TransactionId + ": " + msg
+	}
+	return msg
+}
+
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs *ValidationErrors) add(transactionId, field, rule string) {
+	*errs = append(*errs, &ValidationError{
+		TransactionId: transactionId,
+		Field:         field,
+		Rule:          rule,
+	})
+}
+
+func (errs ValidationErrors) issues() []*model.ValidationIssue {
+	issues := make([]*model.ValidationIssue, len(errs))
+	for i, e := range errs {
+		issues[i] = &model.ValidationIssue{
+			TransactionId: e.TransactionId,
+			Field:         e.Field,
+			Rule:          e.Rule,
+		}
+	}
+	return issues
+}
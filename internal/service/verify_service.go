@@ -0,0 +1,163 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diother/hintermann-stripe-cli/internal/model"
+)
+
+// RawRow is a stored payout or donation before parsing, so that malformed
+// cells can be reported instead of failing the whole read.
+type RawRow struct {
+	Source   string
+	Line     int
+	Id       string
+	Created  string
+	PayoutId string
+	Gross    string
+	Fee      string
+	Net      string
+	Currency string
+}
+
+type RawReader interface {
+	RawPayouts() ([]*RawRow, error)
+	RawDonations() ([]*RawRow, error)
+}
+
+type VerifyIssue struct {
+	Source string `json:"source"`
+	Line   int    `json:"line,omitempty"`
+	Id     string `json:"id"`
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+}
+
+type VerifyReport struct {
+	Checked   time.Time      `json:"checked"`
+	Payouts   int            `json:"payouts"`
+	Donations int            `json:"donations"`
+	Issues    []*VerifyIssue `json:"issues"`
+}
+
+type VerifyService struct {
+	Repo RawReader
+}
+
+type verifiedRow struct {
+	raw             *RawRow
+	gross, fee, net model.Money
+	ok              bool
+}
+
+func (s *VerifyService) Verify() (*VerifyReport, error) {
+	rawPayouts, err := s.Repo.RawPayouts()
+	if err != nil {
+		return nil, err
+	}
+	rawDonations, err := s.Repo.RawDonations()
+	if err != nil {
+		return nil, err
+	}
+	report := &VerifyReport{Checked: time.Now().UTC(), Payouts: len(rawPayouts), Donations: len(rawDonations), Issues: []*VerifyIssue{}}
+
+	payouts := make(map[string]*verifiedRow, len(rawPayouts))
+	var payoutIds []string
+	for _, raw := range rawPayouts {
+		row := report.verifyRow(raw)
+		if _, dup := payouts[raw.Id]; dup {
+			report.add(raw, "id", "is a duplicate payout id")
+			continue
+		}
+		payouts[raw.Id] = row
+		payoutIds = append(payoutIds, raw.Id)
+	}
+
+	seen := make(map[string]bool, len(rawDonations))
+	byPayout := make(map[string][]*verifiedRow)
+	for _, raw := range rawDonations {
+		row := report.verifyRow(raw)
+		if seen[raw.Id] {
+			report.add(raw, "id", "is a duplicate donation id")
+			continue
+		}
+		seen[raw.Id] = true
+		if _, ok := payouts[raw.PayoutId]; !ok {
+			report.add(raw, "payout_id", fmt.Sprintf("%q has no payout", raw.PayoutId))
+			continue
+		}
+		byPayout[raw.PayoutId] = append(byPayout[raw.PayoutId], row)
+	}
+
+	for _, id := range payoutIds {
+		report.verifySums(payouts[id], byPayout[id])
+	}
+	return report, nil
+}
+
+func (r *VerifyReport) add(raw *RawRow, field, rule string) {
+	r.Issues = append(r.Issues, &VerifyIssue{Source: raw.Source, Line: raw.Line, Id: raw.Id, Field: field, Rule: rule})
+}
+
+func (r *VerifyReport) verifyRow(raw *RawRow) *verifiedRow {
+	row := &verifiedRow{raw: raw, ok: true}
+	if raw.Id == "" {
+		r.add(raw, "id", "is missing")
+	}
+	if _, err := time.Parse(time.RFC3339, raw.Created); err != nil {
+		r.add(raw, "created", fmt.Sprintf("%q is not an RFC 3339 timestamp", raw.Created))
+	}
+	for _, amount := range []struct {
+		field string
+		value string
+		dst   *model.Money
+	}{{"gross", raw.Gross, &row.gross}, {"fee", raw.Fee, &row.fee}, {"net", raw.Net, &row.net}} {
+		m, err := model.ParseMoney(amount.value, raw.Currency)
+		if err != nil {
+			r.add(raw, amount.field, err.Error())
+			row.ok = false
+			continue
+		}
+		*amount.dst = m
+	}
+	if row.ok {
+		if net, _ := row.gross.Sub(row.fee); !net.Equal(row.net) {
+			r.add(raw, "net", fmt.Sprintf("gross %d - fee %d != net %d", row.gross.Amount, row.fee.Amount, row.net.Amount))
+		}
+	}
+	return row
+}
+
+func (r *VerifyReport) verifySums(payout *verifiedRow, donations []*verifiedRow) {
+	if len(donations) == 0 {
+		r.add(payout.raw, "donations", "are missing")
+		return
+	}
+	if !payout.ok {
+		return
+	}
+	gross := model.NewMoney(0, payout.gross.Currency)
+	fee := model.NewMoney(0, payout.gross.Currency)
+	net := model.NewMoney(0, payout.gross.Currency)
+	for _, d := range donations {
+		if !d.ok {
+			return
+		}
+		var err error
+		if gross, err = gross.Add(d.gross); err != nil {
+			r.add(d.raw, "currency", fmt.Sprintf("%s does not match payout %s", d.gross.Currency, payout.raw.Id))
+			return
+		}
+		fee, _ = fee.Add(d.fee)
+		net, _ = net.Add(d.net)
+	}
+	for _, sum := range []struct {
+		field         string
+		total, stored model.Money
+	}{{"gross", gross, payout.gross}, {"fee", fee, payout.fee}, {"net", net, payout.net}} {
+		if !sum.total.Equal(sum.stored) {
+			r.add(payout.raw, sum.field, fmt.Sprintf("%d does not match the donation sum %d", sum.stored.Amount, sum.total.Amount))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/diother/hintermann-stripe-cli/internal/model"
@@ -12,31 +13,63 @@ type Writer interface {
 	WritePayoutAndDonations(p *model.Payout, ds []*model.Donation) error
 }
 
+type QuarantineStore interface {
+	WriteQuarantinedPayout(q *model.QuarantinedPayout) error
+	GetQuarantinedPayout(payoutId string) (*model.QuarantinedPayout, error)
+	GetQuarantinedPayouts() ([]*model.QuarantinedPayout, error)
+}
+
+var (
+	ErrQuarantined = errors.New("payout quarantined")
+	ErrRejected    = errors.New("payout rejected")
+)
+
+// WebhookService stores a payout that passes validation and the donation
+// policy. A payout with a charge the policy rejects is kept in Rejected, and
+// any other failure in Quarantine, both with the whole validation report.
 type WebhookService struct {
-	Repo Writer
+	Repo       Writer
+	Quarantine QuarantineStore
+	Rejected   QuarantineStore
+	Policy     *DonationPolicy
 }
 
 func (s *WebhookService) HandlePayoutReconciliation(stripePayout *stripe.Payout) error {
-	if err := validateStripePayout(stripePayout); err != nil {
-		return fmt.Errorf("stripe payout invalid: %w", err)
+	if errs := validateStripePayout(stripePayout); len(errs) > 0 {
+		return fmt.Errorf("stripe payout invalid: %w", errs)
 	}
 	payoutTransaction, chargeTransactions, err := fetchRelatedTransactions(stripePayout.ID)
 	if err != nil {
 		return fmt.Errorf("transactions fetch failed: %w", err)
 	}
-	if err := validatePayoutTransaction(payoutTransaction); err != nil {
-		return fmt.Errorf("payout transaction invalid: %w", err)
-	}
-	if err := validateChargeTransactions(chargeTransactions); err != nil {
-		return fmt.Errorf("charge transactions invalid: %w", err)
-	}
-	gross, fee, net, err := validateMatchingSums(payoutTransaction, chargeTransactions)
-	if err != nil {
-		return fmt.Errorf("matching sum validation failed: %w", err)
+	return s.handleTransactions(stripePayout, payoutTransaction, chargeTransactions)
+}
+
+func (s *WebhookService) handleTransactions(stripePayout *stripe.Payout, payoutTransaction *stripe.BalanceTransaction, chargeTransactions []*stripe.BalanceTransaction) error {
+	gross, fee, net, errs := validateTransactions(payoutTransaction, chargeTransactions)
+	decisions, rejected, quarantined := s.policy().evaluateAll(chargeTransactions)
+	if len(rejected) > 0 {
+		report := append(append(errs, rejected...), quarantined...)
+		return s.reject(model.FromQuarantinedStripeData(stripePayout, payoutTransaction, chargeTransactions), report)
+	}
+	errs = append(errs, quarantined...)
+	if len(errs) > 0 {
+		if s.Quarantine == nil {
+			return fmt.Errorf("payout %s failed validation: %w", stripePayout.ID, errs)
+		}
+		q := model.FromQuarantinedStripeData(stripePayout, payoutTransaction, chargeTransactions)
+		q.Report = errs.issues()
+		if err := s.quarantine(q); err != nil {
+			return fmt.Errorf("failed to quarantine payout %s: %w", stripePayout.ID, err)
+		}
+		return fmt.Errorf("%w: %s: %w", ErrQuarantined, stripePayout.ID, errs)
 	}
 
 	payout := model.FromStripePayoutAndTotals(stripePayout, gross, fee, net)
 	donations := model.FromChargeTransactionsAndPayoutId(chargeTransactions, stripePayout.ID)
+	for i, d := range donations {
+		s.policy().applyTo(d, decisions[i])
+	}
 
 	if err := s.Repo.WritePayoutAndDonations(payout, donations); err != nil {
 		return fmt.Errorf("failed to persist payout+donations: %w", err)
@@ -44,6 +77,45 @@ func (s *WebhookService) HandlePayoutReconciliation(stripePayout *stripe.Payout)
 	return nil
 }
 
+func (s *WebhookService) policy() *DonationPolicy {
+	if s.Policy == nil {
+		return DefaultDonationPolicy()
+	}
+	return s.Policy
+}
+
+// reject records a payout the policy rejects. It is not stored and cannot be
+// approved.
+func (s *WebhookService) reject(q *model.QuarantinedPayout, report ValidationErrors) error {
+	if s.Rejected == nil {
+		return fmt.Errorf("payout %s rejected by the donation policy: %w", q.PayoutId, report)
+	}
+	q.Report = report.issues()
+	if err := s.Rejected.WriteQuarantinedPayout(q); err != nil {
+		return fmt.Errorf("failed to record rejected payout %s: %w", q.PayoutId, err)
+	}
+	return fmt.Errorf("%w: %s: %w", ErrRejected, q.PayoutId, report)
+}
+
+func (s *WebhookService) quarantine(q *model.QuarantinedPayout) error {
+	existing, err := s.Quarantine.GetQuarantinedPayout(q.PayoutId)
+	if err == nil {
+		q.Notes = existing.Notes
+		q.Approval = existing.Approval
+	}
+	return s.Quarantine.WriteQuarantinedPayout(q)
+}
+
+func ValidatePayout(payoutId string, policy *DonationPolicy) (ValidationErrors, error) {
+	payoutTransaction, chargeTransactions, err := fetchRelatedTransactions(payoutId)
+	if err != nil {
+		return nil, fmt.Errorf("transactions fetch failed: %w", err)
+	}
+	_, _, _, errs := validateTransactions(payoutTransaction, chargeTransactions)
+	_, rejected, quarantined := policy.evaluateAll(chargeTransactions)
+	return append(append(errs, rejected...), quarantined...), nil
+}
+
 func fetchRelatedTransactions(id string) (*stripe.BalanceTransaction, []*stripe.BalanceTransaction, error) {
 	params := &stripe.BalanceTransactionListParams{}
 	params.Payout = &id
@@ -67,112 +139,151 @@ func fetchRelatedTransactions(id string) (*stripe.BalanceTransaction, []*stripe.
 	return payout, charges, nil
 }
 
-func validateStripePayout(payout *stripe.Payout) error {
+func validateTransactions(payout *stripe.BalanceTransaction, charges []*stripe.BalanceTransaction) (model.Money, model.Money, model.Money, ValidationErrors) {
+	var errs ValidationErrors
+	var zero model.Money
+	errs = append(errs, validatePayoutTransaction(payout)...)
+	errs = append(errs, validateChargeTransactions(charges)...)
 	if payout == nil {
-		return fmt.Errorf("is nil")
+		return zero, zero, zero, errs
+	}
+	gross, fee, net, sumErrs := validateMatchingSums(payout, charges)
+	errs = append(errs, sumErrs...)
+	if len(errs) > 0 {
+		return zero, zero, zero, errs
+	}
+	return gross, fee, net, nil
+}
+
+func validateStripePayout(payout *stripe.Payout) ValidationErrors {
+	var errs ValidationErrors
+	if payout == nil {
+		errs.add("", "", "is nil")
+		return errs
 	}
 	if payout.ID == "" {
-		return fmt.Errorf("id is missing")
+		errs.add("", "id", "is missing")
 	}
 	if payout.Created <= 0 {
-		return fmt.Errorf("created is not positive")
+		errs.add(payout.ID, "created", "is not positive")
 	}
 	if payout.ReconciliationStatus != "completed" {
-		return fmt.Errorf("reconciliation status is not completed")
+		errs.add(payout.ID, "reconciliation status", "is not completed")
 	}
-	return nil
+	return errs
 }
 
-func validatePayoutTransaction(payout *stripe.BalanceTransaction) error {
+func validatePayoutTransaction(payout *stripe.BalanceTransaction) ValidationErrors {
+	var errs ValidationErrors
 	if payout == nil {
-		return fmt.Errorf("is nil")
+		errs.add("", "payout transaction", "is nil")
+		return errs
 	}
 	if payout.Type != "payout" {
-		return fmt.Errorf("type is not payout")
+		errs.add(payout.ID, "type", "is not payout")
 	}
 	if payout.ID == "" {
-		return fmt.Errorf("id is missing")
+		errs.add("", "id", "is missing")
 	}
 	if payout.Created <= 0 {
-		return fmt.Errorf("created is not positive")
+		errs.add(payout.ID, "created", "is not positive")
 	}
 	if payout.Amount >= 0 {
-		return fmt.Errorf("amount is not negative")
+		errs.add(payout.ID, "amount", "is not negative")
 	}
 	if payout.Fee != 0 {
-		return fmt.Errorf("fee is not 0")
+		errs.add(payout.ID, "fee", "is not 0")
 	}
 	if payout.Net >= 0 {
-		return fmt.Errorf("net is not negative")
+		errs.add(payout.ID, "net", "is not negative")
 	}
-	return nil
+	return errs
 }
 
-func validateChargeTransactions(charges []*stripe.BalanceTransaction) error {
+func validateChargeTransactions(charges []*stripe.BalanceTransaction) ValidationErrors {
+	var errs ValidationErrors
 	if len(charges) == 0 {
-		return fmt.Errorf("slice is nil")
+		errs.add("", "charges", "is empty")
+		return errs
 	}
 	for i, charge := range charges {
-		if err := validateChargeTransaction(charge); err != nil {
-			if charge.Type == "stripe_fee" {
-				return fmt.Errorf("stripe_fee transactions were not expected")
-			}
-			return fmt.Errorf("index %d %w", i, err)
+		if charge == nil {
+			errs.add("", fmt.Sprintf("index %d", i), "is nil")
+			continue
+		}
+		if charge.Type == "stripe_fee" {
+			errs.add(charge.ID, "type", "stripe_fee was not expected")
+			continue
 		}
+		errs = append(errs, validateChargeTransaction(charge)...)
 	}
-	return nil
+	return errs
 }
 
-func validateChargeTransaction(charge *stripe.BalanceTransaction) error {
+func validateChargeTransaction(charge *stripe.BalanceTransaction) ValidationErrors {
+	var errs ValidationErrors
 	if charge == nil {
-		return fmt.Errorf("is nil")
+		errs.add("", "", "is nil")
+		return errs
 	}
 	if charge.Type != "charge" && charge.Type != "payment" {
-		return fmt.Errorf("type is not charge or payment")
+		errs.add(charge.ID, "type", "is not charge or payment")
 	}
 	if charge.ID == "" {
-		return fmt.Errorf("id is missing")
+		errs.add("", "id", "is missing")
 	}
 	if charge.Created <= 0 {
-		return fmt.Errorf("created is not positive")
+		errs.add(charge.ID, "created", "is not positive")
 	}
 	if charge.Amount <= 0 {
-		return fmt.Errorf("amount is not positive")
+		errs.add(charge.ID, "amount", "is not positive")
 	}
 	if charge.Fee <= 0 {
-		return fmt.Errorf("fee is not positive")
+		errs.add(charge.ID, "fee", "is not positive")
 	}
 	if charge.Net <= 0 {
-		return fmt.Errorf("net is not positive")
-	}
-	if charge.Source == nil {
-		return fmt.Errorf("source is nil")
-	}
-	if charge.Source.Charge == nil {
-		return fmt.Errorf("charge object is nil")
+		errs.add(charge.ID, "net", "is not positive")
 	}
-	if charge.Source.Charge.BillingDetails == nil {
-		return fmt.Errorf("billing details is nil")
+	switch {
+	case charge.Source == nil:
+		errs.add(charge.ID, "source", "is nil")
+	case charge.Source.Charge == nil:
+		errs.add(charge.ID, "charge object", "is nil")
+	case charge.Source.Charge.BillingDetails == nil:
+		errs.add(charge.ID, "billing details", "is nil")
 	}
-	if charge.Source.Charge.BillingDetails.Email == "" {
-		return fmt.Errorf("email is missing")
-	}
-	return nil
+	return errs
 }
 
-func validateMatchingSums(payout *stripe.BalanceTransaction, charges []*stripe.BalanceTransaction) (int, int, int, error) {
-	var gross, fee, net int
+func validateMatchingSums(payout *stripe.BalanceTransaction, charges []*stripe.BalanceTransaction) (model.Money, model.Money, model.Money, ValidationErrors) {
+	var errs ValidationErrors
+	var zero model.Money
+	currency := string(payout.Currency)
+	gross := model.NewMoney(0, currency)
+	fee := model.NewMoney(0, currency)
 
 	for _, charge := range charges {
-		gross += int(charge.Amount)
-		fee += int(charge.Fee)
+		if charge == nil {
+			continue
+		}
+		amount := model.NewMoney(charge.Amount, string(charge.Currency))
+		if amount.Currency != gross.Currency {
+			errs.add(charge.ID, "currency", "does not match the payout currency "+gross.Currency)
+			continue
+		}
+		gross, _ = gross.Add(amount)
+		fee, _ = fee.Add(model.NewMoney(charge.Fee, string(charge.Currency)))
+	}
+	if len(errs) > 0 {
+		return zero, zero, zero, errs
 	}
 
-	net = gross - fee
-	payoutAmount := int(-payout.Amount)
+	net, _ := gross.Sub(fee)
+	payoutAmount := model.NewMoney(-payout.Amount, currency)
 
-	if payoutAmount != net {
-		return 0, 0, 0, fmt.Errorf("payout amount does not match total charges minus fees. amount %v != net %v", payoutAmount, net)
+	if !payoutAmount.Equal(net) {
+		errs.add(payout.ID, "amount", fmt.Sprintf("does not match total charges minus fees. amount %v != net %v", payoutAmount.Amount, net.Amount))
+		return zero, zero, zero, errs
 	}
 	return gross, fee, net, nil
 }